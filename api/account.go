@@ -2,14 +2,21 @@ package api
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	accountController "simplebank/pkg/controllers/account"
+	"simplebank/pkg/rbac"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	errAccountNotOwned = errors.New("account doesn't belong to the authenticated user")
+	errAtInFuture      = errors.New("at is in the future")
+)
+
 type createAccountRequest struct {
-	Owner    string `db:"owner" json:"owner" binding:"required"`
 	Currency string `db:"currency" json:"currency" binding:"required,oneof=USD EUR"`
 }
 
@@ -21,7 +28,7 @@ func (server *Server) createAccount(ctx *gin.Context) {
 	}
 
 	arg := accountController.CreateAccountParams{
-		Owner:    req.Owner,
+		Owner:    authUsername(ctx),
 		Currency: req.Currency,
 		Balance:  0,
 	}
@@ -48,7 +55,7 @@ func (server *Server) getAccount(ctx *gin.Context) {
 
 	account, err := accountController.GetAccountByID(ctx, server.db, req.ID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, sql.ErrNoRows) {
 			ctx.JSON(http.StatusNotFound, errorResponse(err))
 			return
 		}
@@ -56,9 +63,60 @@ func (server *Server) getAccount(ctx *gin.Context) {
 		return
 	}
 
+	if !authRole(ctx).Can(rbac.ReadAllAccounts) && account.Owner != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errAccountNotOwned))
+		return
+	}
+
 	ctx.JSON(http.StatusOK, account)
 }
 
+type getBalanceAtRequest struct {
+	At time.Time `form:"at" binding:"required" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// getBalanceAt answers what the balance of an account was at a point in
+// time, computed from its entries.
+func (server *Server) getBalanceAt(ctx *gin.Context) {
+	var uri getAccountRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req getBalanceAtRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if req.At.After(time.Now()) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errAtInFuture))
+		return
+	}
+
+	account, err := accountController.GetAccountByID(ctx, server.db, uri.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !authRole(ctx).Can(rbac.ReadAllAccounts) && account.Owner != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errAccountNotOwned))
+		return
+	}
+
+	balance, err := accountController.GetBalanceAt(ctx, server.db, account.Id, req.At)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, balance)
+}
+
 type getAccountAllRequest struct {
 	PageID   int32 `form:"page_id" binding:"required,min=1"`
 	PageSize int32 `form:"page_size" binding:"required,min=5,max=10"`
@@ -75,9 +133,13 @@ func (server *Server) getAccountAll(ctx *gin.Context) {
 		Limit:  req.PageSize,
 		Offset: (req.PageID - 1) * req.PageSize,
 	}
+	if !authRole(ctx).Can(rbac.ReadAllAccounts) {
+		args.Owner = authUsername(ctx)
+	}
+
 	accounts, err := accountController.GetAccountAll(ctx, server.db, args)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, sql.ErrNoRows) {
 			ctx.JSON(http.StatusNotFound, errorResponse(err))
 			return
 		}
@@ -87,3 +149,118 @@ func (server *Server) getAccountAll(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, accounts)
 }
+
+type updateAccountStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=active frozen closed"`
+}
+
+func (server *Server) updateAccountStatus(ctx *gin.Context) {
+	var uri getAccountRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req updateAccountStatusRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	account, err := accountController.UpdateAccountStatus(ctx, server.db, accountController.UpdateAccountStatusParams{
+		Id:     uri.ID,
+		Status: req.Status,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, account)
+}
+
+type updateAccountTierRequest struct {
+	Tier string `json:"tier" binding:"required,oneof=standard premium business"`
+}
+
+func (server *Server) updateAccountTier(ctx *gin.Context) {
+	var uri getAccountRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req updateAccountTierRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	account, err := accountController.UpdateAccountTier(ctx, server.db, accountController.UpdateAccountTierParams{
+		Id:   uri.ID,
+		Tier: req.Tier,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, account)
+}
+
+type grantOverdraftRequest struct {
+	OverdraftLimit int64 `json:"overdraft_limit" binding:"required,gt=0"`
+}
+
+func (server *Server) grantOverdraft(ctx *gin.Context) {
+	var uri getAccountRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req grantOverdraftRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	server.setOverdraftLimit(ctx, uri.ID, req.OverdraftLimit)
+}
+
+// revokeOverdraft sets the limit back to 0. An account already overdrawn
+// stays so, it just can't be debited further.
+func (server *Server) revokeOverdraft(ctx *gin.Context) {
+	var uri getAccountRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	server.setOverdraftLimit(ctx, uri.ID, 0)
+}
+
+func (server *Server) setOverdraftLimit(ctx *gin.Context, accountID int64, limit int64) {
+	account, err := accountController.UpdateOverdraftLimit(ctx, server.db, accountController.UpdateOverdraftLimitParams{
+		Id:             accountID,
+		OverdraftLimit: limit,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, account)
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	apiKeyController "simplebank/pkg/controllers/apikey"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+	"simplebank/pkg/rbac"
+	"simplebank/pkg/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// API keys look like sb_<prefix>_<secret>. The prefix identifies the key and
+// is shown in listings, the secret is only returned when the key is created
+// or rotated.
+const (
+	apiKeyTag          = "sb"
+	apiKeyPrefixLength = 8
+	apiKeySecretLength = 32
+)
+
+var (
+	errInvalidAPIKey  = errors.New("api key is invalid")
+	errAPIKeyNotOwned = errors.New("api key doesn't belong to the authenticated user")
+	errInvalidExpiry  = errors.New("expires_at must be in the future")
+)
+
+// newAPIKey generates a key and returns it with its prefix and the hash of
+// its secret.
+func newAPIKey() (key string, prefix string, secretHash string, err error) {
+	prefix, err = util.SecureRandomString(apiKeyPrefixLength)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	secret, err := util.SecureRandomString(apiKeySecretLength)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	key = strings.Join([]string{apiKeyTag, prefix, secret}, "_")
+	return key, prefix, util.HashToken(secret), nil
+}
+
+// verifyAPIKey returns the stored key matching the presented one. Any key
+// that is unknown, wrong, revoked or expired yields errInvalidAPIKey.
+func (server *Server) verifyAPIKey(ctx *gin.Context, presented string) (*models.APIKey, error) {
+	parts := strings.Split(presented, "_")
+	if len(parts) != 3 || parts[0] != apiKeyTag {
+		return nil, errInvalidAPIKey
+	}
+
+	key, err := apiKeyController.GetAPIKeyByPrefix(ctx, server.db, parts[1])
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	secretHash := util.HashToken(parts[2])
+	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(key.SecretHash)) != 1 {
+		return nil, errInvalidAPIKey
+	}
+	if !apiKeyController.IsUsable(key, time.Now()) {
+		return nil, errInvalidAPIKey
+	}
+
+	// failing to record the usage shouldn't fail the request
+	if err := apiKeyController.TouchAPIKey(ctx, server.db, key.Id); err != nil {
+		logger.FromContext(ctx).Warn("cannot record api key usage", "key_id", key.Id, "error", err)
+	}
+
+	return key, nil
+}
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=64"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=accounts:read accounts:write transfers:write cash:write audit:read"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type apiKeyResponse struct {
+	Key    string         `json:"key"`
+	APIKey *models.APIKey `json:"api_key"`
+}
+
+func (server *Server) createAPIKey(ctx *gin.Context) {
+	var req createAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidExpiry))
+		return
+	}
+
+	key, prefix, secretHash, err := newAPIKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	apiKey, err := apiKeyController.CreateAPIKey(ctx, server.db, apiKeyController.CreateAPIKeyParams{
+		Username:   authUsername(ctx),
+		Name:       req.Name,
+		Prefix:     prefix,
+		SecretHash: secretHash,
+		Scopes:     req.Scopes,
+		ExpiresAt:  req.ExpiresAt,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, apiKeyResponse{Key: key, APIKey: apiKey})
+}
+
+func (server *Server) listAPIKeys(ctx *gin.Context) {
+	keys, err := apiKeyController.ListAPIKeys(ctx, server.db, authUsername(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, keys)
+}
+
+type apiKeyIDRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// rotateAPIKey replaces one of the user's keys with a new secret. The old
+// key stops working immediately.
+func (server *Server) rotateAPIKey(ctx *gin.Context) {
+	var req apiKeyIDRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if !server.ownedAPIKey(ctx, req.ID, false) {
+		return
+	}
+
+	key, prefix, secretHash, err := newAPIKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	apiKey, err := apiKeyController.RotateAPIKey(ctx, server.db, apiKeyController.RotateAPIKeyParams{
+		Id:         req.ID,
+		Prefix:     prefix,
+		SecretHash: secretHash,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, apiKeyResponse{Key: key, APIKey: apiKey})
+}
+
+// revokeAPIKey revokes one of the user's keys. Admins can revoke any key.
+func (server *Server) revokeAPIKey(ctx *gin.Context) {
+	var req apiKeyIDRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if !server.ownedAPIKey(ctx, req.ID, authRole(ctx).Can(rbac.ManageUsers)) {
+		return
+	}
+
+	apiKey, err := apiKeyController.RevokeAPIKey(ctx, server.db, req.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, apiKey)
+}
+
+// ownedAPIKey checks the key exists and belongs to the authenticated user
+// unless anyUser is set, writing the error response itself when not.
+func (server *Server) ownedAPIKey(ctx *gin.Context, id int64, anyUser bool) bool {
+	apiKey, err := apiKeyController.GetAPIKey(ctx, server.db, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return false
+	}
+
+	if !anyUser && apiKey.Username != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errAPIKeyNotOwned))
+		return false
+	}
+
+	return true
+}
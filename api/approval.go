@@ -0,0 +1,187 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/rbac"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+var errTransferApprovalNotOwned = errors.New("transfer approval wasn't initiated by the authenticated user")
+
+// requestTransferApproval holds the funds of a transfer above the approval
+// threshold and answers 202, the transfer is made once approved.
+func (server *Server) requestTransferApproval(ctx *gin.Context, req transferRequest) {
+	approval, err := transferController.RequestTransferApproval(ctx, server.db, transferController.RequestTransferApprovalParams{
+		Initiator:     authUsername(ctx),
+		FromAccountID: req.FromAccountID,
+		ToAccountID:   req.ToAccountID,
+		Amount:        req.Amount,
+		ExpiresAt:     time.Now().Add(server.config.TransferApprovalDuration),
+	})
+	if err != nil {
+		server.transferApprovalError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, approval)
+}
+
+// withinApprovalThreshold rejects amount with 422 when it needs an approval
+// but goes through a kind of transfer that can't wait for one: holds,
+// scheduled transfers and FX transfers at a quoted rate.
+func (server *Server) withinApprovalThreshold(ctx *gin.Context, amount int64) bool {
+	threshold := server.config.TransferApprovalThreshold
+	if threshold <= 0 || amount <= threshold {
+		return true
+	}
+
+	err := fmt.Errorf("transfers above %d need approval, make them with POST /transfers", threshold)
+	ctx.JSON(http.StatusUnprocessableEntity, errorResponse(err))
+	return false
+}
+
+type transferApprovalURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// getTransferApproval shows a request to its initiator and to approvers.
+func (server *Server) getTransferApproval(ctx *gin.Context) {
+	var uri transferApprovalURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	approval, err := transferController.GetTransferApproval(ctx, server.db, uri.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !authRole(ctx).Can(rbac.ApproveTransfers) && approval.Initiator != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errTransferApprovalNotOwned))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, approval)
+}
+
+type listTransferApprovalsRequest struct {
+	Status    string `form:"status" binding:"omitempty,oneof=pending_approval approved rejected expired"`
+	Initiator string `form:"initiator"`
+	PageID    int32  `form:"page_id" binding:"required,min=1"`
+	PageSize  int32  `form:"page_size" binding:"required,min=5,max=50"`
+}
+
+func (server *Server) listTransferApprovals(ctx *gin.Context) {
+	var req listTransferApprovalsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	approvals, err := transferController.ListTransferApprovals(ctx, server.db, transferController.ListTransferApprovalsParams{
+		Status:    req.Status,
+		Initiator: req.Initiator,
+		Limit:     req.PageSize,
+		Offset:    (req.PageID - 1) * req.PageSize,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, approvals)
+}
+
+type decideTransferRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+type rejectTransferRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+func (server *Server) approveTransfer(ctx *gin.Context) {
+	var uri transferApprovalURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// the reason is optional when approving
+	var req decideTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	result, err := transferController.ApproveTransfer(ctx, server.db, transferController.DecideTransferParams{
+		ApprovalID: uri.ID,
+		Approver:   authUsername(ctx),
+		Reason:     req.Reason,
+	})
+	if err != nil {
+		server.transferApprovalError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (server *Server) rejectTransfer(ctx *gin.Context) {
+	var uri transferApprovalURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req rejectTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	approval, err := transferController.RejectTransfer(ctx, server.db, transferController.DecideTransferParams{
+		ApprovalID: uri.ID,
+		Approver:   authUsername(ctx),
+		Reason:     req.Reason,
+	})
+	if err != nil {
+		server.transferApprovalError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, approval)
+}
+
+func (server *Server) transferApprovalError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		ctx.JSON(http.StatusNotFound, errorResponse(err))
+	case errors.Is(err, transferController.ErrSelfApproval):
+		ctx.JSON(http.StatusForbidden, errorResponse(err))
+	case errors.Is(err, transferController.ErrApprovalNotPending),
+		errors.Is(err, transferController.ErrHoldNotAuthorized):
+		ctx.JSON(http.StatusConflict, errorResponse(err))
+	case errors.Is(err, transferController.ErrAccountNotActive),
+		errors.Is(err, transferController.ErrNotCustomerAccount),
+		errors.Is(err, transferController.ErrCurrencyMismatch),
+		errors.Is(err, transferController.ErrInsufficientFunds),
+		errors.Is(err, transferController.ErrLimitExceeded):
+		ctx.JSON(http.StatusUnprocessableEntity, errorResponse(err))
+	default:
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+	}
+}
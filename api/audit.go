@@ -0,0 +1,48 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	auditController "simplebank/pkg/controllers/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+type listAuditEventsRequest struct {
+	Actor      string    `form:"actor"`
+	Action     string    `form:"action"`
+	EntityType string    `form:"entity_type"`
+	EntityID   string    `form:"entity_id"`
+	From       time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To         time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	PageID     int32     `form:"page_id" binding:"required,min=1"`
+	PageSize   int32     `form:"page_size" binding:"required,min=5,max=100"`
+}
+
+func (server *Server) listAuditEvents(ctx *gin.Context) {
+	var req listAuditEventsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	args := auditController.ListAuditEventParams{
+		Actor:      req.Actor,
+		Action:     req.Action,
+		EntityType: req.EntityType,
+		EntityID:   req.EntityID,
+		From:       sql.NullTime{Time: req.From, Valid: !req.From.IsZero()},
+		To:         sql.NullTime{Time: req.To, Valid: !req.To.IsZero()},
+		Limit:      req.PageSize,
+		Offset:     (req.PageID - 1) * req.PageSize,
+	}
+	events, err := auditController.ListAuditEvents(ctx, server.db, args)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, events)
+}
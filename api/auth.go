@@ -0,0 +1,187 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	oauthController "simplebank/pkg/controllers/oauth"
+	userController "simplebank/pkg/controllers/user"
+	"simplebank/pkg/rbac"
+	"simplebank/pkg/reqmeta"
+	"simplebank/pkg/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	authorizationHeaderKey   = "authorization"
+	authorizationTypeBearer  = "bearer"
+	authorizationTypeAPIKey  = "apikey"
+	authorizationPayloadKey  = "authorization_payload"
+	authorizationUsernameKey = "authorization_username"
+	authorizationRoleKey     = "authorization_role"
+	authorizationScopesKey   = "authorization_scopes"
+)
+
+// authMiddleware requires a valid bearer token or API key and records the
+// authenticated user as the actor of the request.
+func (server *Server) authMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
+		if len(authorizationHeader) == 0 {
+			err := errors.New("authorization header is not provided")
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+
+		fields := strings.Fields(authorizationHeader)
+		if len(fields) < 2 {
+			err := errors.New("invalid authorization header format")
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+
+		var username string
+		switch authorizationType := strings.ToLower(fields[0]); authorizationType {
+		case authorizationTypeBearer:
+			payload, err := server.tokenMaker.VerifyToken(fields[1])
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+				return
+			}
+			switch payload.Purpose {
+			case token.PurposeAccess:
+			case token.PurposeOAuth:
+				active, err := oauthController.IsAccessTokenActive(ctx, server.db, payload.ID, payload.Username, payload.ClientID)
+				if err != nil {
+					ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+					return
+				}
+				if !active {
+					ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(token.ErrInvalidToken))
+					return
+				}
+				ctx.Set(authorizationScopesKey, scopesFrom(payload.Scopes))
+			default:
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(token.ErrInvalidToken))
+				return
+			}
+
+			username = payload.Username
+			ctx.Set(authorizationPayloadKey, payload)
+		case authorizationTypeAPIKey:
+			key, err := server.verifyAPIKey(ctx, fields[1])
+			if err != nil {
+				if errors.Is(err, errInvalidAPIKey) {
+					ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+					return
+				}
+				ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+				return
+			}
+
+			username = key.Username
+			ctx.Set(authorizationScopesKey, scopesFrom(key.Scopes))
+		default:
+			err := fmt.Errorf("unsupported authorization type %s", authorizationType)
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+
+		// the role is read on every request so that role changes and
+		// removals take effect without waiting for tokens to expire
+		user, err := userController.GetUser(ctx, server.db, username)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(token.ErrInvalidToken))
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		// a password reset ends every session opened before it
+		if payload, ok := ctx.Get(authorizationPayloadKey); ok && payload.(*token.Payload).IssuedAt.Before(user.PasswordChangedAt) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(token.ErrInvalidToken))
+			return
+		}
+
+		setActor(ctx, username)
+		ctx.Set(authorizationUsernameKey, username)
+		ctx.Set(authorizationRoleKey, rbac.Role(user.Role))
+		ctx.Next()
+	}
+}
+
+// requirePermission only lets the request through when the role of the
+// authenticated user grants permission, and for API keys when one of the
+// key's scopes does too.
+func requirePermission(permission rbac.Permission) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !authRole(ctx).Can(permission) || !scopesGrant(ctx, permission) {
+			err := fmt.Errorf("permission %s required", permission)
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// requireAccessToken rejects requests authenticated with an API key or an
+// OAuth token, for the routes that manage credentials and consents and need
+// an interactive login.
+func requireAccessToken() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, scoped := ctx.Get(authorizationScopesKey); scoped {
+			err := errors.New("this endpoint needs an interactive login")
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func scopesFrom(values []string) []rbac.Scope {
+	scopes := make([]rbac.Scope, len(values))
+	for i, value := range values {
+		scopes[i] = rbac.Scope(value)
+	}
+	return scopes
+}
+
+func scopesGrant(ctx *gin.Context, permission rbac.Permission) bool {
+	value, ok := ctx.Get(authorizationScopesKey)
+	if !ok {
+		// access tokens from an interactive login aren't scoped
+		return true
+	}
+
+	for _, scope := range value.([]rbac.Scope) {
+		if scope.Grants(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// setActor replaces the anonymous actor of the request metadata.
+func setActor(ctx *gin.Context, username string) {
+	meta := reqmeta.From(ctx.Request.Context())
+	meta.Actor = username
+	ctx.Request = ctx.Request.WithContext(reqmeta.With(ctx.Request.Context(), meta))
+}
+
+func authUsername(ctx *gin.Context) string {
+	return ctx.MustGet(authorizationUsernameKey).(string)
+}
+
+func authRole(ctx *gin.Context) rbac.Role {
+	role, _ := ctx.Get(authorizationRoleKey)
+	r, _ := role.(rbac.Role)
+	return r
+}
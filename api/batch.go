@@ -0,0 +1,126 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/models"
+	"simplebank/pkg/rbac"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+var errTransferBatchNotOwned = errors.New("transfer batch doesn't belong to the authenticated user")
+
+type batchItemRequest struct {
+	FromAccountID int64 `json:"from_account_id" binding:"required,min=1"`
+	ToAccountID   int64 `json:"to_account_id" binding:"required,min=1,nefield=FromAccountID"`
+	Amount        int64 `json:"amount" binding:"required,gt=0"`
+}
+
+type createTransferBatchRequest struct {
+	Mode     string `json:"mode" binding:"required,oneof=atomic best_effort"`
+	Currency string `json:"currency" binding:"required,oneof=USD EUR"`
+	// Transfers is bounded as the batch is made while the request waits.
+	Transfers []batchItemRequest `json:"transfers" binding:"required,min=1,max=1000,dive"`
+	// TOTPCode is required when the total of the batch is above the
+	// configured threshold.
+	TOTPCode string `json:"totp_code"`
+}
+
+// createTransferBatch makes a list of transfers from accounts of the user,
+// all of them or none in atomic mode, each that can be in best effort mode.
+// The batch is answered with the outcome of every transfer.
+func (server *Server) createTransferBatch(ctx *gin.Context) {
+	var req createTransferBatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	items := make([]transferController.TransferBatchItemParams, len(req.Transfers))
+	// accounts caches the validation of the accounts named several times,
+	// ownership is checked on every item
+	accounts := make(map[int64]*models.Account)
+	var total int64
+	for i, transfer := range req.Transfers {
+		if !server.withinApprovalThreshold(ctx, transfer.Amount) {
+			return
+		}
+
+		for _, accountID := range []int64{transfer.FromAccountID, transfer.ToAccountID} {
+			if _, ok := accounts[accountID]; ok {
+				continue
+			}
+			account, valid := server.validAccount(ctx, accountID, req.Currency)
+			if !valid {
+				return
+			}
+			accounts[accountID] = account
+		}
+
+		if accounts[transfer.FromAccountID].Owner != authUsername(ctx) {
+			ctx.JSON(http.StatusForbidden, errorResponse(errAccountNotOwned))
+			return
+		}
+
+		items[i] = transferController.TransferBatchItemParams{
+			FromAccountID: transfer.FromAccountID,
+			ToAccountID:   transfer.ToAccountID,
+			Amount:        transfer.Amount,
+		}
+		total += transfer.Amount
+	}
+
+	if !server.freshSecondFactor(ctx, total, req.TOTPCode) {
+		return
+	}
+
+	result, err := transferController.CreateTransferBatch(ctx, server.db, transferController.CreateTransferBatchParams{
+		Owner: authUsername(ctx),
+		Mode:  req.Mode,
+		Items: items,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+type transferBatchURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+func (server *Server) getTransferBatch(ctx *gin.Context) {
+	var uri transferBatchURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	batch, err := transferController.GetTransferBatch(ctx, server.db, uri.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !authRole(ctx).Can(rbac.ReadAllAccounts) && batch.Owner != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errTransferBatchNotOwned))
+		return
+	}
+
+	items, err := transferController.ListTransferBatchItems(ctx, server.db, batch.Id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, transferController.TransferBatchResult{Batch: batch, Items: items})
+}
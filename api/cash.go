@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"simplebank/pkg/connection"
+	transferController "simplebank/pkg/controllers/transfer"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type cashRequest struct {
+	AccountID int64  `json:"account_id" binding:"required,min=1"`
+	Amount    int64  `json:"amount" binding:"required,gt=0"`
+	Currency  string `json:"currency" binding:"required,oneof=USD EUR"`
+}
+
+// createDeposit posts cash paid in at a counter. Tellers can post on any
+// customer account.
+func (server *Server) createDeposit(ctx *gin.Context) {
+	server.postCash(ctx, transferController.DepositTx)
+}
+
+// createWithdrawal posts cash paid out at a counter.
+func (server *Server) createWithdrawal(ctx *gin.Context) {
+	server.postCash(ctx, transferController.WithdrawTx)
+}
+
+func (server *Server) postCash(ctx *gin.Context, post func(context.Context, connection.DBTX, transferController.CashTxParams) (*transferController.CashTxResult, error)) {
+	var req cashRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if _, valid := server.validAccount(ctx, req.AccountID, req.Currency); !valid {
+		return
+	}
+
+	result, err := post(ctx, server.db, transferController.CashTxParams{
+		AccountID: req.AccountID,
+		Amount:    req.Amount,
+	})
+	if err != nil {
+		if errors.Is(err, transferController.ErrAccountNotActive) ||
+			errors.Is(err, transferController.ErrNotCustomerAccount) ||
+			errors.Is(err, transferController.ErrInsufficientFunds) {
+			ctx.JSON(http.StatusUnprocessableEntity, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
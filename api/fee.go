@@ -0,0 +1,123 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	accountController "simplebank/pkg/controllers/account"
+	feeController "simplebank/pkg/controllers/fee"
+	transferController "simplebank/pkg/controllers/transfer"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type previewFeeRequest struct {
+	FromAccountID int64 `form:"from_account_id" binding:"required,min=1"`
+	Amount        int64 `form:"amount" binding:"required,gt=0"`
+}
+
+// previewFee shows the fee a transfer would be charged.
+func (server *Server) previewFee(ctx *gin.Context) {
+	var req previewFeeRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	account, err := accountController.GetAccountByID(ctx, server.db, req.FromAccountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if account.Owner != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errAccountNotOwned))
+		return
+	}
+
+	preview, err := transferController.PreviewFee(ctx, server.db, transferController.TransferTxParams{
+		FromAccountID: req.FromAccountID,
+		Amount:        req.Amount,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, preview)
+}
+
+func (server *Server) listFeeRules(ctx *gin.Context) {
+	rules, err := feeController.ListFeeRules(ctx, server.db)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rules)
+}
+
+type createFeeRuleRequest struct {
+	// Currency and Tier restrict the rule, it matches every currency or
+	// tier when they are left out.
+	Currency   *string `json:"currency" binding:"omitempty,oneof=USD EUR"`
+	Tier       *string `json:"tier" binding:"omitempty,oneof=standard premium business"`
+	MinAmount  int64   `json:"min_amount" binding:"min=0"`
+	FlatFee    int64   `json:"flat_fee" binding:"min=0"`
+	PercentBps int64   `json:"percent_bps" binding:"min=0,max=9999"`
+	MinFee     int64   `json:"min_fee" binding:"min=0"`
+	MaxFee     *int64  `json:"max_fee" binding:"omitempty,gtefield=MinFee"`
+	Waived     bool    `json:"waived"`
+}
+
+func (server *Server) createFeeRule(ctx *gin.Context) {
+	var req createFeeRuleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	rule, err := feeController.CreateFeeRule(ctx, server.db, feeController.CreateFeeRuleParams{
+		Currency:   req.Currency,
+		Tier:       req.Tier,
+		MinAmount:  req.MinAmount,
+		FlatFee:    req.FlatFee,
+		PercentBps: req.PercentBps,
+		MinFee:     req.MinFee,
+		MaxFee:     req.MaxFee,
+		Waived:     req.Waived,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rule)
+}
+
+type deleteFeeRuleRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+func (server *Server) deleteFeeRule(ctx *gin.Context) {
+	var req deleteFeeRuleRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	err := feeController.DeleteFeeRule(ctx, server.db, req.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
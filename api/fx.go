@@ -0,0 +1,227 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	fxController "simplebank/pkg/controllers/fx"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/fx"
+	"simplebank/pkg/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const quoteIDLength = 24
+
+func (server *Server) listExchangeRates(ctx *gin.Context) {
+	rates, err := fxController.ListExchangeRates(ctx, server.db, time.Now())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rates)
+}
+
+type createExchangeRateRequest struct {
+	BaseCurrency  string `json:"base_currency" binding:"required,oneof=USD EUR"`
+	QuoteCurrency string `json:"quote_currency" binding:"required,oneof=USD EUR,nefield=BaseCurrency"`
+	// Rate is a decimal string, floats would lose precision.
+	Rate string `json:"rate" binding:"required"`
+	// EffectiveAt defaults to now.
+	EffectiveAt *time.Time `json:"effective_at"`
+}
+
+func (server *Server) createExchangeRate(ctx *gin.Context) {
+	var req createExchangeRateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if _, err := fx.ParseRate(req.Rate); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	effectiveAt := time.Now()
+	if req.EffectiveAt != nil {
+		effectiveAt = *req.EffectiveAt
+	}
+
+	rate, err := fxController.CreateExchangeRate(ctx, server.db, fxController.CreateExchangeRateParams{
+		BaseCurrency:  req.BaseCurrency,
+		QuoteCurrency: req.QuoteCurrency,
+		Rate:          req.Rate,
+		EffectiveAt:   effectiveAt,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rate)
+}
+
+type createQuoteRequest struct {
+	FromCurrency string `json:"from_currency" binding:"required,oneof=USD EUR"`
+	ToCurrency   string `json:"to_currency" binding:"required,oneof=USD EUR,nefield=FromCurrency"`
+	Amount       int64  `json:"amount" binding:"required,gt=0"`
+}
+
+// createQuote locks the current rate for FXQuoteDuration. The quote ID is
+// then passed to createFXTransfer.
+func (server *Server) createQuote(ctx *gin.Context) {
+	var req createQuoteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	rate, err := fxController.GetExchangeRate(ctx, server.db, req.FromCurrency, req.ToCurrency, time.Now())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusUnprocessableEntity, errorResponse(errors.Errorf("no rate from %s to %s", req.FromCurrency, req.ToCurrency)))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	toAmount, err := fx.Convert(req.Amount, rate.Rate, server.config.FXSpreadBps)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if toAmount <= 0 {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("amount is too small to exchange")))
+		return
+	}
+
+	id, err := util.SecureRandomString(quoteIDLength)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	quote, err := fxController.CreateQuote(ctx, server.db, fxController.CreateQuoteParams{
+		Id:           id,
+		Username:     authUsername(ctx),
+		FromCurrency: req.FromCurrency,
+		ToCurrency:   req.ToCurrency,
+		FromAmount:   req.Amount,
+		ToAmount:     toAmount,
+		Rate:         rate.Rate,
+		SpreadBps:    server.config.FXSpreadBps,
+		ExpiresAt:    time.Now().Add(server.config.FXQuoteDuration),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, quote)
+}
+
+type getQuoteRequest struct {
+	Id string `uri:"id" binding:"required"`
+}
+
+func (server *Server) getQuote(ctx *gin.Context) {
+	var req getQuoteRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	quote, err := fxController.GetQuote(ctx, server.db, req.Id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// other users' quotes don't exist as far as the caller can tell
+	if quote.Username != authUsername(ctx) {
+		ctx.JSON(http.StatusNotFound, errorResponse(sql.ErrNoRows))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, quote)
+}
+
+type fxTransferRequest struct {
+	FromAccountID int64  `json:"from_account_id" binding:"required,min=1"`
+	ToAccountID   int64  `json:"to_account_id" binding:"required,min=1,nefield=FromAccountID"`
+	QuoteID       string `json:"quote_id" binding:"required"`
+	// TOTPCode is required when the quoted amount is above the configured
+	// threshold.
+	TOTPCode string `json:"totp_code"`
+}
+
+func (server *Server) createFXTransfer(ctx *gin.Context) {
+	var req fxTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	quote, err := fxController.GetQuote(ctx, server.db, req.QuoteID)
+	if err != nil || quote.Username != authUsername(ctx) {
+		if err == nil || errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusUnprocessableEntity, errorResponse(fxController.ErrQuoteUnavailable))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	fromAccount, valid := server.validAccount(ctx, req.FromAccountID, quote.FromCurrency)
+	if !valid {
+		return
+	}
+	if fromAccount.Owner != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errAccountNotOwned))
+		return
+	}
+
+	_, valid = server.validAccount(ctx, req.ToAccountID, quote.ToCurrency)
+	if !valid {
+		return
+	}
+
+	if !server.withinApprovalThreshold(ctx, quote.FromAmount) {
+		return
+	}
+
+	if !server.freshSecondFactor(ctx, quote.FromAmount, req.TOTPCode) {
+		return
+	}
+
+	result, err := transferController.FXTransferTx(ctx, server.db, transferController.FXTransferTxParams{
+		FromAccountID: req.FromAccountID,
+		ToAccountID:   req.ToAccountID,
+		QuoteID:       req.QuoteID,
+		Username:      authUsername(ctx),
+	})
+	if err != nil {
+		if errors.Is(err, fxController.ErrQuoteUnavailable) ||
+			errors.Is(err, transferController.ErrAccountNotActive) ||
+			errors.Is(err, transferController.ErrNotCustomerAccount) ||
+			errors.Is(err, transferController.ErrCurrencyMismatch) ||
+			errors.Is(err, transferController.ErrLimitExceeded) ||
+			errors.Is(err, transferController.ErrInsufficientFunds) {
+			ctx.JSON(http.StatusUnprocessableEntity, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"simplebank/pkg/connection"
+
+	"github.com/gin-gonic/gin"
+)
+
+const readinessTimeout = 2 * time.Second
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+type componentStatus struct {
+	Status string      `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Detail interface{} `json:"detail,omitempty"`
+}
+
+type healthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentStatus `json:"components,omitempty"`
+}
+
+// healthz reports that the process is alive and serving requests.
+func (server *Server) healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, healthResponse{Status: statusOK})
+}
+
+// readyz reports whether the server can take traffic: the database answers
+// within readinessTimeout, migrations are at the expected version and the
+// server is not shutting down.
+func (server *Server) readyz(ctx *gin.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	res := healthResponse{
+		Status:     statusOK,
+		Components: map[string]componentStatus{},
+	}
+
+	start := time.Now()
+	database := componentStatus{Status: statusOK}
+	if err := server.db.PingContext(checkCtx); err != nil {
+		database = componentStatus{Status: statusUnavailable, Error: err.Error()}
+	}
+	database.Detail = gin.H{"latency": time.Since(start).String()}
+	res.Components["database"] = database
+
+	migrations := componentStatus{Status: statusOK}
+	version, dirty, err := connection.MigrationVersion(checkCtx, server.db)
+	switch {
+	case err != nil:
+		migrations = componentStatus{Status: statusUnavailable, Error: err.Error()}
+	case dirty || version != connection.SchemaVersion:
+		migrations.Status = statusUnavailable
+		fallthrough
+	default:
+		migrations.Detail = gin.H{"version": version, "expected": connection.SchemaVersion, "dirty": dirty}
+	}
+	res.Components["migrations"] = migrations
+
+	shutdown := componentStatus{Status: statusOK}
+	if server.shuttingDown.Load() {
+		shutdown.Status = statusUnavailable
+	}
+	res.Components["shutdown"] = shutdown
+
+	code := http.StatusOK
+	for _, component := range res.Components {
+		if component.Status != statusOK {
+			res.Status = statusUnavailable
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	ctx.JSON(code, res)
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	accountController "simplebank/pkg/controllers/account"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/models"
+	"simplebank/pkg/rbac"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+var errHoldNotAccessible = errors.New("hold doesn't involve an account of the authenticated user")
+
+type authorizeHoldRequest struct {
+	AccountID   int64  `json:"account_id" binding:"required,min=1"`
+	ToAccountID int64  `json:"to_account_id" binding:"required,min=1,nefield=AccountID"`
+	Amount      int64  `json:"amount" binding:"required,gt=0"`
+	Currency    string `json:"currency" binding:"required,oneof=USD EUR"`
+	// TOTPCode is required when Amount is above the configured threshold.
+	TOTPCode string `json:"totp_code"`
+}
+
+// authorizeHold reserves funds on an account of the user for a later
+// capture by the receiving side.
+func (server *Server) authorizeHold(ctx *gin.Context) {
+	var req authorizeHoldRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if !server.withinApprovalThreshold(ctx, req.Amount) {
+		return
+	}
+
+	account, valid := server.validAccount(ctx, req.AccountID, req.Currency)
+	if !valid {
+		return
+	}
+	if account.Owner != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errAccountNotOwned))
+		return
+	}
+
+	if _, valid = server.validAccount(ctx, req.ToAccountID, req.Currency); !valid {
+		return
+	}
+
+	if !server.freshSecondFactor(ctx, req.Amount, req.TOTPCode) {
+		return
+	}
+
+	hold, err := transferController.AuthorizeHold(ctx, server.db, transferController.AuthorizeHoldParams{
+		AccountID:   req.AccountID,
+		ToAccountID: req.ToAccountID,
+		Amount:      req.Amount,
+		ExpiresAt:   time.Now().Add(server.config.HoldDuration),
+	})
+	if err != nil {
+		server.holdError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, hold)
+}
+
+type holdURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+func (server *Server) getHold(ctx *gin.Context) {
+	hold, ok := server.accessibleHold(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, hold)
+}
+
+type captureHoldRequest struct {
+	// Amount defaults to the whole hold.
+	Amount int64 `json:"amount" binding:"min=0"`
+}
+
+func (server *Server) captureHold(ctx *gin.Context) {
+	hold, ok := server.accessibleHold(ctx)
+	if !ok {
+		return
+	}
+
+	// an empty body captures the whole hold
+	var req captureHoldRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	result, err := transferController.CaptureHold(ctx, server.db, transferController.CaptureHoldParams{
+		HoldID: hold.Id,
+		Amount: req.Amount,
+	})
+	if err != nil {
+		server.holdError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (server *Server) voidHold(ctx *gin.Context) {
+	hold, ok := server.accessibleHold(ctx)
+	if !ok {
+		return
+	}
+
+	hold, err := transferController.VoidHold(ctx, server.db, hold.Id)
+	if err != nil {
+		server.holdError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, hold)
+}
+
+func (server *Server) listAccountHolds(ctx *gin.Context) {
+	var req getAccountRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	account, err := accountController.GetAccountByID(ctx, server.db, req.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !authRole(ctx).Can(rbac.ReadAllAccounts) && account.Owner != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errAccountNotOwned))
+		return
+	}
+
+	holds, err := transferController.ListHolds(ctx, server.db, account.Id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, holds)
+}
+
+// accessibleHold loads the hold in the URI and checks the user owns one of
+// its two accounts, writing the error response itself when not.
+func (server *Server) accessibleHold(ctx *gin.Context) (*models.Hold, bool) {
+	var uri holdURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return nil, false
+	}
+
+	hold, err := transferController.GetHold(ctx, server.db, uri.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return nil, false
+	}
+
+	for _, accountID := range []int64{hold.AccountID, hold.ToAccountID} {
+		account, err := accountController.GetAccountByID(ctx, server.db, accountID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return nil, false
+		}
+		if account.Owner == authUsername(ctx) {
+			return hold, true
+		}
+	}
+
+	ctx.JSON(http.StatusForbidden, errorResponse(errHoldNotAccessible))
+	return nil, false
+}
+
+func (server *Server) holdError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, transferController.ErrHoldNotAuthorized),
+		errors.Is(err, transferController.ErrHoldPendingApproval):
+		ctx.JSON(http.StatusConflict, errorResponse(err))
+	case errors.Is(err, transferController.ErrCaptureExceedsHold),
+		errors.Is(err, transferController.ErrAccountNotActive),
+		errors.Is(err, transferController.ErrNotCustomerAccount),
+		errors.Is(err, transferController.ErrCurrencyMismatch),
+		errors.Is(err, transferController.ErrInsufficientFunds),
+		errors.Is(err, transferController.ErrLimitExceeded):
+		ctx.JSON(http.StatusUnprocessableEntity, errorResponse(err))
+	default:
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+	}
+}
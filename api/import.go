@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	importController "simplebank/pkg/controllers/imports"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// maxImportSize bounds the files accepted by importData.
+const maxImportSize = 64 << 20
+
+type importURI struct {
+	Kind string `uri:"kind" binding:"required,oneof=accounts transfers"`
+}
+
+type importQuery struct {
+	DryRun    bool `form:"dry_run"`
+	ChunkSize int  `form:"chunk_size" binding:"omitempty,min=1,max=5000"`
+}
+
+// importData loads the CSV file in the body, accounts or transfers as the
+// URI says. The response reports the rows that failed with their line, with
+// dry_run nothing is loaded.
+func (server *Server) importData(ctx *gin.Context) {
+	var uri importURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var query importQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	load := importController.ImportAccounts
+	if uri.Kind == importController.KindTransfers {
+		load = importController.ImportTransfers
+	}
+
+	body := http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportSize)
+	report, err := load(ctx, server.db, body, importController.ImportParams{
+		DryRun:    query.DryRun,
+		ChunkSize: query.ChunkSize,
+	})
+	if err != nil {
+		server.importError(ctx, report, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// importError answers a failed import with what was loaded before it
+// stopped, so the file can be fixed and resumed.
+func (server *Server) importError(ctx *gin.Context, report *importController.ImportReport, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, importController.ErrInvalidImport):
+		ctx.JSON(http.StatusUnprocessableEntity, errorResponse(err))
+	case errors.As(err, &tooLarge):
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"err": err.Error(), "report": report})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"err": err.Error(), "report": report})
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	accountController "simplebank/pkg/controllers/account"
+	limitController "simplebank/pkg/controllers/limit"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/rbac"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// getAllowance shows the transfer limits of an account and how much of them
+// is left.
+func (server *Server) getAllowance(ctx *gin.Context) {
+	var req getAccountRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	account, err := accountController.GetAccountByID(ctx, server.db, req.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !authRole(ctx).Can(rbac.ReadAllAccounts) && account.Owner != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errAccountNotOwned))
+		return
+	}
+
+	allowance, err := transferController.GetAllowance(ctx, server.db, account.Id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, allowance)
+}
+
+func (server *Server) listTransferLimits(ctx *gin.Context) {
+	limits, err := limitController.ListTransferLimits(ctx, server.db)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, limits)
+}
+
+type setTransferLimitRequest struct {
+	Currency string `json:"currency" binding:"required,oneof=USD EUR"`
+	Tier     string `json:"tier" binding:"required,oneof=standard premium business"`
+	// A limit left out is lifted.
+	MaxTransfer  *int64 `json:"max_transfer" binding:"omitempty,gt=0"`
+	DailyLimit   *int64 `json:"daily_limit" binding:"omitempty,gt=0"`
+	MonthlyLimit *int64 `json:"monthly_limit" binding:"omitempty,gt=0"`
+}
+
+func (server *Server) setTransferLimit(ctx *gin.Context) {
+	var req setTransferLimitRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	limit, err := limitController.SetTransferLimit(ctx, server.db, limitController.SetTransferLimitParams{
+		Currency:     req.Currency,
+		Tier:         req.Tier,
+		MaxTransfer:  req.MaxTransfer,
+		DailyLimit:   req.DailyLimit,
+		MonthlyLimit: req.MonthlyLimit,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, limit)
+}
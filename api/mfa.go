@@ -0,0 +1,250 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	mfaController "simplebank/pkg/controllers/mfa"
+	userController "simplebank/pkg/controllers/user"
+	"simplebank/pkg/metrics"
+	"simplebank/pkg/models"
+	"simplebank/pkg/token"
+	"simplebank/pkg/totp"
+	"simplebank/pkg/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	totpIssuer         = "Simple Bank"
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+var errInvalidSecondFactor = errors.New("invalid two-factor code")
+
+type enrollTOTPResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// enrollTOTP generates a new secret for the authenticated user. It only
+// becomes active once confirmed with confirmTOTP.
+func (server *Server) enrollTOTP(ctx *gin.Context) {
+	user, err := userController.GetUser(ctx, server.db, authUsername(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if user.TOTPEnabled {
+		ctx.JSON(http.StatusConflict, errorResponse(errors.New("two-factor authentication is already enabled")))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	encryptedSecret, err := util.Encrypt(server.config.TOTPEncryptionKey, secret)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = mfaController.SetTOTPSecret(ctx, server.db, user.Username, encryptedSecret)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollTOTPResponse{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.Username, secret),
+	})
+}
+
+type confirmTOTPRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type confirmTOTPResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// confirmTOTP enables two-factor authentication once the user proves their
+// authenticator produces valid codes, and returns the recovery codes. They
+// are only stored hashed so this is the only time they can be shown.
+func (server *Server) confirmTOTP(ctx *gin.Context) {
+	var req confirmTOTPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := userController.GetUser(ctx, server.db, authUsername(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if user.TOTPEnabled {
+		ctx.JSON(http.StatusConflict, errorResponse(errors.New("two-factor authentication is already enabled")))
+		return
+	}
+	if user.TOTPSecret == "" {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("two-factor enrollment has not been started")))
+		return
+	}
+
+	secret, err := util.Decrypt(server.config.TOTPEncryptionKey, user.TOTPSecret)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	step, ok := totp.Validate(secret, req.Code, time.Now())
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidSecondFactor))
+		return
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := util.SecureRandomString(recoveryCodeLength)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		codes[i] = code
+		hashes[i] = util.HashToken(code)
+	}
+
+	err = mfaController.EnableTOTP(ctx, server.db, user.Username, step, hashes)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, confirmTOTPResponse{RecoveryCodes: codes})
+}
+
+type disableTOTPRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (server *Server) disableTOTP(ctx *gin.Context) {
+	var req disableTOTPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := userController.GetUser(ctx, server.db, authUsername(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !user.TOTPEnabled {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("two-factor authentication is not enabled")))
+		return
+	}
+
+	ok, err := server.verifySecondFactor(ctx, user, req.Code, req.RecoveryCode)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidSecondFactor))
+		return
+	}
+
+	err = mfaController.DisableTOTP(ctx, server.db, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+type loginMFARequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// loginMFA completes a login started by loginUser for users with two-factor
+// authentication, exchanging the MFA challenge token and a code for an
+// access token. Wrong codes count as failed logins.
+func (server *Server) loginMFA(ctx *gin.Context) {
+	var req loginMFARequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := server.tokenMaker.VerifyToken(req.MFAToken)
+	if err != nil || payload.Purpose != token.PurposeMFA {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(token.ErrInvalidToken))
+		return
+	}
+
+	user, err := userController.GetUser(ctx, server.db, payload.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(token.ErrInvalidToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if userController.IsLocked(user, time.Now()) {
+		metrics.Logins.WithLabelValues("locked").Inc()
+		server.lockedResponse(ctx, user)
+		return
+	}
+
+	ok, err := server.verifySecondFactor(ctx, user, req.Code, req.RecoveryCode)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !ok {
+		server.failedLogin(ctx, user, errInvalidSecondFactor)
+		return
+	}
+
+	server.completeLogin(ctx, user)
+}
+
+// verifySecondFactor accepts either a current TOTP code that was not used
+// before or an unused recovery code.
+func (server *Server) verifySecondFactor(ctx *gin.Context, user *models.User, code, recoveryCode string) (bool, error) {
+	if !user.TOTPEnabled {
+		return false, nil
+	}
+
+	if recoveryCode != "" {
+		recoveryCode = strings.ToLower(strings.TrimSpace(recoveryCode))
+		return mfaController.ConsumeRecoveryCode(ctx, server.db, user.Username, util.HashToken(recoveryCode))
+	}
+
+	secret, err := util.Decrypt(server.config.TOTPEncryptionKey, user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return mfaController.ConsumeTOTPStep(ctx, server.db, user.Username, step)
+}
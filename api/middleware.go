@@ -0,0 +1,132 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"simplebank/pkg/logger"
+	"simplebank/pkg/metrics"
+	"simplebank/pkg/reqmeta"
+	"simplebank/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	anonymousActor  = "anonymous"
+)
+
+// requestMetaMiddleware stores who is calling in the request context so
+// controllers can attribute the changes they make. The request id is taken
+// from the X-Request-ID header when present and echoed back to the client.
+func requestMetaMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		meta := reqmeta.Meta{
+			RequestID: ctx.GetHeader(requestIDHeader),
+			Actor:     anonymousActor,
+			ClientIP:  ctx.ClientIP(),
+		}
+		if meta.RequestID == "" {
+			meta.RequestID = reqmeta.NewID()
+		}
+		ctx.Header(requestIDHeader, meta.RequestID)
+
+		ctx.Request = ctx.Request.WithContext(reqmeta.With(ctx.Request.Context(), meta))
+		ctx.Next()
+	}
+}
+
+// loggerMiddleware injects a request scoped logger and writes one line per
+// request once the handler chain has finished.
+func loggerMiddleware(log *slog.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		meta := reqmeta.From(ctx.Request.Context())
+		route := ctx.FullPath()
+
+		reqLog := log.With(
+			slog.String("request_id", meta.RequestID),
+			slog.String("method", ctx.Request.Method),
+			slog.String("route", route),
+		)
+		if spanCtx := trace.SpanContextFromContext(ctx.Request.Context()); spanCtx.HasTraceID() {
+			reqLog = reqLog.With(slog.String("trace_id", spanCtx.TraceID().String()))
+		}
+		ctx.Request = ctx.Request.WithContext(logger.WithContext(ctx.Request.Context(), reqLog))
+
+		ctx.Next()
+
+		// auth middlewares may have replaced the actor further down the chain
+		meta = reqmeta.From(ctx.Request.Context())
+		attrs := []any{
+			slog.String("user", meta.Actor),
+			slog.String("client_ip", meta.ClientIP),
+			slog.Int("status", ctx.Writer.Status()),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if len(ctx.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", ctx.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+		if ctx.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		reqLog.Log(ctx.Request.Context(), level, "request completed", attrs...)
+	}
+}
+
+// metricsMiddleware counts requests and observes their latency by route.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(ctx.Writer.Status())
+
+		metrics.HTTPRequests.WithLabelValues(ctx.Request.Method, route, status).Inc()
+		metrics.HTTPDuration.WithLabelValues(ctx.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// tracingMiddleware starts a server span per request, continuing the trace
+// described by the incoming W3C traceparent header if there is one.
+func tracingMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		reqCtx := otel.GetTextMapPropagator().Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+		reqCtx, span := tracing.Tracer().Start(reqCtx, ctx.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(ctx.Request.Method),
+				semconv.HTTPRoute(route),
+			),
+		)
+		defer span.End()
+
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
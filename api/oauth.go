@@ -0,0 +1,523 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"time"
+
+	oauthController "simplebank/pkg/controllers/oauth"
+	"simplebank/pkg/models"
+	"simplebank/pkg/oauth"
+	"simplebank/pkg/token"
+	"simplebank/pkg/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	oauthClientIDLength       = 24
+	oauthClientSecretLength   = 40
+	oauthCodeLength           = 32
+	oauthRefreshTokenLength   = 48
+	authorizationCodeDuration = 5 * time.Minute
+)
+
+// oauthErrorResponse follows RFC 6749 rather than errorResponse, clients
+// of the authorization server expect that format.
+func oauthErrorResponse(code string, err error) gin.H {
+	return gin.H{"error": code, "error_description": err.Error()}
+}
+
+type createOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=64"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,dive,url"`
+	Scopes       []string `json:"scopes" binding:"required,min=1,dive,oneof=accounts:read accounts:write transfers:write cash:write audit:read"`
+	// Confidential clients get a secret, public ones such as mobile apps
+	// rely on PKCE alone.
+	Confidential bool `json:"confidential"`
+}
+
+type createOAuthClientResponse struct {
+	Client       *models.OAuthClient `json:"client"`
+	ClientSecret string              `json:"client_secret,omitempty"`
+}
+
+func (server *Server) createOAuthClient(ctx *gin.Context) {
+	var req createOAuthClientRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	clientID, err := util.SecureRandomString(oauthClientIDLength)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	var secret, secretHash string
+	if req.Confidential {
+		secret, err = util.SecureRandomString(oauthClientSecretLength)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		secretHash = util.HashToken(secret)
+	}
+
+	client, err := oauthController.CreateClient(ctx, server.db, oauthController.CreateClientParams{
+		Id:           clientID,
+		Owner:        authUsername(ctx),
+		Name:         req.Name,
+		SecretHash:   secretHash,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, createOAuthClientResponse{Client: client, ClientSecret: secret})
+}
+
+type authorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id" binding:"required"`
+	RedirectURI         string `form:"redirect_uri" binding:"required"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	// Approve carries the user's decision, only on the POST.
+	Approve bool `form:"approve"`
+}
+
+type authorizeResponse struct {
+	ClientID   string   `json:"client_id"`
+	ClientName string   `json:"client_name"`
+	Scopes     []string `json:"scopes"`
+	// Consented is set when the user already granted every scope, the
+	// consent screen can then be skipped.
+	Consented bool `json:"consented"`
+}
+
+// authorize describes the consent the client asks the user for.
+func (server *Server) authorize(ctx *gin.Context) {
+	req, client, scopes, ok := server.bindAuthorizeRequest(ctx)
+	if !ok {
+		return
+	}
+
+	consented := false
+	consent, err := oauthController.GetConsent(ctx, server.db, authUsername(ctx), client.Id)
+	if err == nil {
+		consented = oauth.Subset(scopes, consent.Scopes)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		redirectWithError(ctx, req, oauth.ErrServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, authorizeResponse{
+		ClientID:   client.Id,
+		ClientName: client.Name,
+		Scopes:     scopes,
+		Consented:  consented,
+	})
+}
+
+// approveAuthorization records the user's decision and sends them back to
+// the client with an authorization code, or with access_denied.
+func (server *Server) approveAuthorization(ctx *gin.Context) {
+	req, client, scopes, ok := server.bindAuthorizeRequest(ctx)
+	if !ok {
+		return
+	}
+
+	if !req.Approve {
+		redirectWithError(ctx, req, oauth.ErrAccessDenied, errors.New("the user denied the request"))
+		return
+	}
+
+	username := authUsername(ctx)
+	_, err := oauthController.GrantConsent(ctx, server.db, username, client.Id, scopes)
+	if err != nil {
+		redirectWithError(ctx, req, oauth.ErrServerError, err)
+		return
+	}
+
+	code, err := util.SecureRandomString(oauthCodeLength)
+	if err != nil {
+		redirectWithError(ctx, req, oauth.ErrServerError, err)
+		return
+	}
+
+	_, err = oauthController.CreateAuthorizationCode(ctx, server.db, oauthController.CreateAuthorizationCodeParams{
+		CodeHash:      util.HashToken(code),
+		ClientID:      client.Id,
+		Username:      username,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(authorizationCodeDuration),
+	})
+	if err != nil {
+		redirectWithError(ctx, req, oauth.ErrServerError, err)
+		return
+	}
+
+	redirect(ctx, req, url.Values{"code": {code}})
+}
+
+// bindAuthorizeRequest validates an authorization request. Until the
+// redirect uri is known to belong to the client errors are answered
+// directly, afterwards they are sent to the client through the redirect.
+func (server *Server) bindAuthorizeRequest(ctx *gin.Context) (*authorizeRequest, *models.OAuthClient, []string, bool) {
+	var req authorizeRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidRequest, err))
+		return nil, nil, nil, false
+	}
+
+	client, err := oauthController.GetClient(ctx, server.db, req.ClientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidClient, errors.New("unknown client")))
+			return nil, nil, nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+		return nil, nil, nil, false
+	}
+
+	if !oauth.Contains(client.RedirectURIs, req.RedirectURI) {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidRequest, errors.New("redirect_uri is not registered for the client")))
+		return nil, nil, nil, false
+	}
+
+	if req.ResponseType != "code" {
+		redirectWithError(ctx, &req, oauth.ErrUnsupportedResponseType, errors.New("only the code response type is supported"))
+		return nil, nil, nil, false
+	}
+
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != oauth.CodeChallengeMethodS256 {
+		redirectWithError(ctx, &req, oauth.ErrInvalidRequest, errors.New("a PKCE code challenge using S256 is required"))
+		return nil, nil, nil, false
+	}
+
+	scopes := oauth.ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !oauth.Subset(scopes, client.Scopes) {
+		redirectWithError(ctx, &req, oauth.ErrInvalidScope, errors.New("the client can't request these scopes"))
+		return nil, nil, nil, false
+	}
+
+	return &req, client, scopes, true
+}
+
+func redirect(ctx *gin.Context, req *authorizeRequest, params url.Values) {
+	// the redirect uri was registered and validated, parsing it can't fail
+	target, _ := url.Parse(req.RedirectURI)
+
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	target.RawQuery = query.Encode()
+
+	ctx.Redirect(http.StatusFound, target.String())
+}
+
+func redirectWithError(ctx *gin.Context, req *authorizeRequest, code string, err error) {
+	redirect(ctx, req, url.Values{
+		"error":             {code},
+		"error_description": {err.Error()},
+	})
+}
+
+type tokenRequest struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// issueToken is the token endpoint, it redeems authorization codes and
+// refresh tokens.
+func (server *Server) issueToken(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Pragma", "no-cache")
+
+	var req tokenRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidRequest, err))
+		return
+	}
+
+	client, ok := server.authenticateClient(ctx)
+	if !ok {
+		return
+	}
+
+	switch req.GrantType {
+	case "authorization_code":
+		server.redeemAuthorizationCode(ctx, client, &req)
+	case "refresh_token":
+		server.redeemRefreshToken(ctx, client, &req)
+	default:
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrUnsupportedGrantType, errors.New("unsupported grant type")))
+	}
+}
+
+func (server *Server) redeemAuthorizationCode(ctx *gin.Context, client *models.OAuthClient, req *tokenRequest) {
+	errInvalidCode := errors.New("authorization code is invalid")
+
+	code, err := oauthController.ConsumeAuthorizationCode(ctx, server.db, util.HashToken(req.Code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, oauthController.ErrCodeReused) {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidGrant, errInvalidCode))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+		return
+	}
+
+	if code.ClientID != client.Id || code.RedirectURI != req.RedirectURI || time.Now().After(code.ExpiresAt) {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidGrant, errInvalidCode))
+		return
+	}
+	if !oauth.VerifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidGrant, errors.New("code verifier doesn't match the challenge")))
+		return
+	}
+
+	refreshToken, err := util.SecureRandomString(oauthRefreshTokenLength)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+		return
+	}
+
+	_, err = oauthController.CreateRefreshToken(ctx, server.db, oauthController.CreateRefreshTokenParams{
+		TokenHash: util.HashToken(refreshToken),
+		ClientID:  client.Id,
+		Username:  code.Username,
+		Scopes:    code.Scopes,
+		ExpiresAt: time.Now().Add(server.config.OAuthRefreshTokenDuration),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+		return
+	}
+
+	server.tokenResponse(ctx, client, code.Username, code.Scopes, refreshToken)
+}
+
+func (server *Server) redeemRefreshToken(ctx *gin.Context, client *models.OAuthClient, req *tokenRequest) {
+	errInvalidRefreshToken := errors.New("refresh token is invalid")
+
+	old, err := oauthController.GetRefreshToken(ctx, server.db, util.HashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidGrant, errInvalidRefreshToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+		return
+	}
+	if old.ClientID != client.Id || time.Now().After(old.ExpiresAt) {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidGrant, errInvalidRefreshToken))
+		return
+	}
+
+	// a refresh may narrow the scopes but never widen them
+	scopes := []string(old.Scopes)
+	if req.Scope != "" {
+		scopes = oauth.ParseScope(req.Scope)
+		if !oauth.Subset(scopes, old.Scopes) {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidScope, errors.New("scope exceeds the original grant")))
+			return
+		}
+	}
+
+	consent, err := oauthController.GetConsent(ctx, server.db, old.Username, client.Id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidGrant, errors.New("consent was revoked")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+		return
+	}
+	if !oauth.Subset(scopes, consent.Scopes) {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidScope, errors.New("scope exceeds the user's consent")))
+		return
+	}
+
+	refreshToken, err := util.SecureRandomString(oauthRefreshTokenLength)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+		return
+	}
+
+	_, err = oauthController.RotateRefreshToken(ctx, server.db, oauthController.RotateRefreshTokenParams{
+		TokenHash:    old.TokenHash,
+		ClientID:     client.Id,
+		NewTokenHash: util.HashToken(refreshToken),
+		Scopes:       scopes,
+		ExpiresAt:    time.Now().Add(server.config.OAuthRefreshTokenDuration),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, oauthController.ErrRefreshTokenReused) {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidGrant, errInvalidRefreshToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+		return
+	}
+
+	server.tokenResponse(ctx, client, old.Username, scopes, refreshToken)
+}
+
+func (server *Server) tokenResponse(ctx *gin.Context, client *models.OAuthClient, username string, scopes []string, refreshToken string) {
+	accessToken, _, err := server.tokenMaker.CreateScopedToken(username, client.Id, scopes, server.config.AccessTokenDuration)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(server.config.AccessTokenDuration.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        oauth.FormatScope(scopes),
+	})
+}
+
+type revokeTokenRequest struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+}
+
+// revokeToken revokes a refresh or access token of the client. As RFC 7009
+// asks, unknown tokens are not an error.
+func (server *Server) revokeToken(ctx *gin.Context) {
+	var req revokeTokenRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauth.ErrInvalidRequest, err))
+		return
+	}
+
+	client, ok := server.authenticateClient(ctx)
+	if !ok {
+		return
+	}
+
+	revoked, err := oauthController.RevokeRefreshToken(ctx, server.db, util.HashToken(req.Token), client.Id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+		return
+	}
+	if revoked {
+		ctx.Status(http.StatusOK)
+		return
+	}
+
+	payload, err := server.tokenMaker.VerifyToken(req.Token)
+	if err == nil && payload.Purpose == token.PurposeOAuth && payload.ClientID == client.Id {
+		err = oauthController.RevokeAccessToken(ctx, server.db, payload.ID, payload.ExpiredAt)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+			return
+		}
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// authenticateClient identifies the client calling the token or revocation
+// endpoint, from HTTP basic credentials or the client_id and client_secret
+// form fields. Public clients only send their id.
+func (server *Server) authenticateClient(ctx *gin.Context) (*models.OAuthClient, bool) {
+	clientID, secret, ok := ctx.Request.BasicAuth()
+	if !ok {
+		clientID = ctx.PostForm("client_id")
+		secret = ctx.PostForm("client_secret")
+	}
+
+	errInvalidClient := errors.New("client authentication failed")
+	if clientID == "" {
+		ctx.JSON(http.StatusUnauthorized, oauthErrorResponse(oauth.ErrInvalidClient, errInvalidClient))
+		return nil, false
+	}
+
+	client, err := oauthController.GetClient(ctx, server.db, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusUnauthorized, oauthErrorResponse(oauth.ErrInvalidClient, errInvalidClient))
+			return nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, oauthErrorResponse(oauth.ErrServerError, err))
+		return nil, false
+	}
+
+	if client.SecretHash != "" && subtle.ConstantTimeCompare([]byte(util.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		ctx.JSON(http.StatusUnauthorized, oauthErrorResponse(oauth.ErrInvalidClient, errInvalidClient))
+		return nil, false
+	}
+
+	return client, true
+}
+
+func (server *Server) listOAuthConsents(ctx *gin.Context) {
+	consents, err := oauthController.ListConsents(ctx, server.db, authUsername(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, consents)
+}
+
+type oauthConsentRequest struct {
+	ClientID string `uri:"client_id" binding:"required"`
+}
+
+// revokeOAuthConsent lets a user cut off a third-party app, including the
+// tokens it already holds.
+func (server *Server) revokeOAuthConsent(ctx *gin.Context) {
+	var req oauthConsentRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	consent, err := oauthController.RevokeConsent(ctx, server.db, authUsername(ctx), req.ClientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, consent)
+}
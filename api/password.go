@@ -0,0 +1,183 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	userController "simplebank/pkg/controllers/user"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/mail"
+	"simplebank/pkg/models"
+	"simplebank/pkg/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const userTokenLength = 32
+
+var errInvalidUserToken = errors.New("token is invalid or has expired")
+
+func newMailer(config util.Config) (mail.Mailer, error) {
+	switch config.MailerBackend {
+	case "smtp":
+		return mail.NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom), nil
+	case "file":
+		return mail.NewFileMailer(config.MailDir, config.MailFrom)
+	case "memory":
+		return mail.NewMemoryMailer(), nil
+	default:
+		return nil, errors.Errorf("unknown mailer backend %q", config.MailerBackend)
+	}
+}
+
+type requestPasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// requestPasswordReset mails a reset link. It answers the same whether or
+// not the email belongs to a user so it can't be used to find accounts.
+func (server *Server) requestPasswordReset(ctx *gin.Context) {
+	var req requestPasswordResetRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := userController.GetUserByEmail(ctx, server.db, req.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.Status(http.StatusAccepted)
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = server.sendUserToken(ctx, user, userController.TokenPasswordReset, server.config.PasswordResetTokenDuration)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusAccepted)
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// resetPassword sets a new password from a reset token. Every session of
+// the user ends, they have to log in again.
+func (server *Server) resetPassword(ctx *gin.Context) {
+	var req resetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	hashedPassword, err := util.HashPassword(req.Password)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	user, err := userController.ResetPassword(ctx, server.db, util.HashToken(req.Token), hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidUserToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+// requestEmailVerification mails a new verification link to the
+// authenticated user.
+func (server *Server) requestEmailVerification(ctx *gin.Context) {
+	user, err := userController.GetUser(ctx, server.db, authUsername(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if user.EmailVerified {
+		ctx.JSON(http.StatusConflict, errorResponse(errors.New("email is already verified")))
+		return
+	}
+
+	err = server.sendUserToken(ctx, user, userController.TokenEmailVerification, server.config.EmailVerificationTokenDuration)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusAccepted)
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (server *Server) verifyEmail(ctx *gin.Context) {
+	var req verifyEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := userController.VerifyEmail(ctx, server.db, util.HashToken(req.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidUserToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+// sendUserToken creates a single-use token for purpose and mails it to the
+// user. Only its hash is stored.
+func (server *Server) sendUserToken(ctx *gin.Context, user *models.User, purpose string, duration time.Duration) error {
+	token, err := util.SecureRandomString(userTokenLength)
+	if err != nil {
+		return err
+	}
+
+	_, err = userController.CreateUserToken(ctx, server.db, userController.CreateUserTokenParams{
+		TokenHash: util.HashToken(token),
+		Username:  user.Username,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(duration),
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := mail.Message{To: user.Email}
+	switch purpose {
+	case userController.TokenPasswordReset:
+		msg.Subject = "Reset your Simple Bank password"
+		msg.Body = fmt.Sprintf("Hi %s,\n\nUse this link to choose a new password, it expires in %s:\n\n%s/reset-password?token=%s\n\n"+
+			"If you didn't ask for it you can ignore this email.\n", user.FullName, duration, server.config.BaseURL, token)
+	case userController.TokenEmailVerification:
+		msg.Subject = "Confirm your Simple Bank email"
+		msg.Body = fmt.Sprintf("Hi %s,\n\nUse this link to confirm your email address, it expires in %s:\n\n%s/verify-email?token=%s\n",
+			user.FullName, duration, server.config.BaseURL, token)
+	}
+
+	if err := server.mailer.Send(ctx, msg); err != nil {
+		return errors.Wrap(err, "cannot send email")
+	}
+
+	logger.FromContext(ctx).Info("user token mailed", "username", user.Username, "purpose", purpose)
+	return nil
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"simplebank/pkg/logger"
+	"simplebank/pkg/ratelimit"
+	"simplebank/pkg/reqmeta"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+var (
+	loginRateLimit    = ratelimit.Per("login", 5, time.Minute)
+	transferRateLimit = ratelimit.Per("transfers", 30, time.Minute)
+	// passwordResetRateLimit keeps the endpoint from being used to flood
+	// mailboxes.
+	passwordResetRateLimit = ratelimit.Per("password_reset", 5, time.Hour)
+	// the second login step and the token confirmations have their own
+	// buckets, so one flow doesn't use up the budget of the others.
+	loginMFARateLimit             = ratelimit.Per("login_mfa", 5, time.Minute)
+	passwordResetConfirmRateLimit = ratelimit.Per("password_reset_confirm", 5, time.Minute)
+	emailVerificationRateLimit    = ratelimit.Per("email_verification", 5, time.Minute)
+	// oauthTokenRateLimit guards the endpoints clients authenticate on.
+	oauthTokenRateLimit = ratelimit.Per("oauth_token", 30, time.Minute)
+)
+
+func newRateLimiter(backend string, server *Server) (ratelimit.Backend, error) {
+	switch backend {
+	case "memory":
+		return ratelimit.NewMemoryBackend(), nil
+	case "postgres":
+		return ratelimit.NewPostgresBackend(server.db), nil
+	default:
+		return nil, errors.Errorf("unknown rate limit backend %q", backend)
+	}
+}
+
+// rateLimitMiddleware takes a token from the caller's bucket for policy. The
+// caller is the authenticated user if any, otherwise the client ip. When the
+// backend fails the request is let through rather than taking the api down.
+func (server *Server) rateLimitMiddleware(policy ratelimit.Policy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		meta := reqmeta.From(ctx.Request.Context())
+		key := fmt.Sprintf("%s:ip:%s", policy.Name, meta.ClientIP)
+		if meta.Actor != anonymousActor {
+			key = fmt.Sprintf("%s:user:%s", policy.Name, meta.Actor)
+		}
+
+		res, err := server.limiter.Allow(ctx, key, policy)
+		if err != nil {
+			logger.FromContext(ctx).Error("rate limiter unavailable", "error", err)
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		ctx.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		ctx.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, errorResponse(errors.New("rate limit exceeded")))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	transferController "simplebank/pkg/controllers/transfer"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type reverseTransferURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type reverseTransferRequest struct {
+	// Amount defaults to what is left to reverse of the transfer.
+	Amount int64  `json:"amount" binding:"min=0"`
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// reverseTransfer gives back all or part of a transfer to its sender.
+func (server *Server) reverseTransfer(ctx *gin.Context) {
+	var uri reverseTransferURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req reverseTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	result, err := transferController.ReverseTransfer(ctx, server.db, transferController.ReverseTransferParams{
+		TransferID: uri.ID,
+		Amount:     req.Amount,
+		Reason:     req.Reason,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+		case errors.Is(err, transferController.ErrReversalExceedsTransfer):
+			ctx.JSON(http.StatusConflict, errorResponse(err))
+		case errors.Is(err, transferController.ErrNotReversible),
+			errors.Is(err, transferController.ErrAccountNotActive),
+			errors.Is(err, transferController.ErrInsufficientFunds):
+			ctx.JSON(http.StatusUnprocessableEntity, errorResponse(err))
+		default:
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
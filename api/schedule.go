@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"simplebank/pkg/connection"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/models"
+	"simplebank/pkg/rbac"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+var (
+	errScheduledTransferNotOwned = errors.New("scheduled transfer doesn't belong to the authenticated user")
+	errStartInPast               = errors.New("start_at is in the past")
+)
+
+type createScheduledTransferRequest struct {
+	FromAccountID int64  `json:"from_account_id" binding:"required,min=1"`
+	ToAccountID   int64  `json:"to_account_id" binding:"required,min=1,nefield=FromAccountID"`
+	Amount        int64  `json:"amount" binding:"required,gt=0"`
+	Currency      string `json:"currency" binding:"required,oneof=USD EUR"`
+	Frequency     string `json:"frequency" binding:"required,oneof=once daily weekly monthly"`
+	// StartAt is the first occurrence, later ones keep its time of day.
+	StartAt time.Time  `json:"start_at" binding:"required"`
+	EndAt   *time.Time `json:"end_at"`
+	// Count ends the schedule after that many occurrences.
+	Count *int32 `json:"count" binding:"omitempty,min=1"`
+	// TOTPCode is required when Amount is above the configured threshold.
+	TOTPCode string `json:"totp_code"`
+}
+
+// createScheduledTransfer schedules a transfer from an account of the user,
+// once or repeatedly. The scheduler makes the transfers as if the user did.
+func (server *Server) createScheduledTransfer(ctx *gin.Context) {
+	var req createScheduledTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if req.StartAt.Before(time.Now().Add(-time.Minute)) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errStartInPast))
+		return
+	}
+
+	fromAccount, valid := server.validAccount(ctx, req.FromAccountID, req.Currency)
+	if !valid {
+		return
+	}
+	if fromAccount.Owner != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errAccountNotOwned))
+		return
+	}
+
+	if _, valid = server.validAccount(ctx, req.ToAccountID, req.Currency); !valid {
+		return
+	}
+
+	if !server.withinApprovalThreshold(ctx, req.Amount) {
+		return
+	}
+
+	if !server.freshSecondFactor(ctx, req.Amount, req.TOTPCode) {
+		return
+	}
+
+	transfer, err := transferController.CreateScheduledTransfer(ctx, server.db, transferController.CreateScheduledTransferParams{
+		Owner:         authUsername(ctx),
+		FromAccountID: req.FromAccountID,
+		ToAccountID:   req.ToAccountID,
+		Amount:        req.Amount,
+		Frequency:     req.Frequency,
+		StartAt:       req.StartAt,
+		EndAt:         req.EndAt,
+		MaxRuns:       req.Count,
+	})
+	if err != nil {
+		server.scheduledTransferError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, transfer)
+}
+
+type listScheduledTransfersRequest struct {
+	// Owner defaults to the authenticated user, staff allowed to read all
+	// accounts can list the schedules of anyone.
+	Owner string `form:"owner"`
+}
+
+func (server *Server) listScheduledTransfers(ctx *gin.Context) {
+	var req listScheduledTransfersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if req.Owner == "" {
+		req.Owner = authUsername(ctx)
+	}
+	if req.Owner != authUsername(ctx) && !authRole(ctx).Can(rbac.ReadAllAccounts) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errScheduledTransferNotOwned))
+		return
+	}
+
+	transfers, err := transferController.ListScheduledTransfers(ctx, server.db, req.Owner)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, transfers)
+}
+
+type scheduledTransferURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+func (server *Server) getScheduledTransfer(ctx *gin.Context) {
+	transfer, ok := server.ownedScheduledTransfer(ctx, true)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, transfer)
+}
+
+func (server *Server) listScheduledTransferRuns(ctx *gin.Context) {
+	transfer, ok := server.ownedScheduledTransfer(ctx, true)
+	if !ok {
+		return
+	}
+
+	runs, err := transferController.ListScheduledTransferRuns(ctx, server.db, transfer.Id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, runs)
+}
+
+type updateScheduledTransferRequest struct {
+	Amount int64      `json:"amount" binding:"required,gt=0"`
+	EndAt  *time.Time `json:"end_at"`
+	Count  *int32     `json:"count" binding:"omitempty,min=1"`
+	// TOTPCode is required when Amount is above the configured threshold.
+	TOTPCode string `json:"totp_code"`
+}
+
+// updateScheduledTransfer replaces the amount and the end of a schedule,
+// leaving out end_at or count removes that bound.
+func (server *Server) updateScheduledTransfer(ctx *gin.Context) {
+	transfer, ok := server.ownedScheduledTransfer(ctx, false)
+	if !ok {
+		return
+	}
+
+	var req updateScheduledTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if !server.withinApprovalThreshold(ctx, req.Amount) {
+		return
+	}
+
+	if !server.freshSecondFactor(ctx, req.Amount, req.TOTPCode) {
+		return
+	}
+
+	transfer, err := transferController.UpdateScheduledTransfer(ctx, server.db, transferController.UpdateScheduledTransferParams{
+		Id:      transfer.Id,
+		Amount:  req.Amount,
+		EndAt:   req.EndAt,
+		MaxRuns: req.Count,
+	})
+	if err != nil {
+		server.scheduledTransferError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, transfer)
+}
+
+func (server *Server) pauseScheduledTransfer(ctx *gin.Context) {
+	server.changeScheduledTransfer(ctx, transferController.PauseScheduledTransfer)
+}
+
+func (server *Server) resumeScheduledTransfer(ctx *gin.Context) {
+	server.changeScheduledTransfer(ctx, transferController.ResumeScheduledTransfer)
+}
+
+func (server *Server) cancelScheduledTransfer(ctx *gin.Context) {
+	server.changeScheduledTransfer(ctx, transferController.CancelScheduledTransfer)
+}
+
+func (server *Server) changeScheduledTransfer(ctx *gin.Context,
+	change func(ctx context.Context, db connection.DBTX, id int64) (*models.ScheduledTransfer, error)) {
+	transfer, ok := server.ownedScheduledTransfer(ctx, false)
+	if !ok {
+		return
+	}
+
+	transfer, err := change(ctx, server.db, transfer.Id)
+	if err != nil {
+		server.scheduledTransferError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, transfer)
+}
+
+// ownedScheduledTransfer loads the scheduled transfer in the URI and checks
+// it belongs to the user, writing the error response itself when not. Staff
+// allowed to read all accounts can read it too, only the owner changes it.
+func (server *Server) ownedScheduledTransfer(ctx *gin.Context, read bool) (*models.ScheduledTransfer, bool) {
+	var uri scheduledTransferURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return nil, false
+	}
+
+	transfer, err := transferController.GetScheduledTransfer(ctx, server.db, uri.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return nil, false
+	}
+
+	if transfer.Owner != authUsername(ctx) && !(read && authRole(ctx).Can(rbac.ReadAllAccounts)) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errScheduledTransferNotOwned))
+		return nil, false
+	}
+
+	return transfer, true
+}
+
+func (server *Server) scheduledTransferError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, transferController.ErrScheduleNotActive):
+		ctx.JSON(http.StatusConflict, errorResponse(err))
+	case errors.Is(err, transferController.ErrInvalidSchedule):
+		ctx.JSON(http.StatusUnprocessableEntity, errorResponse(err))
+	default:
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+	}
+}
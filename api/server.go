@@ -1,31 +1,218 @@
 package api
 
 import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"simplebank/pkg/mail"
+	"simplebank/pkg/metrics"
+	"simplebank/pkg/ratelimit"
+	"simplebank/pkg/rbac"
+	"simplebank/pkg/token"
+	"simplebank/pkg/util"
+	"sync/atomic"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 )
 
 type Server struct {
-	db     *sqlx.DB
-	router *gin.Engine
+	config     util.Config
+	db         *sqlx.DB
+	logger     *slog.Logger
+	limiter    ratelimit.Backend
+	mailer     mail.Mailer
+	tokenMaker token.Maker
+	router     *gin.Engine
+	http       *http.Server
+
+	shuttingDown atomic.Bool
 }
 
-func NewServer(db *sqlx.DB) *Server {
+func NewServer(config util.Config, db *sqlx.DB, logger *slog.Logger) (*Server, error) {
 	server := &Server{
-		db: db,
+		config: config,
+		db:     db,
+		logger: logger,
+	}
+
+	tokenMaker, err := token.NewJWTMaker(config.TokenSymmetricKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create token maker")
+	}
+	server.tokenMaker = tokenMaker
+
+	limiter, err := newRateLimiter(config.RateLimitBackend, server)
+	if err != nil {
+		return nil, err
+	}
+	server.limiter = limiter
+
+	mailer, err := newMailer(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create mailer")
+	}
+	server.mailer = mailer
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	// X-Forwarded-For is set by the client unless a trusted proxy rewrote
+	// it, relying on it would let anyone pick their rate limit bucket
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil {
+		return nil, errors.Wrap(err, "invalid trusted proxies")
 	}
-	router := gin.Default()
+	router.Use(gin.Recovery())
+	router.Use(requestMetaMiddleware())
+	router.Use(tracingMiddleware())
+	router.Use(loggerMiddleware(logger))
+	router.Use(metricsMiddleware())
+
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	router.GET("/healthz", server.healthz)
+	router.GET("/readyz", server.readyz)
+
+	router.POST("/users", server.createUser)
+	router.POST("/users/login", server.rateLimitMiddleware(loginRateLimit), server.loginUser)
+	router.POST("/users/login/mfa", server.rateLimitMiddleware(loginMFARateLimit), server.loginMFA)
+	router.POST("/users/password_reset", server.rateLimitMiddleware(passwordResetRateLimit), server.requestPasswordReset)
+	router.POST("/users/password_reset/confirm", server.rateLimitMiddleware(passwordResetConfirmRateLimit), server.resetPassword)
+	router.POST("/users/email_verification/confirm", server.rateLimitMiddleware(emailVerificationRateLimit), server.verifyEmail)
+
+	router.POST("/oauth/token", server.rateLimitMiddleware(oauthTokenRateLimit), server.issueToken)
+	router.POST("/oauth/revoke", server.rateLimitMiddleware(oauthTokenRateLimit), server.revokeToken)
+
+	authRoutes := router.Group("/", server.authMiddleware())
+
+	// credentials can only be managed after an interactive login
+	userRoutes := authRoutes.Group("/users", requireAccessToken())
+
+	userRoutes.POST("/email_verification", server.requestEmailVerification)
+
+	userRoutes.POST("/totp/enroll", server.enrollTOTP)
+	userRoutes.POST("/totp/confirm", server.confirmTOTP)
+	userRoutes.POST("/totp/disable", server.disableTOTP)
+
+	userRoutes.POST("/api_keys", server.createAPIKey)
+	userRoutes.GET("/api_keys", server.listAPIKeys)
+	userRoutes.POST("/api_keys/:id/rotate", server.rotateAPIKey)
+	userRoutes.DELETE("/api_keys/:id", server.revokeAPIKey)
+
+	userRoutes.GET("/oauth_consents", server.listOAuthConsents)
+	userRoutes.DELETE("/oauth_consents/:client_id", server.revokeOAuthConsent)
+
+	oauthRoutes := authRoutes.Group("/oauth", requireAccessToken())
 
-	router.POST("/accounts", server.createAccount)
-	router.GET("/accounts/:id", server.getAccount)
-	router.GET("/accounts", server.getAccountAll)
+	oauthRoutes.POST("/clients", server.createOAuthClient)
+	oauthRoutes.GET("/authorize", server.authorize)
+	oauthRoutes.POST("/authorize", server.approveAuthorization)
+
+	authRoutes.POST("/accounts", requirePermission(rbac.CreateOwnAccounts), server.createAccount)
+	authRoutes.GET("/accounts/:id", requirePermission(rbac.ReadOwnAccounts), server.getAccount)
+	authRoutes.GET("/accounts", requirePermission(rbac.ReadOwnAccounts), server.getAccountAll)
+	authRoutes.GET("/accounts/:id/limits", requirePermission(rbac.ReadOwnAccounts), server.getAllowance)
+	authRoutes.GET("/accounts/:id/holds", requirePermission(rbac.ReadOwnAccounts), server.listAccountHolds)
+	authRoutes.GET("/accounts/:id/statement", requirePermission(rbac.ReadOwnAccounts), server.getStatement)
+	authRoutes.GET("/accounts/:id/balance", requirePermission(rbac.ReadOwnAccounts), server.getBalanceAt)
+
+	authRoutes.POST("/transfers", requirePermission(rbac.CreateOwnTransfers),
+		server.rateLimitMiddleware(transferRateLimit), server.createTransfer)
+	authRoutes.GET("/transfers/fee", requirePermission(rbac.CreateOwnTransfers), server.previewFee)
+	authRoutes.POST("/transfers/batch", requirePermission(rbac.CreateOwnTransfers),
+		server.rateLimitMiddleware(transferRateLimit), server.createTransferBatch)
+	authRoutes.GET("/transfers/batch/:id", requirePermission(rbac.ReadOwnAccounts), server.getTransferBatch)
+	authRoutes.GET("/transfer_approvals/:id", requirePermission(rbac.CreateOwnTransfers), server.getTransferApproval)
+
+	authRoutes.POST("/holds", requirePermission(rbac.CreateOwnTransfers), server.authorizeHold)
+	authRoutes.GET("/holds/:id", requirePermission(rbac.CreateOwnTransfers), server.getHold)
+	authRoutes.POST("/holds/:id/capture", requirePermission(rbac.CreateOwnTransfers),
+		server.rateLimitMiddleware(transferRateLimit), server.captureHold)
+	authRoutes.POST("/holds/:id/void", requirePermission(rbac.CreateOwnTransfers), server.voidHold)
+
+	authRoutes.POST("/scheduled_transfers", requirePermission(rbac.CreateOwnTransfers), server.createScheduledTransfer)
+	authRoutes.GET("/scheduled_transfers", requirePermission(rbac.ReadOwnAccounts), server.listScheduledTransfers)
+	authRoutes.GET("/scheduled_transfers/:id", requirePermission(rbac.ReadOwnAccounts), server.getScheduledTransfer)
+	authRoutes.PUT("/scheduled_transfers/:id", requirePermission(rbac.CreateOwnTransfers), server.updateScheduledTransfer)
+	authRoutes.DELETE("/scheduled_transfers/:id", requirePermission(rbac.CreateOwnTransfers), server.cancelScheduledTransfer)
+	authRoutes.POST("/scheduled_transfers/:id/pause", requirePermission(rbac.CreateOwnTransfers), server.pauseScheduledTransfer)
+	authRoutes.POST("/scheduled_transfers/:id/resume", requirePermission(rbac.CreateOwnTransfers), server.resumeScheduledTransfer)
+	authRoutes.GET("/scheduled_transfers/:id/runs", requirePermission(rbac.ReadOwnAccounts), server.listScheduledTransferRuns)
+
+	authRoutes.GET("/exchange_rates", requirePermission(rbac.ReadOwnAccounts), server.listExchangeRates)
+	authRoutes.POST("/fx/quotes", requirePermission(rbac.CreateOwnTransfers), server.createQuote)
+	authRoutes.GET("/fx/quotes/:id", requirePermission(rbac.CreateOwnTransfers), server.getQuote)
+	authRoutes.POST("/fx/transfers", requirePermission(rbac.CreateOwnTransfers),
+		server.rateLimitMiddleware(transferRateLimit), server.createFXTransfer)
+
+	authRoutes.POST("/deposits", requirePermission(rbac.PostCash), server.createDeposit)
+	authRoutes.POST("/withdrawals", requirePermission(rbac.PostCash), server.createWithdrawal)
+
+	authRoutes.GET("/audit_events", requirePermission(rbac.ReadAudit), server.listAuditEvents)
+
+	authRoutes.POST("/admin/users/:username/unlock", requirePermission(rbac.ManageUsers), server.unlockUser)
+	authRoutes.PATCH("/admin/users/:username/role", requirePermission(rbac.ManageUsers), server.updateUserRole)
+	authRoutes.PATCH("/admin/accounts/:id/status", requirePermission(rbac.ManageAccounts), server.updateAccountStatus)
+	authRoutes.PATCH("/admin/accounts/:id/tier", requirePermission(rbac.ManageAccounts), server.updateAccountTier)
+	authRoutes.PUT("/admin/accounts/:id/overdraft", requirePermission(rbac.ManageAccounts), server.grantOverdraft)
+	authRoutes.DELETE("/admin/accounts/:id/overdraft", requirePermission(rbac.ManageAccounts), server.revokeOverdraft)
+	authRoutes.GET("/admin/fee_rules", requirePermission(rbac.ReadFees), server.listFeeRules)
+	authRoutes.POST("/admin/fee_rules", requirePermission(rbac.ManageFees), server.createFeeRule)
+	authRoutes.DELETE("/admin/fee_rules/:id", requirePermission(rbac.ManageFees), server.deleteFeeRule)
+	authRoutes.GET("/admin/transfer_limits", requirePermission(rbac.ReadLimits), server.listTransferLimits)
+	authRoutes.PUT("/admin/transfer_limits", requirePermission(rbac.ManageLimits), server.setTransferLimit)
+	authRoutes.POST("/admin/exchange_rates", requirePermission(rbac.ManageExchangeRates), server.createExchangeRate)
+	authRoutes.POST("/admin/transfers/:id/reversals", requirePermission(rbac.ReverseTransfers), server.reverseTransfer)
+	authRoutes.GET("/admin/transfer_approvals", requirePermission(rbac.ApproveTransfers), server.listTransferApprovals)
+	authRoutes.POST("/admin/transfer_approvals/:id/approve", requirePermission(rbac.ApproveTransfers), server.approveTransfer)
+	authRoutes.POST("/admin/transfer_approvals/:id/reject", requirePermission(rbac.ApproveTransfers), server.rejectTransfer)
+	authRoutes.POST("/admin/imports/:kind", requirePermission(rbac.ImportData), server.importData)
 
 	server.router = router
-	return server
+	server.http = &http.Server{Handler: router}
+	return server, nil
 }
 
+// Start serves HTTP on address until Shutdown is called.
 func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	server.logger.Info("starting server", "address", address)
+	err = server.http.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown marks the server as not ready, waits drain so load balancers can
+// observe the failing readiness probe, then stops accepting requests and
+// waits for in-flight ones to finish.
+func (server *Server) Shutdown(ctx context.Context, drain time.Duration) error {
+	server.shuttingDown.Store(true)
+	server.logger.Info("shutting down server", "drain", drain.String())
+
+	select {
+	case <-time.After(drain):
+	case <-ctx.Done():
+	}
+
+	return server.http.Shutdown(ctx)
+}
+
+// Handler returns the HTTP handler of the server, to serve it in-process
+// such as with httptest.
+func (server *Server) Handler() http.Handler {
+	return server.router
+}
+
+// Mailer returns the mailer the server sends emails with.
+func (server *Server) Mailer() mail.Mailer {
+	return server.mailer
 }
 
 func errorResponse(err error) gin.H {
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	accountController "simplebank/pkg/controllers/account"
+	statementController "simplebank/pkg/controllers/statement"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/rbac"
+	"simplebank/pkg/statement"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type statementQuery struct {
+	// From and To are days, To excluded: a statement for September runs
+	// from 2026-09-01 to 2026-10-01.
+	From   time.Time `form:"from" binding:"required" time_format:"2006-01-02" time_utc:"1"`
+	To     time.Time `form:"to" binding:"required,gtfield=From" time_format:"2006-01-02" time_utc:"1"`
+	Format string    `form:"format" binding:"omitempty,oneof=csv json pdf"`
+}
+
+// getStatement streams the statement of an account over a period, in JSON
+// unless format asks for CSV or PDF.
+func (server *Server) getStatement(ctx *gin.Context) {
+	var req getAccountRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var query statementQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if query.Format == "" {
+		query.Format = statement.FormatJSON
+	}
+
+	account, err := accountController.GetAccountByID(ctx, server.db, req.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !authRole(ctx).Can(rbac.ReadAllAccounts) && account.Owner != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errAccountNotOwned))
+		return
+	}
+
+	writer, err := statement.NewWriter(query.Format, ctx.Writer)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	ctx.Header("Content-Type", statement.ContentType(query.Format))
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%d-%s-%s.%s"`,
+		account.Id, query.From.Format("2006-01-02"), query.To.Format("2006-01-02"), query.Format))
+	ctx.Status(http.StatusOK)
+
+	err = statementController.WriteStatement(ctx, server.db, statementController.StatementParams{
+		AccountID: account.Id,
+		From:      query.From,
+		To:        query.To,
+	}, writer)
+	if err != nil {
+		// once the statement has started the status is sent, the client is
+		// left with a truncated file
+		if !ctx.Writer.Written() {
+			ctx.Header("Content-Type", "")
+			ctx.Header("Content-Disposition", "")
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		logger.FromContext(ctx).Error("statement interrupted", "account_id", account.Id, "error", err)
+	}
+}
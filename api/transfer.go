@@ -0,0 +1,130 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	accountController "simplebank/pkg/controllers/account"
+	transferController "simplebank/pkg/controllers/transfer"
+	userController "simplebank/pkg/controllers/user"
+	"simplebank/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type transferRequest struct {
+	FromAccountID int64  `json:"from_account_id" binding:"required,min=1"`
+	ToAccountID   int64  `json:"to_account_id" binding:"required,min=1,nefield=FromAccountID"`
+	Amount        int64  `json:"amount" binding:"required,gt=0"`
+	Currency      string `json:"currency" binding:"required,oneof=USD EUR"`
+	// TOTPCode is required when Amount is above the configured threshold.
+	TOTPCode string `json:"totp_code"`
+}
+
+func (server *Server) createTransfer(ctx *gin.Context) {
+	var req transferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	fromAccount, valid := server.validAccount(ctx, req.FromAccountID, req.Currency)
+	if !valid {
+		return
+	}
+	if fromAccount.Owner != authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errAccountNotOwned))
+		return
+	}
+
+	_, valid = server.validAccount(ctx, req.ToAccountID, req.Currency)
+	if !valid {
+		return
+	}
+
+	if !server.freshSecondFactor(ctx, req.Amount, req.TOTPCode) {
+		return
+	}
+
+	if threshold := server.config.TransferApprovalThreshold; threshold > 0 && req.Amount > threshold {
+		server.requestTransferApproval(ctx, req)
+		return
+	}
+
+	arg := transferController.TransferTxParams{
+		FromAccountID: req.FromAccountID,
+		ToAccountID:   req.ToAccountID,
+		Amount:        req.Amount,
+	}
+
+	result, err := transferController.TransferTx(ctx, server.db, arg)
+	if err != nil {
+		if errors.Is(err, transferController.ErrAccountNotActive) ||
+			errors.Is(err, transferController.ErrNotCustomerAccount) ||
+			errors.Is(err, transferController.ErrCurrencyMismatch) ||
+			errors.Is(err, transferController.ErrLimitExceeded) ||
+			errors.Is(err, transferController.ErrInsufficientFunds) {
+			ctx.JSON(http.StatusUnprocessableEntity, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// validAccount checks the account exists and holds the given currency,
+// writing the error response itself when it doesn't.
+func (server *Server) validAccount(ctx *gin.Context, accountID int64, currency string) (*models.Account, bool) {
+	account, err := accountController.GetAccountByID(ctx, server.db, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return account, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return account, false
+	}
+
+	if account.Currency != currency {
+		err := fmt.Errorf("account [%d] currency mismatch: %s vs %s", account.Id, account.Currency, currency)
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return account, false
+	}
+
+	return account, true
+}
+
+// freshSecondFactor enforces a TOTP code on transfers above the configured
+// threshold, writing the error response itself when it is missing or wrong.
+func (server *Server) freshSecondFactor(ctx *gin.Context, amount int64, code string) bool {
+	threshold := server.config.TransferTOTPThreshold
+	if threshold <= 0 || amount <= threshold {
+		return true
+	}
+
+	user, err := userController.GetUser(ctx, server.db, authUsername(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return false
+	}
+	if !user.TOTPEnabled {
+		err := fmt.Errorf("transfers above %d require two-factor authentication to be enabled", threshold)
+		ctx.JSON(http.StatusForbidden, errorResponse(err))
+		return false
+	}
+
+	ok, err := server.verifySecondFactor(ctx, user, code, "")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return false
+	}
+	if !ok {
+		ctx.JSON(http.StatusForbidden, errorResponse(errInvalidSecondFactor))
+		return false
+	}
+
+	return true
+}
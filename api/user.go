@@ -0,0 +1,246 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	userController "simplebank/pkg/controllers/user"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/metrics"
+	"simplebank/pkg/models"
+	"simplebank/pkg/token"
+	"simplebank/pkg/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var errInvalidCredentials = errors.New("invalid username or password")
+
+type createUserRequest struct {
+	Username string `json:"username" binding:"required,alphanum"`
+	Password string `json:"password" binding:"required,min=6"`
+	FullName string `json:"full_name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+}
+
+func (server *Server) createUser(ctx *gin.Context) {
+	var req createUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	hashedPassword, err := util.HashPassword(req.Password)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	arg := userController.CreateUserParams{
+		Username:       req.Username,
+		HashedPassword: hashedPassword,
+		FullName:       req.FullName,
+		Email:          req.Email,
+	}
+
+	user, err := userController.CreateUser(ctx, server.db, arg)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation" {
+			ctx.JSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the user is created either way, they can ask for another email
+	err = server.sendUserToken(ctx, user, userController.TokenEmailVerification, server.config.EmailVerificationTokenDuration)
+	if err != nil {
+		logger.FromContext(ctx).Error("cannot send verification email", "username", user.Username, "error", err)
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+type loginUserRequest struct {
+	Username string `json:"username" binding:"required,alphanum"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// loginUserResponse either carries the access token, or when the user has
+// two-factor authentication the MFA challenge token to pass to loginMFA.
+type loginUserResponse struct {
+	AccessToken          string       `json:"access_token,omitempty"`
+	AccessTokenExpiresAt *time.Time   `json:"access_token_expires_at,omitempty"`
+	User                 *models.User `json:"user,omitempty"`
+	MFARequired          bool         `json:"mfa_required"`
+	MFAToken             string       `json:"mfa_token,omitempty"`
+	MFATokenExpiresAt    *time.Time   `json:"mfa_token_expires_at,omitempty"`
+}
+
+func (server *Server) loginUser(ctx *gin.Context) {
+	var req loginUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := userController.GetUser(ctx, server.db, req.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			metrics.Logins.WithLabelValues("failure").Inc()
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidCredentials))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if userController.IsLocked(user, time.Now()) {
+		metrics.Logins.WithLabelValues("locked").Inc()
+		server.lockedResponse(ctx, user)
+		return
+	}
+
+	err = util.CheckPassword(req.Password, user.HashedPassword)
+	if err != nil {
+		server.failedLogin(ctx, user, errInvalidCredentials)
+		return
+	}
+
+	if user.TOTPEnabled {
+		mfaToken, mfaPayload, err := server.tokenMaker.CreateToken(user.Username, token.PurposeMFA, server.config.MFATokenDuration)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, loginUserResponse{
+			MFARequired:       true,
+			MFAToken:          mfaToken,
+			MFATokenExpiresAt: &mfaPayload.ExpiredAt,
+		})
+		return
+	}
+
+	server.completeLogin(ctx, user)
+}
+
+// failedLogin counts a failed attempt and answers with err, or with the
+// lockout if this attempt locked the user.
+func (server *Server) failedLogin(ctx *gin.Context, user *models.User, err error) {
+	metrics.Logins.WithLabelValues("failure").Inc()
+
+	user, lockErr := userController.RecordFailedLogin(ctx, server.db, user.Username, server.lockoutPolicy())
+	if lockErr != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(lockErr))
+		return
+	}
+	if userController.IsLocked(user, time.Now()) {
+		server.lockedResponse(ctx, user)
+		return
+	}
+
+	ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+}
+
+// completeLogin resets the failed login counters and issues an access token.
+func (server *Server) completeLogin(ctx *gin.Context, user *models.User) {
+	err := userController.ResetFailedLogins(ctx, server.db, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(user.Username, token.PurposeAccess, server.config.AccessTokenDuration)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	metrics.Logins.WithLabelValues("success").Inc()
+	ctx.JSON(http.StatusOK, loginUserResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: &accessPayload.ExpiredAt,
+		User:                 user,
+	})
+}
+
+func (server *Server) lockedResponse(ctx *gin.Context, user *models.User) {
+	retryAfter := time.Until(user.LockedUntil.Time)
+	ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+	ctx.JSON(http.StatusLocked, errorResponse(errors.New("account is locked, try again later")))
+}
+
+func (server *Server) lockoutPolicy() userController.LockoutPolicy {
+	return userController.LockoutPolicy{
+		MaxAttempts: server.config.LoginMaxAttempts,
+		Window:      server.config.LoginAttemptWindow,
+		Lockout:     server.config.LoginLockout,
+		MaxLockout:  server.config.LoginMaxLockout,
+	}
+}
+
+type usernameRequest struct {
+	Username string `uri:"username" binding:"required,alphanum"`
+}
+
+func (server *Server) unlockUser(ctx *gin.Context) {
+	var req usernameRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := userController.UnlockUser(ctx, server.db, req.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+type updateUserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=customer teller auditor admin"`
+}
+
+func (server *Server) updateUserRole(ctx *gin.Context) {
+	var uri usernameRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req updateUserRoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if uri.Username == authUsername(ctx) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errors.New("admins can't change their own role")))
+		return
+	}
+
+	user, err := userController.UpdateUserRole(ctx, server.db, uri.Username, req.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
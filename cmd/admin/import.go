@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"simplebank/pkg/connection"
+	importController "simplebank/pkg/controllers/imports"
+)
+
+var importCommand = command{
+	usage: "load accounts or transfers from a CSV file",
+	run:   importFile,
+}
+
+func importFile(ctx context.Context, db connection.DBTX, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	kind := flags.String("kind", "", "what the file holds, accounts or transfers")
+	file := flags.String("file", "", "CSV file to import, - reads standard input")
+	dryRun := flags.Bool("dry-run", false, "validate every row without loading any")
+	chunkSize := flags.Int("chunk", importController.DefaultChunkSize, "rows loaded per transaction")
+	flags.Parse(args)
+
+	load := importController.ImportAccounts
+	switch *kind {
+	case importController.KindAccounts:
+	case importController.KindTransfers:
+		load = importController.ImportTransfers
+	default:
+		flags.Usage()
+		return errors.New("-kind must be accounts or transfers")
+	}
+	if *file == "" || *chunkSize <= 0 {
+		flags.Usage()
+		return errors.New("-file is required, -chunk must be positive")
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	report, err := load(ctx, db, r, importController.ImportParams{DryRun: *dryRun, ChunkSize: *chunkSize})
+
+	// the report says what was loaded before a failure too
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(report); encodeErr != nil && err == nil {
+		err = encodeErr
+	}
+	return err
+}
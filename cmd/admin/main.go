@@ -0,0 +1,82 @@
+// Command admin runs back-office operations against the database directly,
+// for when the API isn't the right tool. Changes are audited with the
+// operating system user as the actor.
+//
+//	go run ./cmd/admin <command> [flags]
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"sort"
+
+	"simplebank/pkg/connection"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/reqmeta"
+)
+
+// command runs one subcommand with its arguments, flags included.
+type command struct {
+	usage string
+	run   func(ctx context.Context, db connection.DBTX, args []string) error
+}
+
+var commands = map[string]command{
+	"import":  importCommand,
+	"reverse": reverseCommand,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	log := logger.New(os.Stderr, slog.LevelInfo)
+	slog.SetDefault(log)
+
+	db := connection.OpenConnection()
+	defer db.Close()
+
+	ctx := logger.WithContext(context.Background(), log)
+	ctx = reqmeta.With(ctx, reqmeta.Meta{
+		RequestID: reqmeta.NewID(),
+		Actor:     actor(),
+	})
+
+	if err := cmd.run(ctx, db, os.Args[2:]); err != nil {
+		log.Error("command failed", "command", os.Args[1], "error", err)
+		os.Exit(1)
+	}
+}
+
+// actor names the operator in the audit log.
+func actor() string {
+	current, err := user.Current()
+	if err != nil {
+		return "cli"
+	}
+	return "cli:" + current.Username
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: admin <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+
+	"simplebank/pkg/connection"
+	transferController "simplebank/pkg/controllers/transfer"
+)
+
+var reverseCommand = command{
+	usage: "give back all or part of a transfer to its sender",
+	run:   reverse,
+}
+
+func reverse(ctx context.Context, db connection.DBTX, args []string) error {
+	flags := flag.NewFlagSet("reverse", flag.ExitOnError)
+	transferID := flags.Int64("transfer", 0, "id of the transfer to reverse")
+	amount := flags.Int64("amount", 0, "amount to give back, defaults to what is left of the transfer")
+	reason := flags.String("reason", "", "why the transfer is reversed")
+	flags.Parse(args)
+
+	if *transferID <= 0 || *reason == "" || *amount < 0 {
+		flags.Usage()
+		return errors.New("-transfer and -reason are required, -amount can't be negative")
+	}
+
+	result, err := transferController.ReverseTransfer(ctx, db, transferController.ReverseTransferParams{
+		TransferID: *transferID,
+		Amount:     *amount,
+		Reason:     *reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
@@ -0,0 +1,14 @@
+CREATE TABLE "users" (
+  "username" varchar PRIMARY KEY,
+  "hashed_password" varchar NOT NULL,
+  "full_name" varchar NOT NULL,
+  "email" varchar UNIQUE NOT NULL,
+  "password_changed_at" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z',
+  "failed_login_attempts" int NOT NULL DEFAULT 0,
+  "first_failed_login_at" timestamptz,
+  "lockout_count" int NOT NULL DEFAULT 0,
+  "locked_until" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN "users"."lockout_count" IS 'consecutive lockouts, used to escalate the lockout duration';
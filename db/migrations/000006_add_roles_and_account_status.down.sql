@@ -0,0 +1,2 @@
+ALTER TABLE "accounts" DROP COLUMN IF EXISTS "status";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "role";
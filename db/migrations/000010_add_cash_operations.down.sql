@@ -0,0 +1,5 @@
+DELETE FROM entries WHERE account_id IN (SELECT id FROM accounts WHERE kind <> 'customer');
+DELETE FROM accounts WHERE kind <> 'customer';
+ALTER TABLE "entries" DROP COLUMN IF EXISTS "type";
+DROP INDEX IF EXISTS accounts_system_currency_idx;
+ALTER TABLE "accounts" DROP COLUMN IF EXISTS "kind";
@@ -0,0 +1,16 @@
+ALTER TABLE "accounts" ADD COLUMN "kind" varchar NOT NULL DEFAULT 'customer';
+
+ALTER TABLE "accounts" ADD CONSTRAINT "accounts_kind_check" CHECK ("kind" IN ('customer', 'settlement'));
+
+CREATE UNIQUE INDEX "accounts_system_currency_idx" ON "accounts" ("kind", "currency") WHERE "kind" <> 'customer';
+
+COMMENT ON COLUMN "accounts"."kind" IS 'settlement accounts hold the other side of deposits and withdrawals, one per currency';
+
+ALTER TABLE "entries" ADD COLUMN "type" varchar NOT NULL DEFAULT 'transfer';
+
+ALTER TABLE "entries" ADD CONSTRAINT "entries_type_check" CHECK ("type" IN ('transfer', 'deposit', 'withdrawal'));
+
+-- owned by a name no user can register, usernames are alphanumeric
+INSERT INTO "accounts" ("owner", "balance", "currency", "kind") VALUES
+  ('_system', 0, 'USD', 'settlement'),
+  ('_system', 0, 'EUR', 'settlement');
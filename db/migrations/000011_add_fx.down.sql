@@ -0,0 +1,9 @@
+DELETE FROM entries WHERE type = 'exchange';
+ALTER TABLE "entries" DROP CONSTRAINT "entries_type_check";
+ALTER TABLE "entries" ADD CONSTRAINT "entries_type_check" CHECK ("type" IN ('transfer', 'deposit', 'withdrawal'));
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "quote_id";
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "spread_bps";
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "exchange_rate";
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "to_amount";
+DROP TABLE IF EXISTS fx_quotes;
+DROP TABLE IF EXISTS exchange_rates;
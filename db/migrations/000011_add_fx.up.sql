@@ -0,0 +1,50 @@
+CREATE TABLE "exchange_rates" (
+  "id" bigserial PRIMARY KEY,
+  "base_currency" varchar NOT NULL,
+  "quote_currency" varchar NOT NULL,
+  "rate" numeric(20,10) NOT NULL CHECK ("rate" > 0),
+  "effective_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "exchange_rates" ("base_currency", "quote_currency", "effective_at");
+
+COMMENT ON COLUMN "exchange_rates"."rate" IS 'units of quote_currency for one unit of base_currency, mid-market';
+
+CREATE TABLE "fx_quotes" (
+  "id" varchar PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "from_currency" varchar NOT NULL,
+  "to_currency" varchar NOT NULL,
+  "from_amount" bigint NOT NULL,
+  "to_amount" bigint NOT NULL,
+  "rate" numeric(20,10) NOT NULL,
+  "spread_bps" bigint NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "fx_quotes" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+ALTER TABLE "transfers" ADD COLUMN "to_amount" bigint;
+
+UPDATE "transfers" SET "to_amount" = "amount";
+
+ALTER TABLE "transfers" ALTER COLUMN "to_amount" SET NOT NULL;
+
+ALTER TABLE "transfers" ADD COLUMN "exchange_rate" numeric(20,10);
+
+ALTER TABLE "transfers" ADD COLUMN "spread_bps" bigint;
+
+ALTER TABLE "transfers" ADD COLUMN "quote_id" varchar REFERENCES "fx_quotes" ("id");
+
+COMMENT ON COLUMN "transfers"."to_amount" IS 'credited in the currency of to_account, equal to amount unless exchanged';
+
+ALTER TABLE "entries" DROP CONSTRAINT "entries_type_check";
+
+ALTER TABLE "entries" ADD CONSTRAINT "entries_type_check" CHECK ("type" IN ('transfer', 'deposit', 'withdrawal', 'exchange'));
+
+INSERT INTO "exchange_rates" ("base_currency", "quote_currency", "rate", "effective_at") VALUES
+  ('USD', 'EUR', 0.92, now()),
+  ('EUR', 'USD', 1.087, now());
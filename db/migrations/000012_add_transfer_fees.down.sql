@@ -0,0 +1,10 @@
+DELETE FROM entries WHERE type = 'fee';
+DELETE FROM entries WHERE account_id IN (SELECT id FROM accounts WHERE kind = 'revenue');
+DELETE FROM accounts WHERE kind = 'revenue';
+DROP TABLE IF EXISTS fee_rules;
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "fee";
+ALTER TABLE "entries" DROP CONSTRAINT "entries_type_check";
+ALTER TABLE "entries" ADD CONSTRAINT "entries_type_check" CHECK ("type" IN ('transfer', 'deposit', 'withdrawal', 'exchange'));
+ALTER TABLE "accounts" DROP CONSTRAINT "accounts_kind_check";
+ALTER TABLE "accounts" ADD CONSTRAINT "accounts_kind_check" CHECK ("kind" IN ('customer', 'settlement'));
+ALTER TABLE "accounts" DROP COLUMN IF EXISTS "tier";
@@ -0,0 +1,38 @@
+ALTER TABLE "accounts" ADD COLUMN "tier" varchar NOT NULL DEFAULT 'standard';
+
+ALTER TABLE "accounts" ADD CONSTRAINT "accounts_tier_check" CHECK ("tier" IN ('standard', 'premium', 'business'));
+
+ALTER TABLE "accounts" DROP CONSTRAINT "accounts_kind_check";
+
+ALTER TABLE "accounts" ADD CONSTRAINT "accounts_kind_check" CHECK ("kind" IN ('customer', 'settlement', 'revenue'));
+
+ALTER TABLE "entries" DROP CONSTRAINT "entries_type_check";
+
+ALTER TABLE "entries" ADD CONSTRAINT "entries_type_check" CHECK ("type" IN ('transfer', 'deposit', 'withdrawal', 'exchange', 'fee'));
+
+ALTER TABLE "transfers" ADD COLUMN "fee" bigint NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "transfers"."fee" IS 'charged to from_account on top of amount, posted to the revenue account';
+
+CREATE TABLE "fee_rules" (
+  "id" bigserial PRIMARY KEY,
+  "currency" varchar,
+  "tier" varchar,
+  "min_amount" bigint NOT NULL DEFAULT 0,
+  "flat_fee" bigint NOT NULL DEFAULT 0 CHECK ("flat_fee" >= 0),
+  "percent_bps" bigint NOT NULL DEFAULT 0 CHECK ("percent_bps" >= 0 AND "percent_bps" < 10000),
+  "min_fee" bigint NOT NULL DEFAULT 0 CHECK ("min_fee" >= 0),
+  "max_fee" bigint CHECK ("max_fee" >= "min_fee"),
+  "waived" boolean NOT NULL DEFAULT false,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN "fee_rules"."currency" IS 'NULL matches every currency';
+
+COMMENT ON COLUMN "fee_rules"."tier" IS 'NULL matches every tier';
+
+COMMENT ON COLUMN "fee_rules"."min_amount" IS 'the rule applies to transfers of at least this amount, rules with a higher threshold win';
+
+INSERT INTO "accounts" ("owner", "balance", "currency", "kind") VALUES
+  ('_system', 0, 'USD', 'revenue'),
+  ('_system', 0, 'EUR', 'revenue');
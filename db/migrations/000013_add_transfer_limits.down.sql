@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS transfers_from_account_id_created_at_idx;
+DROP TABLE IF EXISTS transfer_limits;
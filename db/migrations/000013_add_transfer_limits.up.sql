@@ -0,0 +1,23 @@
+CREATE TABLE "transfer_limits" (
+  "id" bigserial PRIMARY KEY,
+  "currency" varchar NOT NULL,
+  "tier" varchar NOT NULL,
+  "max_transfer" bigint CHECK ("max_transfer" > 0),
+  "daily_limit" bigint CHECK ("daily_limit" > 0),
+  "monthly_limit" bigint CHECK ("monthly_limit" > 0),
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz NOT NULL DEFAULT (now()),
+  UNIQUE ("currency", "tier")
+);
+
+COMMENT ON TABLE "transfer_limits" IS 'a NULL limit, or no row for the currency and tier, means unlimited';
+
+CREATE INDEX ON "transfers" ("from_account_id", "created_at");
+
+INSERT INTO "transfer_limits" ("currency", "tier", "max_transfer", "daily_limit", "monthly_limit") VALUES
+  ('USD', 'standard', 1000000, 2000000, 10000000),
+  ('EUR', 'standard', 1000000, 2000000, 10000000),
+  ('USD', 'premium', 5000000, 10000000, 50000000),
+  ('EUR', 'premium', 5000000, 10000000, 50000000),
+  ('USD', 'business', 25000000, 50000000, 250000000),
+  ('EUR', 'business', 25000000, 50000000, 250000000);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS holds;
+ALTER TABLE "accounts" DROP COLUMN IF EXISTS "held_amount";
@@ -0,0 +1,51 @@
+CREATE TABLE "scheduled_transfers" (
+  "id" bigserial PRIMARY KEY,
+  "owner" varchar NOT NULL,
+  "from_account_id" bigint NOT NULL REFERENCES "accounts" ("id"),
+  "to_account_id" bigint NOT NULL REFERENCES "accounts" ("id"),
+  "amount" bigint NOT NULL CHECK ("amount" > 0),
+  "frequency" varchar NOT NULL DEFAULT 'once',
+  "start_at" timestamptz NOT NULL,
+  "end_at" timestamptz,
+  "max_runs" int CHECK ("max_runs" > 0),
+  "runs" int NOT NULL DEFAULT 0,
+  "attempts" int NOT NULL DEFAULT 0,
+  "next_run_at" timestamptz,
+  "status" varchar NOT NULL DEFAULT 'active',
+  "last_error" varchar,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "scheduled_transfers" ADD FOREIGN KEY ("owner") REFERENCES "users" ("username");
+
+ALTER TABLE "scheduled_transfers" ADD CONSTRAINT "scheduled_transfers_frequency_check" CHECK ("frequency" IN ('once', 'daily', 'weekly', 'monthly'));
+
+ALTER TABLE "scheduled_transfers" ADD CONSTRAINT "scheduled_transfers_status_check" CHECK ("status" IN ('active', 'paused', 'completed', 'failed', 'cancelled'));
+
+COMMENT ON COLUMN "scheduled_transfers"."runs" IS 'occurrences done, successful or given up on';
+
+COMMENT ON COLUMN "scheduled_transfers"."attempts" IS 'failed attempts at the current occurrence';
+
+COMMENT ON COLUMN "scheduled_transfers"."next_run_at" IS 'when the scheduler next tries, later than the occurrence while retrying';
+
+CREATE INDEX ON "scheduled_transfers" ("owner");
+
+CREATE INDEX ON "scheduled_transfers" ("next_run_at") WHERE "status" = 'active';
+
+CREATE TABLE "scheduled_transfer_runs" (
+  "id" bigserial PRIMARY KEY,
+  "scheduled_transfer_id" bigint NOT NULL REFERENCES "scheduled_transfers" ("id"),
+  "occurrence" int NOT NULL,
+  "scheduled_for" timestamptz NOT NULL,
+  "attempt" int NOT NULL,
+  "status" varchar NOT NULL,
+  "transfer_id" bigint REFERENCES "transfers" ("id"),
+  "error" varchar,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "scheduled_transfer_runs" ADD CONSTRAINT "scheduled_transfer_runs_status_check" CHECK ("status" IN ('succeeded', 'failed'));
+
+-- an occurrence can't be paid twice, whatever the scheduler does
+CREATE UNIQUE INDEX ON "scheduled_transfer_runs" ("scheduled_transfer_id", "occurrence") WHERE "status" = 'succeeded';
@@ -0,0 +1,6 @@
+DELETE FROM entries WHERE type = 'reversal';
+ALTER TABLE "entries" DROP CONSTRAINT "entries_type_check";
+ALTER TABLE "entries" ADD CONSTRAINT "entries_type_check" CHECK ("type" IN ('transfer', 'deposit', 'withdrawal', 'exchange', 'fee'));
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "reason";
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "reversed_amount";
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "reversal_of";
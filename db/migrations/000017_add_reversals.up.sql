@@ -0,0 +1,17 @@
+ALTER TABLE "transfers" ADD COLUMN "reversal_of" bigint REFERENCES "transfers" ("id");
+
+ALTER TABLE "transfers" ADD COLUMN "reversed_amount" bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE "transfers" ADD COLUMN "reason" varchar;
+
+ALTER TABLE "transfers" ADD CONSTRAINT "transfers_reversed_amount_check" CHECK ("reversed_amount" >= 0 AND "reversed_amount" <= "amount");
+
+COMMENT ON COLUMN "transfers"."reversal_of" IS 'the transfer this one gives money back for, it goes the other way';
+
+COMMENT ON COLUMN "transfers"."reversed_amount" IS 'sum of the reversals of this transfer';
+
+CREATE INDEX ON "transfers" ("reversal_of");
+
+ALTER TABLE "entries" DROP CONSTRAINT "entries_type_check";
+
+ALTER TABLE "entries" ADD CONSTRAINT "entries_type_check" CHECK ("type" IN ('transfer', 'deposit', 'withdrawal', 'exchange', 'fee', 'reversal'));
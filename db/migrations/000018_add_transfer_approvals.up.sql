@@ -0,0 +1,33 @@
+CREATE TABLE "transfer_approvals" (
+  "id" bigserial PRIMARY KEY,
+  "hold_id" bigint NOT NULL REFERENCES "holds" ("id"),
+  "initiator" varchar NOT NULL,
+  "from_account_id" bigint NOT NULL REFERENCES "accounts" ("id"),
+  "to_account_id" bigint NOT NULL REFERENCES "accounts" ("id"),
+  "amount" bigint NOT NULL CHECK ("amount" > 0),
+  "status" varchar NOT NULL DEFAULT 'pending_approval',
+  "decided_by" varchar,
+  "decision_reason" varchar,
+  "decided_at" timestamptz,
+  "transfer_id" bigint REFERENCES "transfers" ("id"),
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "transfer_approvals" ADD FOREIGN KEY ("initiator") REFERENCES "users" ("username");
+
+ALTER TABLE "transfer_approvals" ADD FOREIGN KEY ("decided_by") REFERENCES "users" ("username");
+
+ALTER TABLE "transfer_approvals" ADD CONSTRAINT "transfer_approvals_status_check" CHECK ("status" IN ('pending_approval', 'approved', 'rejected', 'expired'));
+
+-- maker-checker: nobody approves their own transfer
+ALTER TABLE "transfer_approvals" ADD CONSTRAINT "transfer_approvals_decided_by_check" CHECK ("decided_by" <> "initiator");
+
+COMMENT ON COLUMN "transfer_approvals"."hold_id" IS 'reserves the funds until the transfer is decided';
+
+CREATE UNIQUE INDEX ON "transfer_approvals" ("hold_id");
+
+CREATE INDEX ON "transfer_approvals" ("initiator");
+
+CREATE INDEX ON "transfer_approvals" ("expires_at") WHERE "status" = 'pending_approval';
@@ -0,0 +1,37 @@
+CREATE TABLE "transfer_batches" (
+  "id" bigserial PRIMARY KEY,
+  "owner" varchar NOT NULL,
+  "mode" varchar NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'processing',
+  "item_count" int NOT NULL,
+  "succeeded_count" int NOT NULL DEFAULT 0,
+  "failed_count" int NOT NULL DEFAULT 0,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "completed_at" timestamptz
+);
+
+ALTER TABLE "transfer_batches" ADD FOREIGN KEY ("owner") REFERENCES "users" ("username");
+
+ALTER TABLE "transfer_batches" ADD CONSTRAINT "transfer_batches_mode_check" CHECK ("mode" IN ('atomic', 'best_effort'));
+
+ALTER TABLE "transfer_batches" ADD CONSTRAINT "transfer_batches_status_check" CHECK ("status" IN ('processing', 'completed', 'partially_completed', 'failed'));
+
+CREATE INDEX ON "transfer_batches" ("owner");
+
+CREATE TABLE "transfer_batch_items" (
+  "id" bigserial PRIMARY KEY,
+  "batch_id" bigint NOT NULL REFERENCES "transfer_batches" ("id"),
+  "position" int NOT NULL,
+  "from_account_id" bigint NOT NULL,
+  "to_account_id" bigint NOT NULL,
+  "amount" bigint NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'pending',
+  "transfer_id" bigint REFERENCES "transfers" ("id"),
+  "error" varchar
+);
+
+ALTER TABLE "transfer_batch_items" ADD CONSTRAINT "transfer_batch_items_status_check" CHECK ("status" IN ('pending', 'succeeded', 'failed', 'skipped'));
+
+COMMENT ON COLUMN "transfer_batch_items"."status" IS 'skipped items were not made because another item of an atomic batch failed';
+
+CREATE UNIQUE INDEX ON "transfer_batch_items" ("batch_id", "position");
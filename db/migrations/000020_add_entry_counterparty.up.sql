@@ -0,0 +1,9 @@
+ALTER TABLE "entries" ADD COLUMN "transfer_id" bigint REFERENCES "transfers" ("id");
+
+ALTER TABLE "entries" ADD COLUMN "counterparty_account_id" bigint REFERENCES "accounts" ("id");
+
+COMMENT ON COLUMN "entries"."transfer_id" IS 'the transfer the entry books, null for cash and for entries made before the column';
+
+COMMENT ON COLUMN "entries"."counterparty_account_id" IS 'the account on the other side of the entry, null when there are many or for entries made before the column';
+
+CREATE INDEX ON "entries" ("account_id", "created_at");
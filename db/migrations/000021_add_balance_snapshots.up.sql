@@ -0,0 +1,11 @@
+CREATE TABLE "balance_snapshots" (
+  "id" bigserial PRIMARY KEY,
+  "account_id" bigint NOT NULL REFERENCES "accounts" ("id"),
+  "balance" bigint NOT NULL,
+  "taken_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN "balance_snapshots"."balance" IS 'sum of the entries of the account created up to taken_at';
+
+CREATE UNIQUE INDEX ON "balance_snapshots" ("account_id", "taken_at");
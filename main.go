@@ -1,24 +1,106 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
 	"simplebank/api"
 	"simplebank/pkg/connection"
+	accountController "simplebank/pkg/controllers/account"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/jobs"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/metrics"
+	"simplebank/pkg/tracing"
+	"simplebank/pkg/util"
+	"syscall"
+	"time"
 )
 
-var addressServer = "0.0.0.0:8080"
+const (
+	shutdownDrain   = 5 * time.Second
+	shutdownTimeout = 30 * time.Second
+)
 
 func main() {
+	log := logger.New(os.Stdout, slog.LevelInfo)
+	slog.SetDefault(log)
+
+	config := util.LoadConfig()
+	if err := config.Validate(); err != nil {
+		log.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		ServiceName: "simplebank",
+		Exporter:    config.TracingExporter,
+	})
+	if err != nil {
+		log.Error("cannot init tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
 
 	db := connection.OpenConnection()
 	defer db.Close()
 
-	server := api.NewServer(db)
+	if err := metrics.RegisterDB(db.DB, "simple_bank"); err != nil {
+		log.Error("cannot register db metrics", "error", err)
+		os.Exit(1)
+	}
+
+	server, err := api.NewServer(config, db, log)
+	if err != nil {
+		log.Error("cannot create server", "error", err)
+		os.Exit(1)
+	}
+
+	jobsCtx, stopJobs := context.WithCancel(logger.WithContext(context.Background(), log))
+	defer stopJobs()
+	go jobs.Run(jobsCtx, "expire_holds", config.HoldSweepInterval, func(ctx context.Context) error {
+		_, err := transferController.ExpireHolds(ctx, db)
+		return err
+	})
+	go jobs.Run(jobsCtx, "expire_transfer_approvals", config.HoldSweepInterval, func(ctx context.Context) error {
+		_, err := transferController.ExpireTransferApprovals(ctx, db)
+		return err
+	})
+	go jobs.Run(jobsCtx, "scheduled_transfers", config.ScheduledTransferInterval, func(ctx context.Context) error {
+		_, err := transferController.RunDueScheduledTransfers(ctx, db, transferController.RetryPolicy{
+			MaxAttempts: config.ScheduledTransferMaxAttempts,
+			Delay:       config.ScheduledTransferRetryDelay,
+		})
+		return err
+	})
+	go jobs.Run(jobsCtx, "balance_snapshots", config.BalanceSnapshotInterval, func(ctx context.Context) error {
+		_, err := accountController.TakeBalanceSnapshots(ctx, db, time.Now().Add(-accountController.BalanceSnapshotLag))
+		return err
+	})
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		<-stop
+		stopJobs()
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx, shutdownDrain); err != nil {
+			log.Error("cannot shutdown server", "error", err)
+		}
+	}()
 
-	err := server.Start(addressServer)
+	err = server.Start(config.ServerAddress)
 	if err != nil {
-		log.Fatal("cannot start server", err)
+		log.Error("cannot start server", "error", err)
+		os.Exit(1)
 	}
+	<-shutdownDone
 
-	log.Println("Connection Closed!")
+	log.Info("Connection Closed!")
 }
@@ -1,23 +1,239 @@
 package connection
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"sync"
 
+	"github.com/XSAM/otelsql"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"simplebank/pkg/metrics"
+	"simplebank/pkg/tracing"
 )
 
+// DBTX is satisfied by both *sqlx.DB and *sqlx.Tx, so controllers can run
+// standalone or as part of a bigger transaction.
+type DBTX interface {
+	sqlx.ExtContext
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 func OpenConnection() *sqlx.DB {
-	db, err := sqlx.Open("postgres", "user=root password=secret dbname=simple_bank sslmode=disable")
+	conn, err := otelsql.Open("postgres", "user=root password=secret dbname=simple_bank sslmode=disable",
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+	)
 	if err != nil {
-		log.Fatalln(err)
+		slog.Error("cannot open db", "error", err)
+		os.Exit(1)
 	}
+	db := sqlx.NewDb(conn, "postgres")
 
 	err = db.Ping()
 	if err != nil {
-		log.Fatalln(err)
+		slog.Error("cannot connect to db", "error", err)
+		os.Exit(1)
 	}
 
-	log.Println("Connected!")
+	slog.Info("connected to db")
 	return db
 }
+
+// SchemaVersion is the migration version this build expects the database to
+// be at. Bump it together with every new file in db/migrations.
+const SchemaVersion = 21
+
+// MigrationVersion returns the version recorded by golang-migrate and whether
+// the last migration left the schema dirty.
+func MigrationVersion(ctx context.Context, db DBTX) (int64, bool, error) {
+	query := `SELECT version, dirty FROM schema_migrations LIMIT 1`
+
+	var version int64
+	var dirty bool
+	err := db.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed retrieving migration version")
+	}
+
+	return version, dirty, nil
+}
+
+// maxTxAttempts bounds how many times ExecTx runs a transaction that keeps
+// failing with a serialization failure or deadlock.
+const maxTxAttempts = 3
+
+// ExecTx runs fn inside a transaction. When db is already a transaction fn
+// joins it, so the outermost caller decides when to commit and retry.
+func ExecTx(ctx context.Context, db DBTX, fn func(tx DBTX) error) error {
+	if tx, ok := db.(*sqlx.Tx); ok {
+		return fn(tx)
+	}
+
+	conn, ok := db.(*sqlx.DB)
+	if !ok {
+		return errors.Errorf("unsupported db handle %T", db)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "execTx", trace.WithAttributes(
+		attribute.String("db.isolation_level", sql.LevelDefault.String()),
+	))
+	defer span.End()
+
+	var err error
+	attempt := 1
+	for ; attempt <= maxTxAttempts; attempt++ {
+		err = execTx(ctx, conn, fn)
+		if err == nil || !isRetryable(err) || attempt == maxTxAttempts {
+			break
+		}
+		metrics.TxRetries.Inc()
+		span.AddEvent("retry", trace.WithAttributes(attribute.String("error", err.Error())))
+	}
+	span.SetAttributes(
+		attribute.Int("db.tx.attempts", attempt),
+		attribute.Int("db.tx.retries", attempt-1),
+	)
+	if err != nil {
+		metrics.TxFailures.Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "transaction failed")
+	}
+
+	return err
+}
+
+func execTx(ctx context.Context, conn *sqlx.DB, fn func(tx DBTX) error) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed begin transaction")
+	}
+	commitHooks.begin(tx)
+
+	err = fn(tx)
+	if err != nil {
+		commitHooks.end(tx)
+		if rtx := tx.Rollback(); rtx != nil {
+			return errors.Wrapf(err, "failed tx err: %v, rtx err: %v", err, rtx)
+		}
+		return errors.Wrap(err, "failed transaction")
+	}
+
+	hooks := commitHooks.end(tx)
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
+
+// AfterCommit runs fn once the transaction started by ExecTx that tx belongs
+// to commits, and never when it rolls back. Work that must only happen for
+// committed data, like counting transfers, goes there so that a transfer
+// joining a bigger transaction isn't counted when the latter fails. Outside
+// of such a transaction fn runs right away.
+func AfterCommit(tx DBTX, fn func()) {
+	if !commitHooks.add(tx, fn) {
+		fn()
+	}
+}
+
+var commitHooks = hookRegistry{hooks: map[*sqlx.Tx][]func(){}}
+
+// hookRegistry keeps the AfterCommit hooks of the transactions in flight.
+type hookRegistry struct {
+	mu    sync.Mutex
+	hooks map[*sqlx.Tx][]func()
+}
+
+func (registry *hookRegistry) begin(tx *sqlx.Tx) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.hooks[tx] = nil
+}
+
+// end forgets tx and returns its hooks in the order they were added.
+func (registry *hookRegistry) end(tx *sqlx.Tx) []func() {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	hooks := registry.hooks[tx]
+	delete(registry.hooks, tx)
+	return hooks
+}
+
+func (registry *hookRegistry) add(db DBTX, fn func()) bool {
+	tx, ok := db.(*sqlx.Tx)
+	if !ok {
+		return false
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	hooks, ok := registry.hooks[tx]
+	if !ok {
+		return false
+	}
+	registry.hooks[tx] = append(hooks, fn)
+	return true
+}
+
+// mark returns how many hooks tx has, for truncate to drop the ones added
+// after it.
+func (registry *hookRegistry) mark(db DBTX) int {
+	tx, _ := db.(*sqlx.Tx)
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return len(registry.hooks[tx])
+}
+
+func (registry *hookRegistry) truncate(db DBTX, mark int) {
+	tx, _ := db.(*sqlx.Tx)
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if hooks, ok := registry.hooks[tx]; ok && len(hooks) > mark {
+		registry.hooks[tx] = hooks[:mark]
+	}
+}
+
+// ExecSavepoint runs fn inside a savepoint of tx. When fn fails only its
+// work is rolled back and tx can go on, to record the failure for example.
+// The AfterCommit hooks fn added are dropped with it.
+func ExecSavepoint(ctx context.Context, tx DBTX, fn func(tx DBTX) error) error {
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT exec_savepoint`); err != nil {
+		return errors.Wrap(err, "failed savepoint")
+	}
+
+	mark := commitHooks.mark(tx)
+	err := fn(tx)
+	if err != nil {
+		commitHooks.truncate(tx, mark)
+		if _, rsp := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT exec_savepoint`); rsp != nil {
+			return errors.Wrapf(err, "failed savepoint err: %v, rollback err: %v", err, rsp)
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT exec_savepoint`)
+	return errors.Wrap(err, "failed release savepoint")
+}
+
+// isRetryable reports whether err is a serialization failure or a deadlock,
+// both of which succeed when the transaction is simply run again.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
@@ -3,18 +3,48 @@ package controllers
 import (
 	"context"
 	"database/sql"
-	"log"
+	"sort"
 
-	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/logger"
 	"simplebank/pkg/models"
 )
 
+const accountColumns = `id, owner, balance, currency, status, kind, tier, overdraft_limit, held_amount, created_at`
+
+// Account statuses, only active accounts can send or receive money.
+const (
+	StatusActive = "active"
+	StatusFrozen = "frozen"
+	StatusClosed = "closed"
+)
+
+// Account kinds. Each currency has one settlement account that takes the
+// other side of deposits and withdrawals so the entries always sum to zero,
+// and one revenue account collecting the fees.
+const (
+	KindCustomer   = "customer"
+	KindSettlement = "settlement"
+	KindRevenue    = "revenue"
+)
+
+// Account tiers, fee rules can target a tier.
+const (
+	TierStandard = "standard"
+	TierPremium  = "premium"
+	TierBusiness = "business"
+)
+
 type (
 	ListAccountParams struct {
-		Limit  int32 `db:"limit" json:"limit"`
-		Offset int32 `db:"offset" json:"offset"`
+		// Owner restricts the list to the accounts of one owner when set.
+		Owner  string `db:"owner" json:"owner"`
+		Limit  int32  `db:"limit" json:"limit"`
+		Offset int32  `db:"offset" json:"offset"`
 	}
 
 	CreateAccountParams struct {
@@ -27,37 +57,109 @@ type (
 		Id      int64 `db:"id" json:"id"`
 		Balance int64 `db:"balance" json:"balance"`
 	}
-)
 
-func CreateAccount(ctx context.Context, db *sqlx.DB, account CreateAccountParams) (*models.Account, error) {
-	query := `INSERT INTO accounts ("owner", "currency", "balance") VALUES ($1, $2, $3) RETURNING *`
+	UpdateAccountStatusParams struct {
+		Id     int64  `db:"id" json:"id"`
+		Status string `db:"status" json:"status"`
+	}
 
-	var res models.Account
-	row, err := db.QueryContext(ctx, query, account.Owner, account.Currency, account.Balance)
-	if err == sql.ErrNoRows {
-		return &res, nil
+	UpdateAccountTierParams struct {
+		Id   int64  `db:"id" json:"id"`
+		Tier string `db:"tier" json:"tier"`
 	}
-	if err != nil {
-		return &res, errors.Wrap(err, "failed insert")
+
+	UpdateOverdraftLimitParams struct {
+		Id             int64 `db:"id" json:"id"`
+		OverdraftLimit int64 `db:"overdraft_limit" json:"overdraft_limit"`
 	}
+)
 
-	defer row.Close()
-	for row.Next() {
-		err := row.Scan(&res.Id, &res.Owner, &res.Balance, &res.Currency, &res.CreatedAt)
+func CreateAccount(ctx context.Context, db connection.DBTX, account CreateAccountParams) (*models.Account, error) {
+	query := `INSERT INTO accounts ("owner", "currency", "balance") VALUES ($1, $2, $3) RETURNING ` + accountColumns
+
+	var res models.Account
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		err := scanAccount(tx.QueryRowContext(ctx, query, account.Owner, account.Currency, account.Balance), &res)
 		if err != nil {
-			return &res, errors.Wrap(err, "failed row scan")
+			return errors.Wrap(err, "failed insert")
 		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "account.create",
+			EntityType: "account",
+			EntityID:   res.Id,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
 	}
 
 	// log.Println("Account created")
 	return &res, nil
 }
 
-func GetAccountByID(ctx context.Context, db *sqlx.DB, id int64) (*models.Account, error) {
-	query := `SELECT * FROM accounts WHERE id = $1 LIMIT 1`
+// CreateAccounts opens several accounts in one statement, for bulk loads.
+// The accounts are returned in the order of accounts.
+func CreateAccounts(ctx context.Context, db connection.DBTX, accounts []CreateAccountParams) ([]models.Account, error) {
+	query := `INSERT INTO accounts ("owner", "currency", "balance")
+		SELECT account.owner, account.currency, account.balance
+		FROM unnest($1::varchar[], $2::varchar[], $3::bigint[]) WITH ORDINALITY AS account(owner, currency, balance, position)
+		ORDER BY account.position
+		RETURNING ` + accountColumns
+
+	owners := make([]string, len(accounts))
+	currencies := make([]string, len(accounts))
+	balances := make([]int64, len(accounts))
+	for i, account := range accounts {
+		owners[i], currencies[i], balances[i] = account.Owner, account.Currency, account.Balance
+	}
+
+	res := make([]models.Account, 0, len(accounts))
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		res = res[:0]
+		rows, err := tx.QueryContext(ctx, query, pq.StringArray(owners), pq.StringArray(currencies), pq.Int64Array(balances))
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var account models.Account
+			if err := scanAccount(rows, &account); err != nil {
+				return errors.Wrap(err, "failed scanning the row")
+			}
+			res = append(res, account)
+		}
+		if err := rows.Err(); err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+		// ids are handed out in insertion order, RETURNING doesn't promise it
+		sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+
+		events := make([]auditController.CreateAuditEventParams, len(res))
+		for i, account := range res {
+			events[i] = auditController.CreateAuditEventParams{
+				Action:     "account.create",
+				EntityType: "account",
+				EntityID:   account.Id,
+				After:      account,
+			}
+		}
+		return auditController.CreateAuditEvents(ctx, tx, events)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func GetAccountByID(ctx context.Context, db connection.DBTX, id int64) (*models.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE id = $1 LIMIT 1`
 
 	var res models.Account
-	err := db.QueryRowContext(ctx, query, id).Scan(&res.Id, &res.Owner, &res.Balance, &res.Currency, &res.CreatedAt)
+	err := scanAccount(db.QueryRowContext(ctx, query, id), &res)
 	if err == sql.ErrNoRows {
 		return &res, errors.Wrap(err, "row not found")
 	}
@@ -68,34 +170,51 @@ func GetAccountByID(ctx context.Context, db *sqlx.DB, id int64) (*models.Account
 	return &res, nil
 }
 
-func GetAccountByIDForUpdate(ctx context.Context, db *sqlx.DB, id int64) (*models.Account, error) {
-	query := `SELECT * FROM accounts WHERE id = $1 LIMIT 1 FOR UPDATE;`
+func GetAccountByIDForUpdate(ctx context.Context, db connection.DBTX, id int64) (*models.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE id = $1 LIMIT 1 FOR UPDATE;`
 
 	var res models.Account
-	row, err := db.QueryContext(ctx, query, id)
+	err := scanAccount(db.QueryRowContext(ctx, query, id), &res)
 	if err == sql.ErrNoRows {
-		return &res, nil
+		return &res, errors.Wrap(err, "row not found")
 	}
 	if err != nil {
 		return &res, errors.Wrap(err, "failed retrieving the row")
 	}
 
-	defer row.Close()
-	for row.Next() {
-		err := row.Scan(&res.Id, &res.Owner, &res.Balance, &res.Currency, &res.CreatedAt)
-		if err != nil {
-			return &res, errors.Wrap(err, "failed row scan")
-		}
+	return &res, nil
+}
+
+// GetSettlementAccount returns the settlement account of currency.
+func GetSettlementAccount(ctx context.Context, db connection.DBTX, currency string) (*models.Account, error) {
+	return getSystemAccount(ctx, db, KindSettlement, currency)
+}
+
+// GetRevenueAccount returns the account collecting the fees in currency.
+func GetRevenueAccount(ctx context.Context, db connection.DBTX, currency string) (*models.Account, error) {
+	return getSystemAccount(ctx, db, KindRevenue, currency)
+}
+
+func getSystemAccount(ctx context.Context, db connection.DBTX, kind string, currency string) (*models.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE kind = $1 AND currency = $2 LIMIT 1`
+
+	var res models.Account
+	err := scanAccount(db.QueryRowContext(ctx, query, kind, currency), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
 	}
 
 	return &res, nil
 }
 
-func GetAccountAll(ctx context.Context, db *sqlx.DB, arg ListAccountParams) ([]models.Account, error) {
-	query := `SELECT * FROM accounts ORDER BY id LIMIT $1 OFFSET $2`
+func GetAccountAll(ctx context.Context, db connection.DBTX, arg ListAccountParams) ([]models.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE ($3 = '' OR owner = $3) ORDER BY id LIMIT $1 OFFSET $2`
 
 	var res []models.Account
-	rows, err := db.QueryContext(ctx, query, arg.Limit, arg.Offset)
+	rows, err := db.QueryContext(ctx, query, arg.Limit, arg.Offset, arg.Owner)
 	if err == sql.ErrNoRows {
 		return res, nil
 	}
@@ -106,7 +225,7 @@ func GetAccountAll(ctx context.Context, db *sqlx.DB, arg ListAccountParams) ([]m
 	defer rows.Close()
 	for rows.Next() {
 		var account models.Account
-		err := rows.Scan(&account.Id, &account.Owner, &account.Balance, &account.Currency, &account.CreatedAt)
+		err := scanAccount(rows, &account)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed rows scan")
 		}
@@ -117,50 +236,198 @@ func GetAccountAll(ctx context.Context, db *sqlx.DB, arg ListAccountParams) ([]m
 	return res, nil
 }
 
-func UpdateAccount(ctx context.Context, db *sqlx.DB, arg UpdateAccountParams) (*models.Account, error) {
-	query := `UPDATE accounts SET balance = $1 WHERE id = $2 RETURNING *`
+func UpdateAccount(ctx context.Context, db connection.DBTX, arg UpdateAccountParams) (*models.Account, error) {
+	query := `UPDATE accounts SET balance = $1 WHERE id = $2 RETURNING ` + accountColumns
 
 	var res models.Account
-	row, err := db.QueryContext(ctx, query, arg.Balance, arg.Id)
-	if err == sql.ErrNoRows {
-		return &res, nil
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := GetAccountByIDForUpdate(ctx, tx, arg.Id)
+		if err != nil {
+			return err
+		}
+
+		err = scanAccount(tx.QueryRowContext(ctx, query, arg.Balance, arg.Id), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "account.update",
+			EntityType: "account",
+			EntityID:   res.Id,
+			Before:     before,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
 	}
+
+	// log.Println("Account Updated")
+	return &res, nil
+}
+
+func UpdateAccountStatus(ctx context.Context, db connection.DBTX, arg UpdateAccountStatusParams) (*models.Account, error) {
+	query := `UPDATE accounts SET status = $1 WHERE id = $2 RETURNING ` + accountColumns
+
+	var res models.Account
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := GetAccountByIDForUpdate(ctx, tx, arg.Id)
+		if err != nil {
+			return err
+		}
+
+		err = scanAccount(tx.QueryRowContext(ctx, query, arg.Status, arg.Id), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "account.status",
+			EntityType: "account",
+			EntityID:   res.Id,
+			Before:     before,
+			After:      res,
+		})
+		return err
+	})
 	if err != nil {
-		return &res, errors.Wrap(err, "failed update")
+		return &res, err
 	}
 
-	defer row.Close()
-	for row.Next() {
-		err := row.Scan(&res.Id, &res.Owner, &res.Balance, &res.Currency, &res.CreatedAt)
+	logger.FromContext(ctx).Info("account status changed", "account_id", res.Id, "status", res.Status)
+	return &res, nil
+}
+
+func UpdateAccountTier(ctx context.Context, db connection.DBTX, arg UpdateAccountTierParams) (*models.Account, error) {
+	query := `UPDATE accounts SET tier = $1 WHERE id = $2 RETURNING ` + accountColumns
+
+	var res models.Account
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := GetAccountByIDForUpdate(ctx, tx, arg.Id)
+		if err != nil {
+			return err
+		}
+
+		err = scanAccount(tx.QueryRowContext(ctx, query, arg.Tier, arg.Id), &res)
 		if err != nil {
-			return &res, errors.Wrap(err, "failed scan")
+			return errors.Wrap(err, "failed update")
 		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "account.tier",
+			EntityType: "account",
+			EntityID:   res.Id,
+			Before:     before,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
 	}
 
-	// log.Println("Account Updated")
+	logger.FromContext(ctx).Info("account tier changed", "account_id", res.Id, "tier", res.Tier)
 	return &res, nil
 }
 
-func DeleteAccout(ctx context.Context, db *sqlx.DB, id int64) (int64, error) {
-	query := `DELETE FROM accounts WHERE id = $1 RETURNING id`
+// UpdateOverdraftLimit grants an overdraft, or revokes it with a limit of 0.
+// Revoking doesn't touch a balance that is already negative, it only stops
+// it from going lower.
+func UpdateOverdraftLimit(ctx context.Context, db connection.DBTX, arg UpdateOverdraftLimitParams) (*models.Account, error) {
+	query := `UPDATE accounts SET overdraft_limit = $1 WHERE id = $2 RETURNING ` + accountColumns
 
-	var res int64
-	row, err := db.QueryContext(ctx, query, id)
+	var res models.Account
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := GetAccountByIDForUpdate(ctx, tx, arg.Id)
+		if err != nil {
+			return err
+		}
+
+		err = scanAccount(tx.QueryRowContext(ctx, query, arg.OverdraftLimit, arg.Id), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "account.overdraft",
+			EntityType: "account",
+			EntityID:   res.Id,
+			Before:     before,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	logger.FromContext(ctx).Info("account overdraft changed", "account_id", res.Id, "overdraft_limit", res.OverdraftLimit)
+	return &res, nil
+}
+
+// AddHeldAmount reserves (positive amount) or releases (negative amount)
+// funds on an account the caller already locked.
+func AddHeldAmount(ctx context.Context, tx connection.DBTX, id int64, amount int64) (*models.Account, error) {
+	query := `UPDATE accounts SET held_amount = held_amount + $1 WHERE id = $2 RETURNING ` + accountColumns
+
+	var res models.Account
+	err := scanAccount(tx.QueryRowContext(ctx, query, amount, id), &res)
 	if err == sql.ErrNoRows {
-		return res, nil
+		return &res, errors.Wrap(err, "row not found")
 	}
 	if err != nil {
-		return res, errors.Wrap(err, "failed delete")
+		return &res, errors.Wrap(err, "failed update")
 	}
 
-	defer row.Close()
-	for row.Next() {
-		err := row.Scan(&res)
+	return &res, nil
+}
+
+func DeleteAccout(ctx context.Context, db connection.DBTX, id int64) (int64, error) {
+	query := `DELETE FROM accounts WHERE id = $1 RETURNING id`
+
+	var res int64
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := GetAccountByIDForUpdate(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, query, id).Scan(&res)
 		if err != nil {
-			return res, errors.Wrap(err, "failed scan")
+			return errors.Wrap(err, "failed delete")
 		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "account.delete",
+			EntityType: "account",
+			EntityID:   res,
+			Before:     before,
+		})
+		return err
+	})
+	if err != nil {
+		return res, err
 	}
 
-	log.Println("Account Deleted")
+	logger.FromContext(ctx).Info("account deleted", "account_id", res)
 	return res, nil
 }
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAccount also fills AvailableBalance, the balance less the funds
+// reserved by holds.
+func scanAccount(row scanner, account *models.Account) error {
+	err := row.Scan(&account.Id, &account.Owner, &account.Balance, &account.Currency, &account.Status, &account.Kind,
+		&account.Tier, &account.OverdraftLimit, &account.HeldAmount, &account.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	account.AvailableBalance = account.Balance - account.HeldAmount
+	return nil
+}
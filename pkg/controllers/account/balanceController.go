@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"simplebank/pkg/connection"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const balanceSnapshotColumns = `id, account_id, balance, taken_at, created_at`
+
+// BalanceSnapshotLag is how far behind the clock the snapshot job asks for
+// snapshots. TakeBalanceSnapshots already stops short of the transactions
+// still running, the lag is a margin for the clocks of the server and the
+// database drifting apart.
+const BalanceSnapshotLag = 5 * time.Minute
+
+type BalanceAt struct {
+	AccountID int64     `json:"account_id"`
+	Currency  string    `json:"currency"`
+	At        time.Time `json:"at"`
+	Balance   int64     `json:"balance"`
+	// SnapshotAt is when the snapshot the balance was computed from was
+	// taken, nil when it was computed from every entry.
+	SnapshotAt *time.Time `json:"snapshot_at"`
+}
+
+// GetBalanceAt returns the balance of an account at a point in time, the sum
+// of its entries created up to at. The latest snapshot taken up to at is
+// the starting point, so only the entries since then are read.
+func GetBalanceAt(ctx context.Context, db connection.DBTX, accountID int64, at time.Time) (*BalanceAt, error) {
+	snapshotQuery := `SELECT ` + balanceSnapshotColumns + ` FROM balance_snapshots
+		WHERE account_id = $1 AND taken_at <= $2 ORDER BY taken_at DESC LIMIT 1`
+	entriesQuery := `SELECT COALESCE(SUM(amount), 0) FROM entries
+		WHERE account_id = $1 AND created_at > $2 AND created_at <= $3`
+
+	account, err := GetAccountByID(ctx, db, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := BalanceAt{AccountID: account.Id, Currency: account.Currency, At: at}
+	// the entries before the first snapshot are all read
+	since := time.Time{}
+
+	var snapshot models.BalanceSnapshot
+	err = scanBalanceSnapshot(db.QueryRowContext(ctx, snapshotQuery, account.Id, at), &snapshot)
+	switch {
+	case err == nil:
+		res.Balance, res.SnapshotAt, since = snapshot.Balance, &snapshot.TakenAt, snapshot.TakenAt
+	case err != sql.ErrNoRows:
+		return nil, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	var sum int64
+	if err := db.QueryRowContext(ctx, entriesQuery, account.Id, since, at).Scan(&sum); err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the row")
+	}
+	res.Balance += sum
+
+	return &res, nil
+}
+
+// TakeBalanceSnapshots records the balance at of every account with entries
+// since its last snapshot, and returns how many snapshots were taken. Each
+// snapshot builds on the previous one of the account, so a run only reads
+// the entries booked since the last run.
+//
+// An entry is stamped when its transaction starts but only shows up when it
+// commits, so at is moved back to just before the oldest transaction still
+// running on the database. A snapshot never covers entries yet to commit.
+func TakeBalanceSnapshots(ctx context.Context, db connection.DBTX, at time.Time) (int64, error) {
+	watermarkQuery := `SELECT LEAST($1::timestamptz, MIN(xact_start) - interval '1 microsecond')
+		FROM pg_stat_activity
+		WHERE datname = current_database() AND pid <> pg_backend_pid() AND xact_start IS NOT NULL`
+	query := `INSERT INTO balance_snapshots ("account_id", "balance", "taken_at")
+		SELECT a.id, COALESCE(s.balance, 0) + COALESCE(e.sum, 0), $1
+		FROM accounts a
+		LEFT JOIN LATERAL (
+			SELECT balance, taken_at FROM balance_snapshots
+			WHERE account_id = a.id AND taken_at <= $1 ORDER BY taken_at DESC LIMIT 1
+		) s ON true
+		JOIN LATERAL (
+			SELECT SUM(amount) AS sum, COUNT(*) AS count FROM entries
+			WHERE account_id = a.id AND created_at > COALESCE(s.taken_at, '-infinity') AND created_at <= $1
+		) e ON e.count > 0
+		ON CONFLICT ("account_id", "taken_at") DO NOTHING`
+
+	if err := db.QueryRowContext(ctx, watermarkQuery, at).Scan(&at); err != nil {
+		return 0, errors.Wrap(err, "failed retrieving the watermark")
+	}
+
+	result, err := db.ExecContext(ctx, query, at)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed insert")
+	}
+	taken, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed insert")
+	}
+
+	if taken > 0 {
+		logger.FromContext(ctx).Info("balance snapshots taken", "count", taken, "at", at)
+	}
+	return taken, nil
+}
+
+func scanBalanceSnapshot(row scanner, snapshot *models.BalanceSnapshot) error {
+	return row.Scan(&snapshot.Id, &snapshot.AccountID, &snapshot.Balance, &snapshot.TakenAt, &snapshot.CreatedAt)
+}
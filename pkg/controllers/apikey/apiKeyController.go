@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+)
+
+const apiKeyColumns = `id, username, name, prefix, secret_hash, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+// lastUsedResolution limits how often last_used_at is written for a busy key.
+const lastUsedResolution = time.Minute
+
+type (
+	CreateAPIKeyParams struct {
+		Username   string     `json:"username"`
+		Name       string     `json:"name"`
+		Prefix     string     `json:"prefix"`
+		SecretHash string     `json:"secret_hash"`
+		Scopes     []string   `json:"scopes"`
+		ExpiresAt  *time.Time `json:"expires_at"`
+	}
+
+	RotateAPIKeyParams struct {
+		Id         int64  `json:"id"`
+		Prefix     string `json:"prefix"`
+		SecretHash string `json:"secret_hash"`
+	}
+)
+
+func CreateAPIKey(ctx context.Context, db connection.DBTX, args CreateAPIKeyParams) (*models.APIKey, error) {
+	var res models.APIKey
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		key, err := insertAPIKey(ctx, tx, args)
+		if err != nil {
+			return err
+		}
+		res = *key
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "api_key.create",
+			EntityType: "api_key",
+			EntityID:   res.Id,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+func GetAPIKey(ctx context.Context, db connection.DBTX, id int64) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = $1 LIMIT 1`
+
+	var res models.APIKey
+	err := scanAPIKey(db.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+func GetAPIKeyByPrefix(ctx context.Context, db connection.DBTX, prefix string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix = $1 LIMIT 1`
+
+	var res models.APIKey
+	err := scanAPIKey(db.QueryRowContext(ctx, query, prefix), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// ListAPIKeys returns every key of username, revoked ones included.
+func ListAPIKeys(ctx context.Context, db connection.DBTX, username string) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE username = $1 ORDER BY id`
+
+	rows, err := db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	res := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		res = append(res, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+
+	return res, nil
+}
+
+// IsUsable reports whether key can authenticate requests at the given time.
+func IsUsable(key *models.APIKey, now time.Time) bool {
+	if key.RevokedAt != nil {
+		return false
+	}
+	return key.ExpiresAt == nil || key.ExpiresAt.After(now)
+}
+
+// RevokeAPIKey disables a key for good. Revoking a key that is already
+// revoked fails with sql.ErrNoRows.
+func RevokeAPIKey(ctx context.Context, db connection.DBTX, id int64) (*models.APIKey, error) {
+	var res models.APIKey
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		key, err := revokeAPIKey(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		res = *key
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "api_key.revoke",
+			EntityType: "api_key",
+			EntityID:   id,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	logger.FromContext(ctx).Info("api key revoked", "key_id", id, "username", res.Username)
+	return &res, nil
+}
+
+// RotateAPIKey revokes a key and replaces it with a new one that has the
+// same owner, name, scopes and expiry but a new prefix and secret.
+func RotateAPIKey(ctx context.Context, db connection.DBTX, args RotateAPIKeyParams) (*models.APIKey, error) {
+	var res models.APIKey
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		old, err := revokeAPIKey(ctx, tx, args.Id)
+		if err != nil {
+			return err
+		}
+
+		key, err := insertAPIKey(ctx, tx, CreateAPIKeyParams{
+			Username:   old.Username,
+			Name:       old.Name,
+			Prefix:     args.Prefix,
+			SecretHash: args.SecretHash,
+			Scopes:     old.Scopes,
+			ExpiresAt:  old.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		res = *key
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "api_key.rotate",
+			EntityType: "api_key",
+			EntityID:   args.Id,
+			Before:     old,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	logger.FromContext(ctx).Info("api key rotated", "key_id", args.Id, "new_key_id", res.Id, "username", res.Username)
+	return &res, nil
+}
+
+// TouchAPIKey records that the key was just used.
+func TouchAPIKey(ctx context.Context, db connection.DBTX, id int64) error {
+	query := `UPDATE api_keys SET last_used_at = now()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - $2 * interval '1 second')`
+
+	_, err := db.ExecContext(ctx, query, id, lastUsedResolution.Seconds())
+	if err != nil {
+		return errors.Wrap(err, "failed update")
+	}
+
+	return nil
+}
+
+func insertAPIKey(ctx context.Context, tx connection.DBTX, args CreateAPIKeyParams) (*models.APIKey, error) {
+	query := `INSERT INTO api_keys ("username", "name", "prefix", "secret_hash", "scopes", "expires_at")
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING ` + apiKeyColumns
+
+	var res models.APIKey
+	err := scanAPIKey(tx.QueryRowContext(ctx, query,
+		args.Username, args.Name, args.Prefix, args.SecretHash, pq.StringArray(args.Scopes), args.ExpiresAt,
+	), &res)
+	if err != nil {
+		return &res, errors.Wrap(err, "failed insert")
+	}
+
+	return &res, nil
+}
+
+func revokeAPIKey(ctx context.Context, tx connection.DBTX, id int64) (*models.APIKey, error) {
+	query := `UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL RETURNING ` + apiKeyColumns
+
+	var res models.APIKey
+	err := scanAPIKey(tx.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed update")
+	}
+
+	return &res, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row scanner, key *models.APIKey) error {
+	return row.Scan(&key.Id, &key.Username, &key.Name, &key.Prefix, &key.SecretHash, &key.Scopes,
+		&key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt)
+}
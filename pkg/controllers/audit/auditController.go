@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"simplebank/pkg/connection"
+	"simplebank/pkg/models"
+	"simplebank/pkg/reqmeta"
+)
+
+type (
+	CreateAuditEventParams struct {
+		Action     string      `json:"action"`
+		EntityType string      `json:"entity_type"`
+		EntityID   interface{} `json:"entity_id"`
+		Before     interface{} `json:"before"`
+		After      interface{} `json:"after"`
+	}
+
+	ListAuditEventParams struct {
+		Actor      string       `json:"actor"`
+		Action     string       `json:"action"`
+		EntityType string       `json:"entity_type"`
+		EntityID   string       `json:"entity_id"`
+		From       sql.NullTime `json:"from"`
+		To         sql.NullTime `json:"to"`
+		Limit      int32        `json:"limit"`
+		Offset     int32        `json:"offset"`
+	}
+)
+
+// CreateAuditEvent appends an event to the audit log. The actor, request id
+// and client ip are taken from the request metadata stored in ctx. Callers
+// should pass the same tx they used for the change being audited.
+func CreateAuditEvent(ctx context.Context, db connection.DBTX, args CreateAuditEventParams) (*models.AuditEvent, error) {
+	query := `INSERT INTO audit_events ("actor", "action", "entity_type", "entity_id", "before", "after", "request_id", "client_ip")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, actor, action, entity_type, entity_id, before, after, request_id, client_ip, created_at`
+
+	meta := reqmeta.From(ctx)
+
+	before, err := marshalState(args.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := marshalState(args.After)
+	if err != nil {
+		return nil, err
+	}
+
+	var res models.AuditEvent
+	err = scanAuditEvent(db.QueryRowContext(ctx, query,
+		meta.Actor, args.Action, args.EntityType, fmt.Sprint(args.EntityID),
+		before, after, meta.RequestID, meta.ClientIP,
+	), &res)
+	if err != nil {
+		return &res, errors.Wrap(err, "failed insert")
+	}
+
+	return &res, nil
+}
+
+// CreateAuditEvents appends several events in one statement, for bulk
+// changes that would otherwise take a round trip per event. Like
+// CreateAuditEvent it takes the request metadata from ctx.
+func CreateAuditEvents(ctx context.Context, db connection.DBTX, events []CreateAuditEventParams) error {
+	query := `INSERT INTO audit_events ("actor", "action", "entity_type", "entity_id", "before", "after", "request_id", "client_ip")
+		SELECT $1, event.action, event.entity_type, event.entity_id, event.before, event.after, $2, $3
+		FROM unnest($4::varchar[], $5::varchar[], $6::varchar[], $7::jsonb[], $8::jsonb[])
+			AS event(action, entity_type, entity_id, before, after)`
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	meta := reqmeta.From(ctx)
+
+	actions := make([]string, len(events))
+	entityTypes := make([]string, len(events))
+	entityIDs := make([]string, len(events))
+	befores := make([]sql.NullString, len(events))
+	afters := make([]sql.NullString, len(events))
+	for i, event := range events {
+		before, err := marshalState(event.Before)
+		if err != nil {
+			return err
+		}
+		after, err := marshalState(event.After)
+		if err != nil {
+			return err
+		}
+
+		actions[i], entityTypes[i], entityIDs[i] = event.Action, event.EntityType, fmt.Sprint(event.EntityID)
+		befores[i] = sql.NullString{String: string(before), Valid: before != nil}
+		afters[i] = sql.NullString{String: string(after), Valid: after != nil}
+	}
+
+	_, err := db.ExecContext(ctx, query, meta.Actor, meta.RequestID, meta.ClientIP,
+		pq.StringArray(actions), pq.StringArray(entityTypes), pq.StringArray(entityIDs),
+		pq.GenericArray{A: befores}, pq.GenericArray{A: afters})
+	if err != nil {
+		return errors.Wrap(err, "failed insert")
+	}
+
+	return nil
+}
+
+func ListAuditEvents(ctx context.Context, db connection.DBTX, args ListAuditEventParams) ([]models.AuditEvent, error) {
+	query := `SELECT id, actor, action, entity_type, entity_id, before, after, request_id, client_ip, created_at
+		FROM audit_events
+		WHERE ($1 = '' OR actor = $1)
+		AND ($2 = '' OR action = $2)
+		AND ($3 = '' OR entity_type = $3)
+		AND ($4 = '' OR entity_id = $4)
+		AND ($5::timestamptz IS NULL OR created_at >= $5)
+		AND ($6::timestamptz IS NULL OR created_at < $6)
+		ORDER BY id LIMIT $7 OFFSET $8`
+
+	res := []models.AuditEvent{}
+	rows, err := db.QueryContext(ctx, query,
+		args.Actor, args.Action, args.EntityType, args.EntityID,
+		args.From, args.To, args.Limit, args.Offset,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := scanAuditEvent(rows, &event); err != nil {
+			return nil, errors.Wrap(err, "failed rows scan")
+		}
+
+		res = append(res, event)
+	}
+
+	return res, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAuditEvent(row scanner, event *models.AuditEvent) error {
+	var before, after []byte
+	err := row.Scan(&event.Id, &event.Actor, &event.Action, &event.EntityType, &event.EntityID,
+		&before, &after, &event.RequestID, &event.ClientIP, &event.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	event.Before = before
+	event.After = after
+	return nil
+}
+
+// marshalState encodes an entity snapshot, keeping nil as SQL NULL.
+func marshalState(state interface{}) ([]byte, error) {
+	if state == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed marshal audit state")
+	}
+	return b, nil
+}
@@ -3,18 +3,42 @@ package controllers
 import (
 	"context"
 	"database/sql"
-	"log"
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/logger"
 	"simplebank/pkg/models"
+	"sort"
 
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
+)
+
+const entryColumns = `id, account_id, amount, type, transfer_id, counterparty_account_id, created_at`
 
-	"github.com/jmoiron/sqlx"
+// Entry types, every entry of a transfer is a transfer entry while deposits
+// and withdrawals are booked against a settlement account. Exchange entries
+// are the settlement side of a transfer between currencies, fee entries
+// move a transfer fee to the revenue account and reversal entries give back
+// the money of a transfer.
+const (
+	TypeTransfer   = "transfer"
+	TypeDeposit    = "deposit"
+	TypeWithdrawal = "withdrawal"
+	TypeExchange   = "exchange"
+	TypeFee        = "fee"
+	TypeReversal   = "reversal"
 )
 
 type (
 	CreateEntryParams struct {
 		AccountID int64 `json:"account_id"`
 		Amount    int64 `json:"amount"`
+		// Type defaults to TypeTransfer.
+		Type string `json:"type"`
+		// TransferID and CounterpartyAccountID link the entry to what it
+		// books, for statements.
+		TransferID            *int64 `json:"transfer_id"`
+		CounterpartyAccountID *int64 `json:"counterparty_account_id"`
 	}
 
 	ListEntryParams struct {
@@ -28,32 +52,103 @@ type (
 	}
 )
 
-func CreateEntry(ctx context.Context, db *sqlx.DB, entry CreateEntryParams) (*models.Entry, error) {
-	query := `INSERT INTO entries ("account_id", "amount") VALUES ($1, $2) RETURNING *`
+func CreateEntry(ctx context.Context, db connection.DBTX, entry CreateEntryParams) (*models.Entry, error) {
+	query := `INSERT INTO entries ("account_id", "amount", "type", "transfer_id", "counterparty_account_id")
+		VALUES ($1, $2, $3, $4, $5) RETURNING ` + entryColumns
 
-	var res models.Entry
-	row, err := db.QueryContext(ctx, query, entry.AccountID, entry.Amount)
-	if err == sql.ErrNoRows {
-		return &res, nil
-	}
-	if err != nil {
-		return &res, errors.Wrap(err, "failed insert")
+	if entry.Type == "" {
+		entry.Type = TypeTransfer
 	}
 
-	defer row.Close()
-	for row.Next() {
-		err := row.Scan(&res.Id, &res.AccountID, &res.Amount, &res.CreatedAt)
+	var res models.Entry
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		err := scanEntry(tx.QueryRowContext(ctx, query, entry.AccountID, entry.Amount, entry.Type, entry.TransferID,
+			entry.CounterpartyAccountID), &res)
 		if err != nil {
-			return &res, errors.Wrap(err, "failed scan")
+			return errors.Wrap(err, "failed insert")
 		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "entry.create",
+			EntityType: "entry",
+			EntityID:   res.Id,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
 	}
 
 	// log.Println("Entry created")
 	return &res, nil
 }
 
-func GetEntryByID(ctx context.Context, db *sqlx.DB, id int64) (*models.Entry, error) {
-	query := `SELECT * FROM entries WHERE id = $1 LIMIT 1`
+// CreateEntries books several entries in one statement, for bulk loads. The
+// entries are returned in the order of entries.
+func CreateEntries(ctx context.Context, db connection.DBTX, entries []CreateEntryParams) ([]models.Entry, error) {
+	query := `INSERT INTO entries ("account_id", "amount", "type", "transfer_id", "counterparty_account_id")
+		SELECT entry.account_id, entry.amount, entry.type, entry.transfer_id, entry.counterparty_account_id
+		FROM unnest($1::bigint[], $2::bigint[], $3::varchar[], $4::bigint[], $5::bigint[])
+			WITH ORDINALITY AS entry(account_id, amount, type, transfer_id, counterparty_account_id, position)
+		ORDER BY entry.position
+		RETURNING ` + entryColumns
+
+	accountIDs := make([]int64, len(entries))
+	amounts := make([]int64, len(entries))
+	types := make([]string, len(entries))
+	transferIDs := make([]sql.NullInt64, len(entries))
+	counterparties := make([]sql.NullInt64, len(entries))
+	for i, entry := range entries {
+		if entry.Type == "" {
+			entry.Type = TypeTransfer
+		}
+		accountIDs[i], amounts[i], types[i] = entry.AccountID, entry.Amount, entry.Type
+		transferIDs[i], counterparties[i] = nullInt64(entry.TransferID), nullInt64(entry.CounterpartyAccountID)
+	}
+
+	res := make([]models.Entry, 0, len(entries))
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		res = res[:0]
+		rows, err := tx.QueryContext(ctx, query, pq.Int64Array(accountIDs), pq.Int64Array(amounts), pq.StringArray(types),
+			pq.GenericArray{A: transferIDs}, pq.GenericArray{A: counterparties})
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var entry models.Entry
+			if err := scanEntry(rows, &entry); err != nil {
+				return errors.Wrap(err, "failed scanning the row")
+			}
+			res = append(res, entry)
+		}
+		if err := rows.Err(); err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+		// ids are handed out in insertion order, RETURNING doesn't promise it
+		sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+
+		events := make([]auditController.CreateAuditEventParams, len(res))
+		for i, entry := range res {
+			events[i] = auditController.CreateAuditEventParams{
+				Action:     "entry.create",
+				EntityType: "entry",
+				EntityID:   entry.Id,
+				After:      entry,
+			}
+		}
+		return auditController.CreateAuditEvents(ctx, tx, events)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func GetEntryByID(ctx context.Context, db connection.DBTX, id int64) (*models.Entry, error) {
+	query := `SELECT ` + entryColumns + ` FROM entries WHERE id = $1 LIMIT 1`
 
 	var res models.Entry
 	row, err := db.QueryContext(ctx, query, id)
@@ -66,7 +161,7 @@ func GetEntryByID(ctx context.Context, db *sqlx.DB, id int64) (*models.Entry, er
 
 	defer row.Close()
 	for row.Next() {
-		err := row.Scan(&res.Id, &res.AccountID, &res.Amount, &res.CreatedAt)
+		err := scanEntry(row, &res)
 		if err != nil {
 			return &res, errors.Wrap(err, "failed scan")
 		}
@@ -75,8 +170,8 @@ func GetEntryByID(ctx context.Context, db *sqlx.DB, id int64) (*models.Entry, er
 	return &res, nil
 }
 
-func GetEntryAll(ctx context.Context, db *sqlx.DB, args ListEntryParams) (*[]models.Entry, error) {
-	query := `SELECT * FROM entries ORDER BY id LIMIT $1 OFFSET $2`
+func GetEntryAll(ctx context.Context, db connection.DBTX, args ListEntryParams) (*[]models.Entry, error) {
+	query := `SELECT ` + entryColumns + ` FROM entries ORDER BY id LIMIT $1 OFFSET $2`
 
 	var res []models.Entry
 	rows, err := db.QueryContext(ctx, query, args.Limit, args.Offset)
@@ -90,7 +185,7 @@ func GetEntryAll(ctx context.Context, db *sqlx.DB, args ListEntryParams) (*[]mod
 	defer rows.Close()
 	for rows.Next() {
 		var entry models.Entry
-		err := rows.Scan(&entry.Id, &entry.AccountID, &entry.Amount, &entry.CreatedAt)
+		err := scanEntry(rows, &entry)
 		if err != nil {
 			return &res, errors.Wrap(err, "failed scan")
 		}
@@ -101,50 +196,84 @@ func GetEntryAll(ctx context.Context, db *sqlx.DB, args ListEntryParams) (*[]mod
 	return &res, nil
 }
 
-func UpdateEntry(ctx context.Context, db *sqlx.DB, args UpdateEntryParams) (*models.Entry, error) {
-	query := `UPDATE entries SET amount = $1 WHERE id = $2 RETURNING *`
+func UpdateEntry(ctx context.Context, db connection.DBTX, args UpdateEntryParams) (*models.Entry, error) {
+	query := `UPDATE entries SET amount = $1 WHERE id = $2 RETURNING ` + entryColumns
 
 	var res models.Entry
-	row, err := db.QueryContext(ctx, query, args.Amount, args.Id)
-	if err == sql.ErrNoRows {
-		return &res, nil
-	}
-	if err != nil {
-		return &res, errors.Wrap(err, "failed update")
-	}
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := GetEntryByID(ctx, tx, args.Id)
+		if err != nil {
+			return err
+		}
 
-	defer row.Close()
-	for row.Next() {
-		err := row.Scan(&res.Id, &res.AccountID, &res.Amount, &res.CreatedAt)
+		err = scanEntry(tx.QueryRowContext(ctx, query, args.Amount, args.Id), &res)
 		if err != nil {
-			return &res, errors.Wrap(err, "failed scan")
+			return errors.Wrap(err, "failed update")
 		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "entry.update",
+			EntityType: "entry",
+			EntityID:   res.Id,
+			Before:     before,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
 	}
 
-	log.Println("Entry Updated")
+	logger.FromContext(ctx).Info("entry updated", "entry_id", res.Id)
 	return &res, nil
 }
 
-func DeleteEntry(ctx context.Context, db *sqlx.DB, id int64) (int64, error) {
+func DeleteEntry(ctx context.Context, db connection.DBTX, id int64) (int64, error) {
 	query := `DELETE FROM entries WHERE id = $1 RETURNING id`
 
 	var res int64
-	row, err := db.QueryContext(ctx, query, id)
-	if err == sql.ErrNoRows {
-		return res, errors.Wrap(err, "any record retrieved")
-	}
-	if err != nil {
-		return res, errors.Wrap(err, "failed delete")
-	}
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := GetEntryByID(ctx, tx, id)
+		if err != nil {
+			return err
+		}
 
-	defer row.Close()
-	for row.Next() {
-		err := row.Scan(&res)
+		err = tx.QueryRowContext(ctx, query, id).Scan(&res)
+		if err == sql.ErrNoRows {
+			return errors.Wrap(err, "any record retrieved")
+		}
 		if err != nil {
-			return res, errors.Wrap(err, "failed scan")
+			return errors.Wrap(err, "failed delete")
 		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "entry.delete",
+			EntityType: "entry",
+			EntityID:   res,
+			Before:     before,
+		})
+		return err
+	})
+	if err != nil {
+		return res, err
 	}
 
-	log.Println("Entry Deleted")
+	logger.FromContext(ctx).Info("entry deleted", "entry_id", res)
 	return res, nil
 }
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEntry(row scanner, entry *models.Entry) error {
+	return row.Scan(&entry.Id, &entry.AccountID, &entry.Amount, &entry.Type, &entry.TransferID, &entry.CounterpartyAccountID,
+		&entry.CreatedAt)
+}
+
+func nullInt64(n *int64) sql.NullInt64 {
+	if n == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *n, Valid: true}
+}
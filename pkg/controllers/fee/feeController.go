@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/models"
+)
+
+const feeRuleColumns = `id, currency, tier, min_amount, flat_fee, percent_bps, min_fee, max_fee, waived, created_at`
+
+type CreateFeeRuleParams struct {
+	Currency   *string `json:"currency"`
+	Tier       *string `json:"tier"`
+	MinAmount  int64   `json:"min_amount"`
+	FlatFee    int64   `json:"flat_fee"`
+	PercentBps int64   `json:"percent_bps"`
+	MinFee     int64   `json:"min_fee"`
+	MaxFee     *int64  `json:"max_fee"`
+	Waived     bool    `json:"waived"`
+}
+
+func CreateFeeRule(ctx context.Context, db connection.DBTX, args CreateFeeRuleParams) (*models.FeeRule, error) {
+	query := `INSERT INTO fee_rules ("currency", "tier", "min_amount", "flat_fee", "percent_bps", "min_fee", "max_fee", "waived")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING ` + feeRuleColumns
+
+	var res models.FeeRule
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		err := scanFeeRule(tx.QueryRowContext(ctx, query, args.Currency, args.Tier, args.MinAmount, args.FlatFee,
+			args.PercentBps, args.MinFee, args.MaxFee, args.Waived), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "fee_rule.create",
+			EntityType: "fee_rule",
+			EntityID:   res.Id,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+func ListFeeRules(ctx context.Context, db connection.DBTX) ([]models.FeeRule, error) {
+	query := `SELECT ` + feeRuleColumns + ` FROM fee_rules ORDER BY id`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	res := []models.FeeRule{}
+	for rows.Next() {
+		var rule models.FeeRule
+		if err := scanFeeRule(rows, &rule); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		res = append(res, rule)
+	}
+
+	return res, rows.Err()
+}
+
+func DeleteFeeRule(ctx context.Context, db connection.DBTX, id int64) error {
+	query := `DELETE FROM fee_rules WHERE id = $1 RETURNING ` + feeRuleColumns
+
+	return connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		var before models.FeeRule
+		err := scanFeeRule(tx.QueryRowContext(ctx, query, id), &before)
+		if err == sql.ErrNoRows {
+			return errors.Wrap(err, "row not found")
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed delete")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "fee_rule.delete",
+			EntityType: "fee_rule",
+			EntityID:   id,
+			Before:     before,
+		})
+		return err
+	})
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFeeRule(row scanner, rule *models.FeeRule) error {
+	return row.Scan(&rule.Id, &rule.Currency, &rule.Tier, &rule.MinAmount, &rule.FlatFee, &rule.PercentBps,
+		&rule.MinFee, &rule.MaxFee, &rule.Waived, &rule.CreatedAt)
+}
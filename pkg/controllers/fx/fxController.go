@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/models"
+)
+
+const exchangeRateColumns = `id, base_currency, quote_currency, rate, effective_at, created_at`
+
+const fxQuoteColumns = `id, username, from_currency, to_currency, from_amount, to_amount, rate, spread_bps, expires_at, used_at, created_at`
+
+// ErrQuoteUnavailable is returned when a quote is redeemed after it expired,
+// a second time or by someone else than the user it was given to.
+var ErrQuoteUnavailable = errors.New("quote is expired or already used")
+
+type (
+	CreateExchangeRateParams struct {
+		BaseCurrency  string    `json:"base_currency"`
+		QuoteCurrency string    `json:"quote_currency"`
+		Rate          string    `json:"rate"`
+		EffectiveAt   time.Time `json:"effective_at"`
+	}
+
+	CreateQuoteParams struct {
+		Id           string    `json:"id"`
+		Username     string    `json:"username"`
+		FromCurrency string    `json:"from_currency"`
+		ToCurrency   string    `json:"to_currency"`
+		FromAmount   int64     `json:"from_amount"`
+		ToAmount     int64     `json:"to_amount"`
+		Rate         string    `json:"rate"`
+		SpreadBps    int64     `json:"spread_bps"`
+		ExpiresAt    time.Time `json:"expires_at"`
+	}
+)
+
+// CreateExchangeRate records a rate taking effect at EffectiveAt. Rates are
+// never updated, a newer row supersedes the previous one.
+func CreateExchangeRate(ctx context.Context, db connection.DBTX, args CreateExchangeRateParams) (*models.ExchangeRate, error) {
+	query := `INSERT INTO exchange_rates ("base_currency", "quote_currency", "rate", "effective_at")
+		VALUES ($1, $2, $3, $4) RETURNING ` + exchangeRateColumns
+
+	var res models.ExchangeRate
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		err := scanExchangeRate(tx.QueryRowContext(ctx, query, args.BaseCurrency, args.QuoteCurrency, args.Rate, args.EffectiveAt), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "exchange_rate.create",
+			EntityType: "exchange_rate",
+			EntityID:   res.Id,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+// GetExchangeRate returns the rate from base to quote in effect at the given
+// time.
+func GetExchangeRate(ctx context.Context, db connection.DBTX, base string, quote string, at time.Time) (*models.ExchangeRate, error) {
+	query := `SELECT ` + exchangeRateColumns + ` FROM exchange_rates
+		WHERE base_currency = $1 AND quote_currency = $2 AND effective_at <= $3
+		ORDER BY effective_at DESC, id DESC LIMIT 1`
+
+	var res models.ExchangeRate
+	err := scanExchangeRate(db.QueryRowContext(ctx, query, base, quote, at), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// ListExchangeRates returns the rate of every currency pair in effect at the
+// given time.
+func ListExchangeRates(ctx context.Context, db connection.DBTX, at time.Time) ([]models.ExchangeRate, error) {
+	query := `SELECT DISTINCT ON (base_currency, quote_currency) ` + exchangeRateColumns + ` FROM exchange_rates
+		WHERE effective_at <= $1
+		ORDER BY base_currency, quote_currency, effective_at DESC, id DESC`
+
+	rows, err := db.QueryContext(ctx, query, at)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	res := []models.ExchangeRate{}
+	for rows.Next() {
+		var rate models.ExchangeRate
+		if err := scanExchangeRate(rows, &rate); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		res = append(res, rate)
+	}
+
+	return res, rows.Err()
+}
+
+func CreateQuote(ctx context.Context, db connection.DBTX, args CreateQuoteParams) (*models.FXQuote, error) {
+	query := `INSERT INTO fx_quotes ("id", "username", "from_currency", "to_currency", "from_amount", "to_amount", "rate", "spread_bps", "expires_at")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING ` + fxQuoteColumns
+
+	var res models.FXQuote
+	err := scanQuote(db.QueryRowContext(ctx, query, args.Id, args.Username, args.FromCurrency, args.ToCurrency,
+		args.FromAmount, args.ToAmount, args.Rate, args.SpreadBps, args.ExpiresAt), &res)
+	if err != nil {
+		return &res, errors.Wrap(err, "failed insert")
+	}
+
+	return &res, nil
+}
+
+func GetQuote(ctx context.Context, db connection.DBTX, id string) (*models.FXQuote, error) {
+	query := `SELECT ` + fxQuoteColumns + ` FROM fx_quotes WHERE id = $1 LIMIT 1`
+
+	var res models.FXQuote
+	err := scanQuote(db.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// ConsumeQuote marks the quote as used, it can only back one transfer. It
+// fails with ErrQuoteUnavailable unless the quote belongs to username, is
+// unused and hasn't expired.
+func ConsumeQuote(ctx context.Context, db connection.DBTX, id string, username string) (*models.FXQuote, error) {
+	query := `UPDATE fx_quotes SET used_at = now()
+		WHERE id = $1 AND username = $2 AND used_at IS NULL AND expires_at > now()
+		RETURNING ` + fxQuoteColumns
+
+	var res models.FXQuote
+	err := scanQuote(db.QueryRowContext(ctx, query, id, username), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrapf(ErrQuoteUnavailable, "quote [%s]", id)
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed update")
+	}
+
+	return &res, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanExchangeRate(row scanner, rate *models.ExchangeRate) error {
+	return row.Scan(&rate.Id, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate, &rate.EffectiveAt, &rate.CreatedAt)
+}
+
+func scanQuote(row scanner, quote *models.FXQuote) error {
+	return row.Scan(&quote.Id, &quote.Username, &quote.FromCurrency, &quote.ToCurrency, &quote.FromAmount, &quote.ToAmount,
+		&quote.Rate, &quote.SpreadBps, &quote.ExpiresAt, &quote.UsedAt, &quote.CreatedAt)
+}
@@ -0,0 +1,501 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"simplebank/pkg/connection"
+	accountController "simplebank/pkg/controllers/account"
+	entryController "simplebank/pkg/controllers/entry"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// DefaultChunkSize is how many rows are validated and loaded together when
+// ImportParams doesn't say.
+const DefaultChunkSize = 500
+
+// maxReportedErrors bounds the errors kept in a report, a file with a wrong
+// layout would otherwise fail on every line.
+const maxReportedErrors = 1000
+
+// Import kinds, the header of the file names the columns of each.
+const (
+	KindAccounts  = "accounts"
+	KindTransfers = "transfers"
+)
+
+// ErrInvalidImport is returned when the file can't be imported at all, like
+// when its header misses a column.
+var ErrInvalidImport = errors.New("invalid import file")
+
+type (
+	ImportParams struct {
+		// DryRun validates every row without loading any.
+		DryRun    bool `json:"dry_run"`
+		ChunkSize int  `json:"chunk_size"`
+	}
+
+	ImportError struct {
+		Line  int    `json:"line"`
+		Error string `json:"error"`
+	}
+
+	ImportReport struct {
+		Kind   string `json:"kind"`
+		DryRun bool   `json:"dry_run"`
+		// Rows counts the rows after the header, Valid those that passed
+		// validation and Imported those loaded. A dry run imports nothing.
+		Rows     int `json:"rows"`
+		Valid    int `json:"valid"`
+		Imported int `json:"imported"`
+		Failed   int `json:"failed"`
+		// Errors holds the first failures with their line in the file.
+		Errors []ImportError `json:"errors"`
+	}
+)
+
+// The rows of each kind, validated with the rules of the matching API
+// requests.
+type (
+	accountRow struct {
+		line     int
+		Owner    string `binding:"required,alphanum"`
+		Currency string `binding:"required,oneof=USD EUR"`
+		Balance  int64  `binding:"min=0"`
+	}
+
+	transferRow struct {
+		line          int
+		FromAccountID int64  `binding:"required,min=1"`
+		ToAccountID   int64  `binding:"required,min=1,nefield=FromAccountID"`
+		Amount        int64  `binding:"required,gt=0"`
+		Currency      string `binding:"required,oneof=USD EUR"`
+	}
+)
+
+type csvRow struct {
+	line   int
+	values map[string]string
+}
+
+// ImportAccounts opens the accounts listed in r, with the columns owner,
+// currency and an optional opening balance. Opening balances are booked as
+// deposits against the settlement account of the currency, like cash paid
+// in at a counter. Valid rows are loaded chunk by chunk, each chunk in one
+// transaction, while invalid rows are reported with their line. Importing
+// the same file twice opens the accounts twice.
+func ImportAccounts(ctx context.Context, db connection.DBTX, r io.Reader, args ImportParams) (*ImportReport, error) {
+	report := &ImportReport{Kind: KindAccounts, DryRun: args.DryRun, Errors: []ImportError{}}
+
+	err := readCSV(r, []string{"owner", "currency"}, []string{"balance"}, args.ChunkSize, report, func(rows []csvRow) error {
+		accounts := make([]accountRow, 0, len(rows))
+		for _, row := range rows {
+			account := accountRow{line: row.line, Owner: row.values["owner"], Currency: row.values["currency"]}
+			if err := parseInt(row.values, "balance", &account.Balance); err != nil {
+				report.fail(row.line, err)
+				continue
+			}
+			if err := binding.Validator.ValidateStruct(account); err != nil {
+				report.fail(row.line, err)
+				continue
+			}
+			accounts = append(accounts, account)
+		}
+
+		accounts, err := checkOwners(ctx, db, accounts, report)
+		if err != nil {
+			return err
+		}
+
+		report.Valid += len(accounts)
+		if args.DryRun || len(accounts) == 0 {
+			return nil
+		}
+
+		if err := loadAccounts(ctx, db, accounts); err != nil {
+			return err
+		}
+		report.Imported += len(accounts)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	logger.FromContext(ctx).Info("accounts imported", "dry_run", report.DryRun, "rows", report.Rows, "imported", report.Imported,
+		"failed", report.Failed)
+	return report, nil
+}
+
+// ImportTransfers makes the transfers listed in r, with the columns
+// from_account_id, to_account_id, amount and currency. Each chunk runs in
+// one transaction with a savepoint per transfer, so a transfer refused for
+// lack of funds or by the limits is reported without undoing the others.
+// Fees and limits apply as to any transfer, the second factor and approval
+// thresholds of the API don't as the import is run by staff.
+func ImportTransfers(ctx context.Context, db connection.DBTX, r io.Reader, args ImportParams) (*ImportReport, error) {
+	report := &ImportReport{Kind: KindTransfers, DryRun: args.DryRun, Errors: []ImportError{}}
+
+	columns := []string{"from_account_id", "to_account_id", "amount", "currency"}
+	err := readCSV(r, columns, nil, args.ChunkSize, report, func(rows []csvRow) error {
+		transfers := make([]transferRow, 0, len(rows))
+		for _, row := range rows {
+			transfer := transferRow{line: row.line, Currency: row.values["currency"]}
+			err := parseInt(row.values, "from_account_id", &transfer.FromAccountID)
+			if err == nil {
+				err = parseInt(row.values, "to_account_id", &transfer.ToAccountID)
+			}
+			if err == nil {
+				err = parseInt(row.values, "amount", &transfer.Amount)
+			}
+			if err == nil {
+				err = binding.Validator.ValidateStruct(transfer)
+			}
+			if err != nil {
+				report.fail(row.line, err)
+				continue
+			}
+			transfers = append(transfers, transfer)
+		}
+
+		transfers, err := checkTransferAccounts(ctx, db, transfers, report)
+		if err != nil {
+			return err
+		}
+
+		report.Valid += len(transfers)
+		if args.DryRun || len(transfers) == 0 {
+			return nil
+		}
+
+		return loadTransfers(ctx, db, transfers, report)
+	})
+	if err != nil {
+		return report, err
+	}
+
+	logger.FromContext(ctx).Info("transfers imported", "dry_run", report.DryRun, "rows", report.Rows, "imported", report.Imported,
+		"failed", report.Failed)
+	return report, nil
+}
+
+// readCSV streams the rows of r to load, chunkSize rows at a time. The
+// header names the columns in any order, the required ones must be there.
+// Malformed rows are reported and skipped.
+func readCSV(r io.Reader, required, optional []string, chunkSize int, report *ImportReport, load func([]csvRow) error) error {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return errors.Wrap(ErrInvalidImport, "the file is empty")
+	}
+	if err != nil {
+		return errors.Wrap(ErrInvalidImport, err.Error())
+	}
+
+	known := make(map[string]bool)
+	for _, column := range append(required, optional...) {
+		known[column] = true
+	}
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		// spreadsheets may start the file with a byte order mark
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !known[column] {
+			return errors.Wrapf(ErrInvalidImport, "unknown column %q", column)
+		}
+		if _, ok := index[column]; ok {
+			return errors.Wrapf(ErrInvalidImport, "column %q appears twice", column)
+		}
+		index[column] = i
+	}
+	for _, column := range required {
+		if _, ok := index[column]; !ok {
+			return errors.Wrapf(ErrInvalidImport, "missing column %q", column)
+		}
+	}
+
+	rows := make([]csvRow, 0, chunkSize)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			report.Rows++
+			report.fail(parseErr.StartLine, parseErr.Err)
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed reading the file")
+		}
+
+		report.Rows++
+		line, _ := reader.FieldPos(0)
+		values := make(map[string]string, len(index))
+		for column, i := range index {
+			values[column] = strings.TrimSpace(record[i])
+		}
+		rows = append(rows, csvRow{line: line, values: values})
+
+		if len(rows) == chunkSize {
+			if err := load(rows); err != nil {
+				return err
+			}
+			rows = rows[:0]
+		}
+	}
+
+	if len(rows) > 0 {
+		return load(rows)
+	}
+	return nil
+}
+
+// checkOwners drops and reports the accounts whose owner isn't a user.
+func checkOwners(ctx context.Context, db connection.DBTX, accounts []accountRow, report *ImportReport) ([]accountRow, error) {
+	query := `SELECT username FROM users WHERE username = ANY($1)`
+
+	owners := make([]string, len(accounts))
+	for i, account := range accounts {
+		owners[i] = account.Owner
+	}
+
+	rows, err := db.QueryContext(ctx, query, pq.StringArray(owners))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	users := make(map[string]bool)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		users[username] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+
+	valid := accounts[:0]
+	for _, account := range accounts {
+		if !users[account.Owner] {
+			report.fail(account.line, fmt.Errorf("user %s not found", account.Owner))
+			continue
+		}
+		valid = append(valid, account)
+	}
+	return valid, nil
+}
+
+// checkTransferAccounts drops and reports the transfers whose accounts
+// don't exist or hold another currency.
+func checkTransferAccounts(ctx context.Context, db connection.DBTX, transfers []transferRow, report *ImportReport) ([]transferRow, error) {
+	query := `SELECT id, currency FROM accounts WHERE id = ANY($1)`
+
+	ids := make([]int64, 0, 2*len(transfers))
+	for _, transfer := range transfers {
+		ids = append(ids, transfer.FromAccountID, transfer.ToAccountID)
+	}
+
+	rows, err := db.QueryContext(ctx, query, pq.Int64Array(ids))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	currencies := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var currency string
+		if err := rows.Scan(&id, &currency); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		currencies[id] = currency
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+
+	valid := transfers[:0]
+	for _, transfer := range transfers {
+		if err := checkAccountCurrency(currencies, transfer.FromAccountID, transfer.Currency); err != nil {
+			report.fail(transfer.line, err)
+			continue
+		}
+		if err := checkAccountCurrency(currencies, transfer.ToAccountID, transfer.Currency); err != nil {
+			report.fail(transfer.line, err)
+			continue
+		}
+		valid = append(valid, transfer)
+	}
+	return valid, nil
+}
+
+func checkAccountCurrency(currencies map[int64]string, id int64, currency string) error {
+	accountCurrency, ok := currencies[id]
+	if !ok {
+		return fmt.Errorf("account [%d] not found", id)
+	}
+	if accountCurrency != currency {
+		return fmt.Errorf("account [%d] currency mismatch: %s vs %s", id, accountCurrency, currency)
+	}
+	return nil
+}
+
+// loadAccounts opens a chunk of accounts with their opening balances. The
+// settlement accounts are debited once per currency for the whole chunk.
+func loadAccounts(ctx context.Context, db connection.DBTX, rows []accountRow) error {
+	params := make([]accountController.CreateAccountParams, len(rows))
+	for i, row := range rows {
+		params[i] = accountController.CreateAccountParams{Owner: row.Owner, Currency: row.Currency, Balance: row.Balance}
+	}
+
+	return connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		accounts, err := accountController.CreateAccounts(ctx, tx, params)
+		if err != nil {
+			return err
+		}
+
+		totals := make(map[string]int64)
+		for _, account := range accounts {
+			totals[account.Currency] += account.Balance
+		}
+
+		currencies := make([]string, 0, len(totals))
+		for currency, total := range totals {
+			if total > 0 {
+				currencies = append(currencies, currency)
+			}
+		}
+		sort.Strings(currencies)
+
+		// the settlement accounts are locked in id order, like transfers do
+		settlements := make(map[string]*models.Account, len(currencies))
+		for _, currency := range currencies {
+			settlement, err := accountController.GetSettlementAccount(ctx, tx, currency)
+			if err != nil {
+				return err
+			}
+			settlements[currency] = settlement
+		}
+		sort.Slice(currencies, func(i, j int) bool { return settlements[currencies[i]].Id < settlements[currencies[j]].Id })
+
+		var entries []entryController.CreateEntryParams
+		for _, account := range accounts {
+			if account.Balance == 0 {
+				continue
+			}
+			entries = append(entries, entryController.CreateEntryParams{
+				AccountID:             account.Id,
+				Amount:                account.Balance,
+				Type:                  entryController.TypeDeposit,
+				CounterpartyAccountID: &settlements[account.Currency].Id,
+			})
+		}
+
+		for _, currency := range currencies {
+			settlement, err := accountController.GetAccountByIDForUpdate(ctx, tx, settlements[currency].Id)
+			if err != nil {
+				return err
+			}
+			_, err = accountController.UpdateAccount(ctx, tx, accountController.UpdateAccountParams{
+				Id:      settlement.Id,
+				Balance: settlement.Balance - totals[currency],
+			})
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entryController.CreateEntryParams{
+				AccountID: settlement.Id,
+				Amount:    -totals[currency],
+				Type:      entryController.TypeDeposit,
+			})
+		}
+
+		if len(entries) == 0 {
+			return nil
+		}
+		_, err = entryController.CreateEntries(ctx, tx, entries)
+		return err
+	})
+}
+
+// loadTransfers makes a chunk of transfers in one transaction, reporting
+// those that fail.
+func loadTransfers(ctx context.Context, db connection.DBTX, rows []transferRow, report *ImportReport) error {
+	var failures []ImportError
+	var imported int
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		// reset by a retry of the transaction
+		failures, imported = nil, 0
+
+		for _, row := range rows {
+			err := connection.ExecSavepoint(ctx, tx, func(tx connection.DBTX) error {
+				_, err := transferController.TransferTx(ctx, tx, transferController.TransferTxParams{
+					FromAccountID: row.FromAccountID,
+					ToAccountID:   row.ToAccountID,
+					Amount:        row.Amount,
+				})
+				return err
+			})
+			if err != nil {
+				failures = append(failures, ImportError{Line: row.line, Error: err.Error()})
+				continue
+			}
+			imported++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	report.Imported += imported
+	for _, failure := range failures {
+		report.fail(failure.Line, errors.New(failure.Error))
+	}
+	return nil
+}
+
+// fail counts a failed row and keeps its error while there is room.
+func (report *ImportReport) fail(line int, err error) {
+	report.Failed++
+	if len(report.Errors) < maxReportedErrors {
+		report.Errors = append(report.Errors, ImportError{Line: line, Error: err.Error()})
+	}
+}
+
+// parseInt reads the integer in column into dst, leaving dst alone when the
+// column is empty or absent so the validation sees a missing value.
+func parseInt(values map[string]string, column string, dst *int64) error {
+	value := values[column]
+	if value == "" {
+		return nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not a whole number", column, value)
+	}
+	*dst = n
+	return nil
+}
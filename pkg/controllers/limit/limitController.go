@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/models"
+)
+
+const transferLimitColumns = `id, currency, tier, max_transfer, daily_limit, monthly_limit, created_at, updated_at`
+
+type SetTransferLimitParams struct {
+	Currency     string `json:"currency"`
+	Tier         string `json:"tier"`
+	MaxTransfer  *int64 `json:"max_transfer"`
+	DailyLimit   *int64 `json:"daily_limit"`
+	MonthlyLimit *int64 `json:"monthly_limit"`
+}
+
+// GetTransferLimit returns the limits of accounts of tier in currency. There
+// being no row means no limit.
+func GetTransferLimit(ctx context.Context, db connection.DBTX, currency string, tier string) (*models.TransferLimit, error) {
+	query := `SELECT ` + transferLimitColumns + ` FROM transfer_limits WHERE currency = $1 AND tier = $2 LIMIT 1`
+
+	var res models.TransferLimit
+	err := scanTransferLimit(db.QueryRowContext(ctx, query, currency, tier), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+func ListTransferLimits(ctx context.Context, db connection.DBTX) ([]models.TransferLimit, error) {
+	query := `SELECT ` + transferLimitColumns + ` FROM transfer_limits ORDER BY currency, tier`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	res := []models.TransferLimit{}
+	for rows.Next() {
+		var limit models.TransferLimit
+		if err := scanTransferLimit(rows, &limit); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		res = append(res, limit)
+	}
+
+	return res, rows.Err()
+}
+
+// SetTransferLimit creates or replaces the limits of a currency and tier.
+func SetTransferLimit(ctx context.Context, db connection.DBTX, args SetTransferLimitParams) (*models.TransferLimit, error) {
+	query := `INSERT INTO transfer_limits ("currency", "tier", "max_transfer", "daily_limit", "monthly_limit")
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT ("currency", "tier") DO UPDATE SET max_transfer = EXCLUDED.max_transfer,
+			daily_limit = EXCLUDED.daily_limit, monthly_limit = EXCLUDED.monthly_limit, updated_at = now()
+		RETURNING ` + transferLimitColumns
+
+	var res models.TransferLimit
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		var before *models.TransferLimit
+		current, err := GetTransferLimit(ctx, tx, args.Currency, args.Tier)
+		if err == nil {
+			before = current
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		err = scanTransferLimit(tx.QueryRowContext(ctx, query, args.Currency, args.Tier,
+			args.MaxTransfer, args.DailyLimit, args.MonthlyLimit), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "transfer_limit.set",
+			EntityType: "transfer_limit",
+			EntityID:   res.Id,
+			Before:     before,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+// OutgoingTotal sums the amounts sent from an account since the given time,
+// in the currency of the account. Reversals giving money back don't count.
+func OutgoingTotal(ctx context.Context, db connection.DBTX, accountID int64, since time.Time) (int64, error) {
+	query := `SELECT COALESCE(SUM(amount), 0) FROM transfers WHERE from_account_id = $1 AND created_at >= $2 AND reversal_of IS NULL`
+
+	var res int64
+	err := db.QueryRowContext(ctx, query, accountID, since).Scan(&res)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return res, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTransferLimit(row scanner, limit *models.TransferLimit) error {
+	return row.Scan(&limit.Id, &limit.Currency, &limit.Tier, &limit.MaxTransfer, &limit.DailyLimit, &limit.MonthlyLimit,
+		&limit.CreatedAt, &limit.UpdatedAt)
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/logger"
+)
+
+// SetTOTPSecret starts an enrollment: the secret is stored but not trusted
+// until EnableTOTP confirms the user could produce a code from it.
+func SetTOTPSecret(ctx context.Context, db connection.DBTX, username string, encryptedSecret string) error {
+	query := `UPDATE users SET totp_secret = $2, totp_enabled = false, totp_last_used_step = 0 WHERE username = $1`
+
+	return connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		if err := execOne(ctx, tx, query, username, encryptedSecret); err != nil {
+			return err
+		}
+
+		_, err := auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "user.totp_enroll",
+			EntityType: "user",
+			EntityID:   username,
+		})
+		return err
+	})
+}
+
+// EnableTOTP turns two-factor authentication on and replaces the user's
+// recovery codes with the given hashes.
+func EnableTOTP(ctx context.Context, db connection.DBTX, username string, step int64, codeHashes []string) error {
+	query := `UPDATE users SET totp_enabled = true, totp_last_used_step = $2 WHERE username = $1 AND totp_secret <> ''`
+
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		if err := execOne(ctx, tx, query, username, step); err != nil {
+			return err
+		}
+
+		if err := replaceRecoveryCodes(ctx, tx, username, codeHashes); err != nil {
+			return err
+		}
+
+		_, err := auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "user.totp_enable",
+			EntityType: "user",
+			EntityID:   username,
+			Before:     map[string]bool{"totp_enabled": false},
+			After:      map[string]bool{"totp_enabled": true},
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("two-factor authentication enabled", "username", username)
+	return nil
+}
+
+// DisableTOTP removes the secret and every recovery code of the user.
+func DisableTOTP(ctx context.Context, db connection.DBTX, username string) error {
+	query := `UPDATE users SET totp_secret = '', totp_enabled = false, totp_last_used_step = 0 WHERE username = $1`
+
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		if err := execOne(ctx, tx, query, username); err != nil {
+			return err
+		}
+
+		if err := replaceRecoveryCodes(ctx, tx, username, nil); err != nil {
+			return err
+		}
+
+		_, err := auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "user.totp_disable",
+			EntityType: "user",
+			EntityID:   username,
+			Before:     map[string]bool{"totp_enabled": true},
+			After:      map[string]bool{"totp_enabled": false},
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("two-factor authentication disabled", "username", username)
+	return nil
+}
+
+// ConsumeTOTPStep records that the code of step was used. It reports false
+// when that step, or a later one, was already used so a code can't be
+// replayed.
+func ConsumeTOTPStep(ctx context.Context, db connection.DBTX, username string, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_used_step = $2 WHERE username = $1 AND totp_last_used_step < $2`
+
+	res, err := db.ExecContext(ctx, query, username, step)
+	if err != nil {
+		return false, errors.Wrap(err, "failed update")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed rows affected")
+	}
+	return n == 1, nil
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used. It reports
+// false when no such unused code exists.
+func ConsumeRecoveryCode(ctx context.Context, db connection.DBTX, username string, codeHash string) (bool, error) {
+	query := `UPDATE recovery_codes SET used_at = now() WHERE username = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	var used bool
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		res, err := tx.ExecContext(ctx, query, username, codeHash)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "failed rows affected")
+		}
+		if used = n == 1; !used {
+			return nil
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "user.recovery_code_use",
+			EntityType: "user",
+			EntityID:   username,
+		})
+		return err
+	})
+
+	return used, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx connection.DBTX, username string, codeHashes []string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE username = $1`, username)
+	if err != nil {
+		return errors.Wrap(err, "failed delete")
+	}
+
+	query := `INSERT INTO recovery_codes ("username", "code_hash") VALUES ($1, $2)`
+	for _, codeHash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, query, username, codeHash); err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+	}
+
+	return nil
+}
+
+// execOne runs an update that must touch exactly one row.
+func execOne(ctx context.Context, db connection.DBTX, query string, args ...interface{}) error {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "failed update")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed rows affected")
+	}
+	if n != 1 {
+		return errors.Wrap(sql.ErrNoRows, "row not found")
+	}
+	return nil
+}
@@ -0,0 +1,458 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+	"simplebank/pkg/oauth"
+)
+
+const (
+	clientColumns       = `id, owner, name, secret_hash, redirect_uris, scopes, created_at`
+	consentColumns      = `username, client_id, scopes, revoked_at, created_at, updated_at`
+	codeColumns         = `code_hash, client_id, username, redirect_uri, scopes, code_challenge, expires_at, used_at, created_at`
+	refreshTokenColumns = `token_hash, client_id, username, scopes, expires_at, revoked_at, created_at`
+)
+
+var (
+	// ErrCodeReused is returned when an authorization code is redeemed a
+	// second time. Every refresh token issued to the client for the user is
+	// revoked, as the code has likely been stolen.
+	ErrCodeReused = errors.New("authorization code was already used")
+	// ErrRefreshTokenReused is returned when a rotated refresh token is
+	// presented again. The whole token family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+)
+
+type (
+	CreateClientParams struct {
+		Id           string   `json:"id"`
+		Owner        string   `json:"owner"`
+		Name         string   `json:"name"`
+		SecretHash   string   `json:"secret_hash"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+	}
+
+	CreateAuthorizationCodeParams struct {
+		CodeHash      string    `json:"code_hash"`
+		ClientID      string    `json:"client_id"`
+		Username      string    `json:"username"`
+		RedirectURI   string    `json:"redirect_uri"`
+		Scopes        []string  `json:"scopes"`
+		CodeChallenge string    `json:"code_challenge"`
+		ExpiresAt     time.Time `json:"expires_at"`
+	}
+
+	CreateRefreshTokenParams struct {
+		TokenHash string    `json:"token_hash"`
+		ClientID  string    `json:"client_id"`
+		Username  string    `json:"username"`
+		Scopes    []string  `json:"scopes"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	RotateRefreshTokenParams struct {
+		TokenHash    string    `json:"token_hash"`
+		ClientID     string    `json:"client_id"`
+		NewTokenHash string    `json:"new_token_hash"`
+		Scopes       []string  `json:"scopes"`
+		ExpiresAt    time.Time `json:"expires_at"`
+	}
+)
+
+func CreateClient(ctx context.Context, db connection.DBTX, args CreateClientParams) (*models.OAuthClient, error) {
+	query := `INSERT INTO oauth_clients ("id", "owner", "name", "secret_hash", "redirect_uris", "scopes")
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING ` + clientColumns
+
+	var res models.OAuthClient
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		err := scanClient(tx.QueryRowContext(ctx, query,
+			args.Id, args.Owner, args.Name, args.SecretHash, pq.StringArray(args.RedirectURIs), pq.StringArray(args.Scopes),
+		), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "oauth_client.create",
+			EntityType: "oauth_client",
+			EntityID:   res.Id,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+func GetClient(ctx context.Context, db connection.DBTX, id string) (*models.OAuthClient, error) {
+	query := `SELECT ` + clientColumns + ` FROM oauth_clients WHERE id = $1 LIMIT 1`
+
+	var res models.OAuthClient
+	err := scanClient(db.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// GetConsent returns the active consent username gave the client.
+func GetConsent(ctx context.Context, db connection.DBTX, username string, clientID string) (*models.OAuthConsent, error) {
+	query := `SELECT ` + consentColumns + ` FROM oauth_consents
+		WHERE username = $1 AND client_id = $2 AND revoked_at IS NULL LIMIT 1`
+
+	var res models.OAuthConsent
+	err := scanConsent(db.QueryRowContext(ctx, query, username, clientID), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// ListConsents returns the active consents of username.
+func ListConsents(ctx context.Context, db connection.DBTX, username string) ([]models.OAuthConsent, error) {
+	query := `SELECT ` + consentColumns + ` FROM oauth_consents
+		WHERE username = $1 AND revoked_at IS NULL ORDER BY created_at`
+
+	rows, err := db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	res := []models.OAuthConsent{}
+	for rows.Next() {
+		var consent models.OAuthConsent
+		if err := scanConsent(rows, &consent); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		res = append(res, consent)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+
+	return res, nil
+}
+
+// GrantConsent records that username lets the client use scopes, on top of
+// whatever an active consent already granted.
+func GrantConsent(ctx context.Context, db connection.DBTX, username string, clientID string, scopes []string) (*models.OAuthConsent, error) {
+	query := `INSERT INTO oauth_consents ("username", "client_id", "scopes") VALUES ($1, $2, $3)
+		ON CONFLICT ("username", "client_id") DO UPDATE
+		SET scopes = excluded.scopes, revoked_at = NULL, updated_at = now()
+		RETURNING ` + consentColumns
+
+	var res models.OAuthConsent
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		var before *models.OAuthConsent
+		var current models.OAuthConsent
+		err := scanConsent(tx.QueryRowContext(ctx, `SELECT `+consentColumns+` FROM oauth_consents
+			WHERE username = $1 AND client_id = $2 AND revoked_at IS NULL FOR UPDATE`, username, clientID), &current)
+		if err != nil && err != sql.ErrNoRows {
+			return errors.Wrap(err, "failed retrieving the row")
+		}
+		if err == nil {
+			before = &current
+			scopes = oauth.Union(current.Scopes, scopes)
+		}
+
+		err = scanConsent(tx.QueryRowContext(ctx, query, username, clientID, pq.StringArray(scopes)), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "oauth_consent.grant",
+			EntityType: "oauth_consent",
+			EntityID:   username + "/" + clientID,
+			Before:     before,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+// RevokeConsent withdraws the consent username gave the client along with
+// every refresh token it holds. Access tokens already issued stop working
+// as they are checked against the consent.
+func RevokeConsent(ctx context.Context, db connection.DBTX, username string, clientID string) (*models.OAuthConsent, error) {
+	query := `UPDATE oauth_consents SET revoked_at = now(), updated_at = now()
+		WHERE username = $1 AND client_id = $2 AND revoked_at IS NULL RETURNING ` + consentColumns
+
+	var res models.OAuthConsent
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		err := scanConsent(tx.QueryRowContext(ctx, query, username, clientID), &res)
+		if err == sql.ErrNoRows {
+			return errors.Wrap(err, "row not found")
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		if err := RevokeRefreshTokens(ctx, tx, username, clientID); err != nil {
+			return err
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "oauth_consent.revoke",
+			EntityType: "oauth_consent",
+			EntityID:   username + "/" + clientID,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	logger.FromContext(ctx).Info("oauth consent revoked", "username", username, "client_id", clientID)
+	return &res, nil
+}
+
+func CreateAuthorizationCode(ctx context.Context, db connection.DBTX, args CreateAuthorizationCodeParams) (*models.OAuthAuthorizationCode, error) {
+	query := `INSERT INTO oauth_authorization_codes
+		("code_hash", "client_id", "username", "redirect_uri", "scopes", "code_challenge", "expires_at")
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING ` + codeColumns
+
+	var res models.OAuthAuthorizationCode
+	err := scanCode(db.QueryRowContext(ctx, query,
+		args.CodeHash, args.ClientID, args.Username, args.RedirectURI, pq.StringArray(args.Scopes), args.CodeChallenge, args.ExpiresAt,
+	), &res)
+	if err != nil {
+		return &res, errors.Wrap(err, "failed insert")
+	}
+
+	return &res, nil
+}
+
+// ConsumeAuthorizationCode marks a code as used and returns it. A code can
+// only be consumed once, see ErrCodeReused.
+func ConsumeAuthorizationCode(ctx context.Context, db connection.DBTX, codeHash string) (*models.OAuthAuthorizationCode, error) {
+	query := `UPDATE oauth_authorization_codes SET used_at = now()
+		WHERE code_hash = $1 AND used_at IS NULL RETURNING ` + codeColumns
+
+	var res models.OAuthAuthorizationCode
+	err := scanCode(db.QueryRowContext(ctx, query, codeHash), &res)
+	if err == nil {
+		return &res, nil
+	}
+	if err != sql.ErrNoRows {
+		return &res, errors.Wrap(err, "failed update")
+	}
+
+	err = scanCode(db.QueryRowContext(ctx, `SELECT `+codeColumns+` FROM oauth_authorization_codes WHERE code_hash = $1`, codeHash), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	logger.FromContext(ctx).Warn("oauth authorization code reused", "username", res.Username, "client_id", res.ClientID)
+	if err := RevokeRefreshTokens(ctx, db, res.Username, res.ClientID); err != nil {
+		return &res, err
+	}
+	return &res, ErrCodeReused
+}
+
+func CreateRefreshToken(ctx context.Context, db connection.DBTX, args CreateRefreshTokenParams) (*models.OAuthRefreshToken, error) {
+	query := `INSERT INTO oauth_refresh_tokens ("token_hash", "client_id", "username", "scopes", "expires_at")
+		VALUES ($1, $2, $3, $4, $5) RETURNING ` + refreshTokenColumns
+
+	var res models.OAuthRefreshToken
+	err := scanRefreshToken(db.QueryRowContext(ctx, query,
+		args.TokenHash, args.ClientID, args.Username, pq.StringArray(args.Scopes), args.ExpiresAt,
+	), &res)
+	if err != nil {
+		return &res, errors.Wrap(err, "failed insert")
+	}
+
+	return &res, nil
+}
+
+func GetRefreshToken(ctx context.Context, db connection.DBTX, tokenHash string) (*models.OAuthRefreshToken, error) {
+	query := `SELECT ` + refreshTokenColumns + ` FROM oauth_refresh_tokens WHERE token_hash = $1 LIMIT 1`
+
+	var res models.OAuthRefreshToken
+	err := scanRefreshToken(db.QueryRowContext(ctx, query, tokenHash), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// RotateRefreshToken revokes a refresh token of the client and issues its
+// replacement. Presenting an already revoked token revokes every token of
+// the family, see ErrRefreshTokenReused.
+func RotateRefreshToken(ctx context.Context, db connection.DBTX, args RotateRefreshTokenParams) (*models.OAuthRefreshToken, error) {
+	query := `UPDATE oauth_refresh_tokens SET revoked_at = now()
+		WHERE token_hash = $1 AND client_id = $2 AND revoked_at IS NULL RETURNING ` + refreshTokenColumns
+
+	var res models.OAuthRefreshToken
+	var old models.OAuthRefreshToken
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		err := scanRefreshToken(tx.QueryRowContext(ctx, query, args.TokenHash, args.ClientID), &old)
+		if err == sql.ErrNoRows {
+			return errors.Wrap(err, "row not found")
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		token, err := CreateRefreshToken(ctx, tx, CreateRefreshTokenParams{
+			TokenHash: args.NewTokenHash,
+			ClientID:  old.ClientID,
+			Username:  old.Username,
+			Scopes:    args.Scopes,
+			ExpiresAt: args.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		res = *token
+		return nil
+	})
+	if err == nil {
+		return &res, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return &res, err
+	}
+
+	reused, getErr := GetRefreshToken(ctx, db, args.TokenHash)
+	if getErr != nil || reused.ClientID != args.ClientID || reused.RevokedAt == nil {
+		return &res, err
+	}
+
+	logger.FromContext(ctx).Warn("oauth refresh token reused", "username", reused.Username, "client_id", reused.ClientID)
+	if err := RevokeRefreshTokens(ctx, db, reused.Username, reused.ClientID); err != nil {
+		return &res, err
+	}
+	return &res, ErrRefreshTokenReused
+}
+
+// RevokeRefreshToken revokes one refresh token of the client. It reports
+// false when there was no such active token.
+func RevokeRefreshToken(ctx context.Context, db connection.DBTX, tokenHash string, clientID string) (bool, error) {
+	query := `UPDATE oauth_refresh_tokens SET revoked_at = now()
+		WHERE token_hash = $1 AND client_id = $2 AND revoked_at IS NULL`
+
+	res, err := db.ExecContext(ctx, query, tokenHash, clientID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed update")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed rows affected")
+	}
+	return n == 1, nil
+}
+
+// RevokeRefreshTokens revokes every refresh token the client holds for
+// username.
+func RevokeRefreshTokens(ctx context.Context, db connection.DBTX, username string, clientID string) error {
+	query := `UPDATE oauth_refresh_tokens SET revoked_at = now()
+		WHERE username = $1 AND client_id = $2 AND revoked_at IS NULL`
+
+	_, err := db.ExecContext(ctx, query, username, clientID)
+	if err != nil {
+		return errors.Wrap(err, "failed update")
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes the refresh tokens of every client for
+// username.
+func RevokeUserRefreshTokens(ctx context.Context, db connection.DBTX, username string) error {
+	query := `UPDATE oauth_refresh_tokens SET revoked_at = now() WHERE username = $1 AND revoked_at IS NULL`
+
+	_, err := db.ExecContext(ctx, query, username)
+	if err != nil {
+		return errors.Wrap(err, "failed update")
+	}
+
+	return nil
+}
+
+// RevokeAccessToken denies an access token until it expires on its own.
+func RevokeAccessToken(ctx context.Context, db connection.DBTX, tokenID string, expiresAt time.Time) error {
+	query := `INSERT INTO oauth_revoked_tokens ("token_id", "expires_at") VALUES ($1, $2)
+		ON CONFLICT ("token_id") DO NOTHING`
+
+	_, err := db.ExecContext(ctx, query, tokenID, expiresAt)
+	if err != nil {
+		return errors.Wrap(err, "failed insert")
+	}
+
+	return nil
+}
+
+// IsAccessTokenActive reports whether an access token issued to the client
+// for username is neither revoked nor outlived the user's consent.
+func IsAccessTokenActive(ctx context.Context, db connection.DBTX, tokenID string, username string, clientID string) (bool, error) {
+	query := `SELECT
+		EXISTS (SELECT 1 FROM oauth_consents WHERE username = $2 AND client_id = $3 AND revoked_at IS NULL)
+		AND NOT EXISTS (SELECT 1 FROM oauth_revoked_tokens WHERE token_id = $1)`
+
+	var active bool
+	err := db.QueryRowContext(ctx, query, tokenID, username, clientID).Scan(&active)
+	if err != nil {
+		return false, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return active, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanClient(row scanner, client *models.OAuthClient) error {
+	return row.Scan(&client.Id, &client.Owner, &client.Name, &client.SecretHash, &client.RedirectURIs, &client.Scopes, &client.CreatedAt)
+}
+
+func scanConsent(row scanner, consent *models.OAuthConsent) error {
+	return row.Scan(&consent.Username, &consent.ClientID, &consent.Scopes, &consent.RevokedAt, &consent.CreatedAt, &consent.UpdatedAt)
+}
+
+func scanCode(row scanner, code *models.OAuthAuthorizationCode) error {
+	return row.Scan(&code.CodeHash, &code.ClientID, &code.Username, &code.RedirectURI, &code.Scopes,
+		&code.CodeChallenge, &code.ExpiresAt, &code.UsedAt, &code.CreatedAt)
+}
+
+func scanRefreshToken(row scanner, token *models.OAuthRefreshToken) error {
+	return row.Scan(&token.TokenHash, &token.ClientID, &token.Username, &token.Scopes,
+		&token.ExpiresAt, &token.RevokedAt, &token.CreatedAt)
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"simplebank/pkg/connection"
+	accountController "simplebank/pkg/controllers/account"
+	entryController "simplebank/pkg/controllers/entry"
+	"simplebank/pkg/statement"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type StatementParams struct {
+	AccountID int64 `json:"account_id"`
+	// From and To bound the statement, To excluded.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// WriteStatement renders the statement of an account to w as the entries
+// are read. Everything is read in one repeatable read transaction, so the
+// opening balance, the entries and the closing balance agree even while
+// transfers go on. The opening balance is the balance of the account less
+// the entries booked since From.
+func WriteStatement(ctx context.Context, db connection.DBTX, args StatementParams, w statement.Writer) error {
+	sinceQuery := `SELECT COALESCE(SUM(amount), 0) FROM entries WHERE account_id = $1 AND created_at >= $2`
+	entriesQuery := `SELECT e.id, e.type, e.amount, e.transfer_id, e.counterparty_account_id, c.kind, e.created_at
+		FROM entries e LEFT JOIN accounts c ON c.id = e.counterparty_account_id
+		WHERE e.account_id = $1 AND e.created_at >= $2 AND e.created_at < $3
+		ORDER BY e.created_at, e.id`
+
+	return connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		if _, err := tx.ExecContext(ctx, `SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY`); err != nil {
+			return errors.Wrap(err, "failed set transaction")
+		}
+
+		account, err := accountController.GetAccountByID(ctx, tx, args.AccountID)
+		if err != nil {
+			return err
+		}
+
+		var since int64
+		if err := tx.QueryRowContext(ctx, sinceQuery, account.Id, args.From).Scan(&since); err != nil {
+			return errors.Wrap(err, "failed retrieving the row")
+		}
+
+		header := statement.Header{
+			AccountID:      account.Id,
+			Owner:          account.Owner,
+			Currency:       account.Currency,
+			From:           args.From,
+			To:             args.To,
+			OpeningBalance: account.Balance - since,
+			GeneratedAt:    time.Now(),
+		}
+		if err := w.Begin(header); err != nil {
+			return errors.Wrap(err, "failed writing the statement")
+		}
+
+		rows, err := tx.QueryContext(ctx, entriesQuery, account.Id, args.From, args.To)
+		if err != nil {
+			return errors.Wrap(err, "failed retrieving the rows")
+		}
+		defer rows.Close()
+
+		summary := statement.Summary{ClosingBalance: header.OpeningBalance}
+		for rows.Next() {
+			var line statement.Line
+			var counterpartyKind sql.NullString
+			err := rows.Scan(&line.EntryID, &line.Type, &line.Amount, &line.TransferID, &line.CounterpartyAccountID,
+				&counterpartyKind, &line.Date)
+			if err != nil {
+				return errors.Wrap(err, "failed scanning the row")
+			}
+
+			summary.ClosingBalance += line.Amount
+			summary.EntryCount++
+			if line.Amount < 0 {
+				summary.TotalDebits -= line.Amount
+			} else {
+				summary.TotalCredits += line.Amount
+			}
+			line.Balance = summary.ClosingBalance
+			line.Counterparty = counterparty(line, counterpartyKind.String)
+
+			if err := w.Line(line); err != nil {
+				return errors.Wrap(err, "failed writing the statement")
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return errors.Wrap(err, "failed retrieving the rows")
+		}
+
+		return errors.Wrap(w.End(summary), "failed writing the statement")
+	})
+}
+
+// counterparty describes the other side of an entry. Cash and fees are
+// booked against system accounts, which mean nothing to customers.
+func counterparty(line statement.Line, kind string) string {
+	switch {
+	case line.CounterpartyAccountID == nil:
+		return ""
+	case kind == accountController.KindRevenue:
+		return "fees"
+	case kind == accountController.KindSettlement && line.Type == entryController.TypeDeposit:
+		return "cash deposit"
+	case kind == accountController.KindSettlement && line.Type == entryController.TypeWithdrawal:
+		return "cash withdrawal"
+	case kind == accountController.KindSettlement:
+		return "settlement"
+	default:
+		return fmt.Sprintf("account %d", *line.CounterpartyAccountID)
+	}
+}
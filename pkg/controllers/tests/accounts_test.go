@@ -12,10 +12,17 @@ import (
 )
 
 func createRandomAccount(t *testing.T) *models.Account {
+	return createRandomAccountIn(t, util.RandomCurrency())
+}
+
+// createRandomAccountIn creates an account holding currency, transfers only
+// move money between accounts of the same currency. The balance covers the
+// transfers the tests make without an overdraft.
+func createRandomAccountIn(t *testing.T, currency string) *models.Account {
 	account := accountController.CreateAccountParams{
 		Owner:    util.RandomOwner(),
-		Currency: util.RandomCurrency(),
-		Balance:  util.RandomMoney(),
+		Currency: currency,
+		Balance:  1000 + util.RandomMoney(),
 	}
 	res, err := accountController.CreateAccount(context.Background(), DB, account)
 	require.NoError(t, err)
@@ -25,6 +32,8 @@ func createRandomAccount(t *testing.T) *models.Account {
 	require.Equal(t, res.Balance, account.Balance)
 	require.Equal(t, res.Currency, account.Currency)
 
+	require.Equal(t, accountController.StatusActive, res.Status)
+
 	require.NotZero(t, res.Id)
 	require.NotZero(t, res.CreatedAt)
 
@@ -93,3 +102,31 @@ func TestDeleteAccount(t *testing.T) {
 
 	require.Equal(t, account.Id, id)
 }
+
+func TestGetAccountAllByOwner(t *testing.T) {
+	account := createRandomAccount(t)
+
+	accounts, err := accountController.GetAccountAll(context.Background(), DB, accountController.ListAccountParams{
+		Owner: account.Owner,
+		Limit: 5,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, accounts)
+
+	for _, a := range accounts {
+		require.Equal(t, account.Owner, a.Owner)
+	}
+}
+
+func TestUpdateAccountStatus(t *testing.T) {
+	account1 := createRandomAccount(t)
+
+	account2, err := accountController.UpdateAccountStatus(context.Background(), DB, accountController.UpdateAccountStatusParams{
+		Id:     account1.Id,
+		Status: accountController.StatusFrozen,
+	})
+	require.NoError(t, err)
+	require.Equal(t, account1.Id, account2.Id)
+	require.Equal(t, accountController.StatusFrozen, account2.Status)
+	require.Equal(t, account1.Balance, account2.Balance)
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	apiKeyController "simplebank/pkg/controllers/apikey"
+	"simplebank/pkg/models"
+	"simplebank/pkg/util"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomAPIKey(t *testing.T, username string) *models.APIKey {
+	args := apiKeyController.CreateAPIKeyParams{
+		Username:   username,
+		Name:       util.RandomOwner(),
+		Prefix:     util.RandomString(8),
+		SecretHash: util.HashToken(util.RandomString(32)),
+		Scopes:     []string{"accounts:read", "transfers:write"},
+	}
+
+	key, err := apiKeyController.CreateAPIKey(context.Background(), DB, args)
+	require.NoError(t, err)
+	require.NotEmpty(t, key)
+
+	require.Equal(t, args.Username, key.Username)
+	require.Equal(t, args.Name, key.Name)
+	require.Equal(t, args.Prefix, key.Prefix)
+	require.Equal(t, args.SecretHash, key.SecretHash)
+	require.Equal(t, args.Scopes, []string(key.Scopes))
+	require.Nil(t, key.ExpiresAt)
+	require.Nil(t, key.LastUsedAt)
+	require.Nil(t, key.RevokedAt)
+	require.NotZero(t, key.CreatedAt)
+
+	return key
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	user := createRandomUser(t)
+	key1 := createRandomAPIKey(t, user.Username)
+
+	key2, err := apiKeyController.GetAPIKeyByPrefix(context.Background(), DB, key1.Prefix)
+	require.NoError(t, err)
+	require.Equal(t, key1.Id, key2.Id)
+	require.True(t, apiKeyController.IsUsable(key2, time.Now()))
+
+	keys, err := apiKeyController.ListAPIKeys(context.Background(), DB, user.Username)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Equal(t, key1.Id, keys[0].Id)
+}
+
+func TestTouchAPIKey(t *testing.T) {
+	user := createRandomUser(t)
+	key := createRandomAPIKey(t, user.Username)
+
+	require.NoError(t, apiKeyController.TouchAPIKey(context.Background(), DB, key.Id))
+
+	key, err := apiKeyController.GetAPIKey(context.Background(), DB, key.Id)
+	require.NoError(t, err)
+	require.NotNil(t, key.LastUsedAt)
+	require.WithinDuration(t, time.Now(), *key.LastUsedAt, time.Minute)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	user := createRandomUser(t)
+	key := createRandomAPIKey(t, user.Username)
+
+	key, err := apiKeyController.RevokeAPIKey(context.Background(), DB, key.Id)
+	require.NoError(t, err)
+	require.NotNil(t, key.RevokedAt)
+	require.False(t, apiKeyController.IsUsable(key, time.Now()))
+
+	_, err = apiKeyController.RevokeAPIKey(context.Background(), DB, key.Id)
+	require.Error(t, err)
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	user := createRandomUser(t)
+	key1 := createRandomAPIKey(t, user.Username)
+
+	key2, err := apiKeyController.RotateAPIKey(context.Background(), DB, apiKeyController.RotateAPIKeyParams{
+		Id:         key1.Id,
+		Prefix:     util.RandomString(8),
+		SecretHash: util.HashToken(util.RandomString(32)),
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, key1.Id, key2.Id)
+	require.NotEqual(t, key1.Prefix, key2.Prefix)
+	require.Equal(t, key1.Name, key2.Name)
+	require.Equal(t, key1.Scopes, key2.Scopes)
+	require.True(t, apiKeyController.IsUsable(key2, time.Now()))
+
+	key1, err = apiKeyController.GetAPIKey(context.Background(), DB, key1.Id)
+	require.NoError(t, err)
+	require.False(t, apiKeyController.IsUsable(key1, time.Now()))
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	key := &models.APIKey{ExpiresAt: &expiresAt}
+
+	require.True(t, apiKeyController.IsUsable(key, time.Now()))
+	require.False(t, apiKeyController.IsUsable(key, expiresAt.Add(time.Second)))
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	accountController "simplebank/pkg/controllers/account"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requestTransferApproval(t *testing.T, initiator string, from, to *models.Account, expiresAt time.Time) *models.TransferApproval {
+	approval, err := transferController.RequestTransferApproval(context.Background(), DB, transferController.RequestTransferApprovalParams{
+		Initiator:     initiator,
+		FromAccountID: from.Id,
+		ToAccountID:   to.Id,
+		Amount:        500,
+		ExpiresAt:     expiresAt,
+	})
+	require.NoError(t, err)
+	require.Equal(t, transferController.ApprovalPending, approval.Status)
+
+	return approval
+}
+
+func TestApproveTransfer(t *testing.T) {
+	initiator := createRandomUser(t)
+	approver := createRandomUser(t)
+	from := createRandomAccountIn(t, "EUR")
+	to := createRandomAccountIn(t, "EUR")
+
+	approval := requestTransferApproval(t, initiator.Username, from, to, time.Now().Add(time.Hour))
+
+	// the funds are held while the transfer waits
+	account, err := accountController.GetAccountByID(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Equal(t, from.Balance, account.Balance)
+	require.Equal(t, int64(500), account.HeldAmount)
+
+	// the hold can only be settled by a decision
+	_, err = transferController.CaptureHold(context.Background(), DB, transferController.CaptureHoldParams{HoldID: approval.HoldID})
+	require.True(t, errors.Is(err, transferController.ErrHoldPendingApproval))
+
+	_, err = transferController.ApproveTransfer(context.Background(), DB, transferController.DecideTransferParams{
+		ApprovalID: approval.Id,
+		Approver:   initiator.Username,
+	})
+	require.True(t, errors.Is(err, transferController.ErrSelfApproval))
+
+	result, err := transferController.ApproveTransfer(context.Background(), DB, transferController.DecideTransferParams{
+		ApprovalID: approval.Id,
+		Approver:   approver.Username,
+		Reason:     "checked with the customer",
+	})
+	require.NoError(t, err)
+	require.Equal(t, transferController.ApprovalApproved, result.Approval.Status)
+	require.Equal(t, approver.Username, *result.Approval.DecidedBy)
+	require.Equal(t, "checked with the customer", *result.Approval.DecisionReason)
+	require.NotNil(t, result.Approval.DecidedAt)
+	require.Equal(t, result.Transfer.Transfer.Id, *result.Approval.TransferID)
+	require.Equal(t, from.Balance-500, result.Transfer.FromAccount.Balance)
+	require.Zero(t, result.Transfer.FromAccount.HeldAmount)
+	require.Equal(t, to.Balance+500, result.Transfer.ToAccount.Balance)
+
+	_, err = transferController.RejectTransfer(context.Background(), DB, transferController.DecideTransferParams{
+		ApprovalID: approval.Id,
+		Approver:   approver.Username,
+		Reason:     "too late",
+	})
+	require.True(t, errors.Is(err, transferController.ErrApprovalNotPending))
+}
+
+func TestRejectTransfer(t *testing.T) {
+	initiator := createRandomUser(t)
+	approver := createRandomUser(t)
+	from := createRandomAccountIn(t, "EUR")
+	to := createRandomAccountIn(t, "EUR")
+
+	approval := requestTransferApproval(t, initiator.Username, from, to, time.Now().Add(time.Hour))
+
+	approval, err := transferController.RejectTransfer(context.Background(), DB, transferController.DecideTransferParams{
+		ApprovalID: approval.Id,
+		Approver:   approver.Username,
+		Reason:     "unknown beneficiary",
+	})
+	require.NoError(t, err)
+	require.Equal(t, transferController.ApprovalRejected, approval.Status)
+	require.Nil(t, approval.TransferID)
+
+	hold, err := transferController.GetHold(context.Background(), DB, approval.HoldID)
+	require.NoError(t, err)
+	require.Equal(t, transferController.HoldVoided, hold.Status)
+
+	account, err := accountController.GetAccountByID(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Equal(t, from.Balance, account.Balance)
+	require.Zero(t, account.HeldAmount)
+}
+
+func TestExpireTransferApprovals(t *testing.T) {
+	initiator := createRandomUser(t)
+	approver := createRandomUser(t)
+	from := createRandomAccountIn(t, "EUR")
+	to := createRandomAccountIn(t, "EUR")
+
+	approval := requestTransferApproval(t, initiator.Username, from, to, time.Now().Add(time.Second))
+	time.Sleep(time.Second)
+
+	_, err := transferController.ApproveTransfer(context.Background(), DB, transferController.DecideTransferParams{
+		ApprovalID: approval.Id,
+		Approver:   approver.Username,
+	})
+	require.True(t, errors.Is(err, transferController.ErrApprovalNotPending))
+
+	expired, err := transferController.ExpireTransferApprovals(context.Background(), DB)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, expired, 1)
+	_, err = transferController.ExpireHolds(context.Background(), DB)
+	require.NoError(t, err)
+
+	approval, err = transferController.GetTransferApproval(context.Background(), DB, approval.Id)
+	require.NoError(t, err)
+	require.Equal(t, transferController.ApprovalExpired, approval.Status)
+
+	account, err := accountController.GetAccountByID(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Zero(t, account.HeldAmount)
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	accountController "simplebank/pkg/controllers/account"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/reqmeta"
+	"simplebank/pkg/util"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditAccountCreate(t *testing.T) {
+	meta := reqmeta.Meta{
+		RequestID: reqmeta.NewID(),
+		Actor:     util.RandomOwner(),
+		ClientIP:  "127.0.0.1",
+	}
+	ctx := reqmeta.With(context.Background(), meta)
+
+	account, err := accountController.CreateAccount(ctx, DB, accountController.CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Currency: util.RandomCurrency(),
+		Balance:  util.RandomMoney(),
+	})
+	require.NoError(t, err)
+
+	events, err := auditController.ListAuditEvents(context.Background(), DB, auditController.ListAuditEventParams{
+		EntityType: "account",
+		EntityID:   fmt.Sprint(account.Id),
+		Limit:      10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	event := events[0]
+	require.Equal(t, "account.create", event.Action)
+	require.Equal(t, meta.Actor, event.Actor)
+	require.Equal(t, meta.RequestID, event.RequestID)
+	require.Equal(t, meta.ClientIP, event.ClientIP)
+	require.Nil(t, event.Before)
+	require.NotEmpty(t, event.After)
+}
+
+func TestAuditAccountUpdate(t *testing.T) {
+	account := createRandomAccount(t)
+
+	_, err := accountController.UpdateAccount(context.Background(), DB, accountController.UpdateAccountParams{
+		Id:      account.Id,
+		Balance: account.Balance + 10,
+	})
+	require.NoError(t, err)
+
+	events, err := auditController.ListAuditEvents(context.Background(), DB, auditController.ListAuditEventParams{
+		Action:   "account.update",
+		EntityID: fmt.Sprint(account.Id),
+		Limit:    10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, reqmeta.SystemActor, events[0].Actor)
+	require.NotEmpty(t, events[0].Before)
+	require.NotEmpty(t, events[0].After)
+}
+
+func TestAuditEventsAppendOnly(t *testing.T) {
+	account := createRandomAccount(t)
+
+	_, err := DB.Exec(`UPDATE audit_events SET actor = 'mallory' WHERE entity_type = 'account' AND entity_id = $1`, fmt.Sprint(account.Id))
+	require.Error(t, err)
+
+	_, err = DB.Exec(`DELETE FROM audit_events WHERE entity_type = 'account' AND entity_id = $1`, fmt.Sprint(account.Id))
+	require.Error(t, err)
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	accountController "simplebank/pkg/controllers/account"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/models"
+	"simplebank/pkg/util"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// createFundedAccount opens an empty account and funds it with a deposit,
+// so that its entries add up to its balance.
+func createFundedAccount(t *testing.T, currency string, amount int64) *models.Account {
+	account, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Currency: currency,
+	})
+	require.NoError(t, err)
+
+	if amount > 0 {
+		deposit, err := transferController.DepositTx(context.Background(), DB, transferController.CashTxParams{
+			AccountID: account.Id,
+			Amount:    amount,
+		})
+		require.NoError(t, err)
+		account = deposit.Account
+	}
+	require.Equal(t, amount, account.Balance)
+
+	return account
+}
+
+func TestGetBalanceAt(t *testing.T) {
+	from := createFundedAccount(t, "EUR", 1000)
+	to := createFundedAccount(t, "EUR", 0)
+
+	transfer := func(amount int64) {
+		_, err := transferController.TransferTx(context.Background(), DB, transferController.TransferTxParams{
+			FromAccountID: from.Id,
+			ToAccountID:   to.Id,
+			Amount:        amount,
+		})
+		require.NoError(t, err)
+	}
+
+	before := time.Now()
+	transfer(40)
+	first := time.Now()
+
+	taken, err := accountController.TakeBalanceSnapshots(context.Background(), DB, first)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, taken, int64(2))
+
+	// nothing new to snapshot
+	taken, err = accountController.TakeBalanceSnapshots(context.Background(), DB, first)
+	require.NoError(t, err)
+	require.Zero(t, taken)
+
+	transfer(15)
+	second := time.Now()
+
+	balance, err := accountController.GetBalanceAt(context.Background(), DB, to.Id, before)
+	require.NoError(t, err)
+	require.Nil(t, balance.SnapshotAt)
+	require.Equal(t, int64(0), balance.Balance)
+
+	balance, err = accountController.GetBalanceAt(context.Background(), DB, to.Id, first)
+	require.NoError(t, err)
+	require.NotNil(t, balance.SnapshotAt)
+	require.Equal(t, int64(40), balance.Balance)
+
+	// from the snapshot plus the entries since
+	balance, err = accountController.GetBalanceAt(context.Background(), DB, to.Id, second)
+	require.NoError(t, err)
+	require.WithinDuration(t, first, *balance.SnapshotAt, time.Millisecond)
+	require.Equal(t, int64(55), balance.Balance)
+	require.Equal(t, "EUR", balance.Currency)
+
+	_, err = accountController.TakeBalanceSnapshots(context.Background(), DB, second)
+	require.NoError(t, err)
+	after, err := accountController.GetBalanceAt(context.Background(), DB, to.Id, second)
+	require.NoError(t, err)
+	require.Equal(t, balance.Balance, after.Balance)
+
+	// the entries of each account add up to its balance
+	now := time.Now()
+	for _, id := range []int64{from.Id, to.Id} {
+		account, err := accountController.GetAccountByID(context.Background(), DB, id)
+		require.NoError(t, err)
+		balance, err := accountController.GetBalanceAt(context.Background(), DB, id, now)
+		require.NoError(t, err)
+		require.Equal(t, account.Balance, balance.Balance)
+	}
+}
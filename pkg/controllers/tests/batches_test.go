@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	accountController "simplebank/pkg/controllers/account"
+	transferController "simplebank/pkg/controllers/transfer"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtomicTransferBatch(t *testing.T) {
+	from := createRandomAccountIn(t, "USD")
+	to1 := createRandomAccountIn(t, "USD")
+	to2 := createRandomAccountIn(t, "USD")
+
+	result, err := transferController.CreateTransferBatch(context.Background(), DB, transferController.CreateTransferBatchParams{
+		Owner: from.Owner,
+		Mode:  transferController.BatchAtomic,
+		Items: []transferController.TransferBatchItemParams{
+			{FromAccountID: from.Id, ToAccountID: to2.Id, Amount: 10},
+			{FromAccountID: from.Id, ToAccountID: to1.Id, Amount: 20},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, transferController.BatchCompleted, result.Batch.Status)
+	require.Equal(t, int32(2), result.Batch.SucceededCount)
+	require.NotNil(t, result.Batch.CompletedAt)
+	for _, item := range result.Items {
+		require.Equal(t, transferController.ItemSucceeded, item.Status)
+		require.NotNil(t, item.TransferID)
+	}
+
+	items, err := transferController.ListTransferBatchItems(context.Background(), DB, result.Batch.Id)
+	require.NoError(t, err)
+	require.Equal(t, result.Items, items)
+
+	account, err := accountController.GetAccountByID(context.Background(), DB, to1.Id)
+	require.NoError(t, err)
+	require.Equal(t, to1.Balance+20, account.Balance)
+
+	// the second item can't be paid, the first one is rolled back with it
+	account, err = accountController.GetAccountByID(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+
+	result, err = transferController.CreateTransferBatch(context.Background(), DB, transferController.CreateTransferBatchParams{
+		Owner: from.Owner,
+		Mode:  transferController.BatchAtomic,
+		Items: []transferController.TransferBatchItemParams{
+			{FromAccountID: from.Id, ToAccountID: to1.Id, Amount: 10},
+			{FromAccountID: from.Id, ToAccountID: to2.Id, Amount: account.Balance},
+			{FromAccountID: from.Id, ToAccountID: to1.Id, Amount: 10},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, transferController.BatchFailed, result.Batch.Status)
+	require.Equal(t, int32(0), result.Batch.SucceededCount)
+	require.Equal(t, int32(1), result.Batch.FailedCount)
+	require.Equal(t, transferController.ItemSkipped, result.Items[0].Status)
+	require.Nil(t, result.Items[0].TransferID)
+	require.Equal(t, transferController.ItemFailed, result.Items[1].Status)
+	require.NotNil(t, result.Items[1].Error)
+	require.Equal(t, transferController.ItemSkipped, result.Items[2].Status)
+
+	after, err := accountController.GetAccountByID(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Equal(t, account.Balance, after.Balance)
+}
+
+func TestBestEffortTransferBatch(t *testing.T) {
+	from := createRandomAccountIn(t, "EUR")
+	to := createRandomAccountIn(t, "EUR")
+
+	result, err := transferController.CreateTransferBatch(context.Background(), DB, transferController.CreateTransferBatchParams{
+		Owner: from.Owner,
+		Mode:  transferController.BatchBestEffort,
+		Items: []transferController.TransferBatchItemParams{
+			{FromAccountID: from.Id, ToAccountID: to.Id, Amount: 10},
+			{FromAccountID: from.Id, ToAccountID: to.Id, Amount: from.Balance * 2},
+			{FromAccountID: from.Id, ToAccountID: to.Id, Amount: 15},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, transferController.BatchPartiallyCompleted, result.Batch.Status)
+	require.Equal(t, int32(2), result.Batch.SucceededCount)
+	require.Equal(t, int32(1), result.Batch.FailedCount)
+	require.Equal(t, transferController.ItemSucceeded, result.Items[0].Status)
+	require.Equal(t, transferController.ItemFailed, result.Items[1].Status)
+	require.Nil(t, result.Items[1].TransferID)
+	require.Equal(t, transferController.ItemSucceeded, result.Items[2].Status)
+
+	batch, err := transferController.GetTransferBatch(context.Background(), DB, result.Batch.Id)
+	require.NoError(t, err)
+	require.Equal(t, result.Batch, batch)
+
+	account, err := accountController.GetAccountByID(context.Background(), DB, to.Id)
+	require.NoError(t, err)
+	require.Equal(t, to.Balance+25, account.Balance)
+}
+
+// TestTransferBatchOwnership makes sure an account credited by one item is
+// still checked when a later item debits it.
+func TestTransferBatchOwnership(t *testing.T) {
+	server, config := newTestServer(t)
+
+	user := createRandomUser(t)
+	own, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    user.Username,
+		Currency: "USD",
+		Balance:  1000,
+	})
+	require.NoError(t, err)
+	victim := createRandomAccountIn(t, "USD")
+
+	body := fmt.Sprintf(`{"mode":"atomic","currency":"USD","transfers":[
+		{"from_account_id":%[1]d,"to_account_id":%[2]d,"amount":10},
+		{"from_account_id":%[2]d,"to_account_id":%[1]d,"amount":500}]}`, own.Id, victim.Id)
+	req := httptest.NewRequest(http.MethodPost, "/transfers/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessTokenFor(t, config, user.Username))
+	recorder := serve(server, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	account, err := accountController.GetAccountByID(context.Background(), DB, victim.Id)
+	require.NoError(t, err)
+	require.Equal(t, victim.Balance, account.Balance)
+}
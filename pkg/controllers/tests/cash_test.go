@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"context"
+	accountController "simplebank/pkg/controllers/account"
+	entryController "simplebank/pkg/controllers/entry"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/util"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDepositWithdrawTx(t *testing.T) {
+	account, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Currency: "USD",
+		Balance:  100,
+	})
+	require.NoError(t, err)
+	require.Equal(t, accountController.KindCustomer, account.Kind)
+
+	settlement, err := accountController.GetSettlementAccount(context.Background(), DB, "USD")
+	require.NoError(t, err)
+	require.Equal(t, accountController.KindSettlement, settlement.Kind)
+
+	deposit, err := transferController.DepositTx(context.Background(), DB, transferController.CashTxParams{
+		AccountID: account.Id,
+		Amount:    50,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(150), deposit.Account.Balance)
+	require.Equal(t, entryController.TypeDeposit, deposit.Entry.Type)
+	require.Equal(t, int64(50), deposit.Entry.Amount)
+	require.Equal(t, settlement.Id, deposit.SettlementEntry.AccountID)
+	require.Equal(t, int64(-50), deposit.SettlementEntry.Amount)
+
+	withdrawal, err := transferController.WithdrawTx(context.Background(), DB, transferController.CashTxParams{
+		AccountID: account.Id,
+		Amount:    120,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(30), withdrawal.Account.Balance)
+	require.Equal(t, entryController.TypeWithdrawal, withdrawal.Entry.Type)
+	require.Equal(t, int64(-120), withdrawal.Entry.Amount)
+	require.Equal(t, int64(120), withdrawal.SettlementEntry.Amount)
+
+	// the balance doesn't cover it, nothing moves
+	_, err = transferController.WithdrawTx(context.Background(), DB, transferController.CashTxParams{
+		AccountID: account.Id,
+		Amount:    31,
+	})
+	require.True(t, errors.Is(err, transferController.ErrInsufficientFunds))
+
+	updated, err := accountController.GetAccountByID(context.Background(), DB, account.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(30), updated.Balance)
+}
+
+func TestTransferTxSettlementAccount(t *testing.T) {
+	account, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Currency: "EUR",
+		Balance:  100,
+	})
+	require.NoError(t, err)
+
+	settlement, err := accountController.GetSettlementAccount(context.Background(), DB, "EUR")
+	require.NoError(t, err)
+
+	_, err = transferController.TransferTx(context.Background(), DB, transferController.TransferTxParams{
+		FromAccountID: account.Id,
+		ToAccountID:   settlement.Id,
+		Amount:        10,
+	})
+	require.True(t, errors.Is(err, transferController.ErrNotCustomerAccount))
+
+	_, err = transferController.DepositTx(context.Background(), DB, transferController.CashTxParams{
+		AccountID: settlement.Id,
+		Amount:    10,
+	})
+	require.True(t, errors.Is(err, transferController.ErrNotCustomerAccount))
+}
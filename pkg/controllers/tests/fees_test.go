@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	accountController "simplebank/pkg/controllers/account"
+	entryController "simplebank/pkg/controllers/entry"
+	feeController "simplebank/pkg/controllers/fee"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/fees"
+	"simplebank/pkg/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeRulesMatch(t *testing.T) {
+	usd, premium := "USD", accountController.TierPremium
+	maxFee := int64(500)
+
+	rules := []models.FeeRule{
+		{Id: 1, FlatFee: 25},
+		{Id: 2, Currency: &usd, PercentBps: 100, MinFee: 30, MaxFee: &maxFee},
+		{Id: 3, Currency: &usd, MinAmount: 100000, PercentBps: 50},
+		{Id: 4, Currency: &usd, Tier: &premium, Waived: true},
+	}
+
+	// no currency rule, the catch-all applies
+	fee, rule := fees.Fee(rules, "EUR", accountController.TierStandard, 1000)
+	require.Equal(t, int64(1), rule.Id)
+	require.Equal(t, int64(25), fee)
+
+	// percentage with a floor and a cap
+	fee, rule = fees.Fee(rules, "USD", accountController.TierStandard, 1000)
+	require.Equal(t, int64(2), rule.Id)
+	require.Equal(t, int64(30), fee)
+
+	fee, _ = fees.Fee(rules, "USD", accountController.TierStandard, 10000)
+	require.Equal(t, int64(100), fee)
+
+	fee, _ = fees.Fee(rules, "USD", accountController.TierStandard, 90000)
+	require.Equal(t, int64(500), fee)
+
+	// the tier above the threshold
+	fee, rule = fees.Fee(rules, "USD", accountController.TierStandard, 200000)
+	require.Equal(t, int64(3), rule.Id)
+	require.Equal(t, int64(1000), fee)
+
+	// waived for premium accounts
+	fee, rule = fees.Fee(rules, "USD", accountController.TierPremium, 200000)
+	require.Equal(t, int64(4), rule.Id)
+	require.Zero(t, fee)
+
+	fee, rule = fees.Fee(nil, "USD", accountController.TierStandard, 1000)
+	require.Nil(t, rule)
+	require.Zero(t, fee)
+}
+
+func TestTransferTxFee(t *testing.T) {
+	usd, business := "USD", accountController.TierBusiness
+
+	rule, err := feeController.CreateFeeRule(context.Background(), DB, feeController.CreateFeeRuleParams{
+		Currency:   &usd,
+		Tier:       &business,
+		FlatFee:    10,
+		PercentBps: 100,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, feeController.DeleteFeeRule(context.Background(), DB, rule.Id))
+	})
+
+	from := createRandomAccountIn(t, usd)
+	to := createRandomAccountIn(t, usd)
+	_, err = accountController.UpdateAccountTier(context.Background(), DB, accountController.UpdateAccountTierParams{
+		Id:   from.Id,
+		Tier: business,
+	})
+	require.NoError(t, err)
+
+	revenue, err := accountController.GetRevenueAccount(context.Background(), DB, usd)
+	require.NoError(t, err)
+
+	args := transferController.TransferTxParams{
+		FromAccountID: from.Id,
+		ToAccountID:   to.Id,
+		Amount:        200,
+	}
+
+	preview, err := transferController.PreviewFee(context.Background(), DB, args)
+	require.NoError(t, err)
+	require.Equal(t, int64(12), preview.Fee)
+	require.Equal(t, int64(212), preview.Total)
+	require.Equal(t, rule.Id, preview.Rule.Id)
+
+	result, err := transferController.TransferTx(context.Background(), DB, args)
+	require.NoError(t, err)
+	require.Equal(t, int64(12), result.Fee)
+	require.Equal(t, int64(12), result.Transfer.Fee)
+	require.Equal(t, entryController.TypeFee, result.FeeEntry.Type)
+	require.Equal(t, int64(-12), result.FeeEntry.Amount)
+	require.Equal(t, from.Balance-212, result.FromAccount.Balance)
+	require.Equal(t, to.Balance+200, result.ToAccount.Balance)
+
+	updatedRevenue, err := accountController.GetAccountByID(context.Background(), DB, revenue.Id)
+	require.NoError(t, err)
+	require.Equal(t, revenue.Balance+12, updatedRevenue.Balance)
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	accountController "simplebank/pkg/controllers/account"
+	entryController "simplebank/pkg/controllers/entry"
+	fxController "simplebank/pkg/controllers/fx"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/fx"
+	"simplebank/pkg/util"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	amount, err := fx.Convert(10000, "0.92", 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(9200), amount)
+
+	// 50 bps off 9200, rounded down
+	amount, err = fx.Convert(10000, "0.9200000000", 50)
+	require.NoError(t, err)
+	require.Equal(t, int64(9154), amount)
+
+	amount, err = fx.Convert(1, "0.92", 0)
+	require.NoError(t, err)
+	require.Zero(t, amount)
+
+	_, err = fx.Convert(100, "-1", 0)
+	require.Error(t, err)
+	_, err = fx.Convert(100, "abc", 0)
+	require.Error(t, err)
+	_, err = fx.Convert(100, "1", fx.MaxSpreadBps)
+	require.Error(t, err)
+}
+
+func TestFXTransferTx(t *testing.T) {
+	user := createRandomUser(t)
+
+	from, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    user.Username,
+		Currency: "USD",
+		Balance:  1000,
+	})
+	require.NoError(t, err)
+	to, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Currency: "EUR",
+		Balance:  0,
+	})
+	require.NoError(t, err)
+
+	effectiveAt := time.Now().Add(-time.Second)
+	_, err = fxController.CreateExchangeRate(context.Background(), DB, fxController.CreateExchangeRateParams{
+		BaseCurrency:  "USD",
+		QuoteCurrency: "EUR",
+		Rate:          "0.5",
+		EffectiveAt:   effectiveAt,
+	})
+	require.NoError(t, err)
+
+	rate, err := fxController.GetExchangeRate(context.Background(), DB, "USD", "EUR", time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "0.5000000000", rate.Rate)
+
+	usdSettlement, err := accountController.GetSettlementAccount(context.Background(), DB, "USD")
+	require.NoError(t, err)
+	eurSettlement, err := accountController.GetSettlementAccount(context.Background(), DB, "EUR")
+	require.NoError(t, err)
+
+	toAmount, err := fx.Convert(600, rate.Rate, 100)
+	require.NoError(t, err)
+	require.Equal(t, int64(297), toAmount)
+
+	quote, err := fxController.CreateQuote(context.Background(), DB, fxController.CreateQuoteParams{
+		Id:           util.RandomString(24),
+		Username:     user.Username,
+		FromCurrency: "USD",
+		ToCurrency:   "EUR",
+		FromAmount:   600,
+		ToAmount:     toAmount,
+		Rate:         rate.Rate,
+		SpreadBps:    100,
+		ExpiresAt:    time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+
+	args := transferController.FXTransferTxParams{
+		FromAccountID: from.Id,
+		ToAccountID:   to.Id,
+		QuoteID:       quote.Id,
+		Username:      user.Username,
+	}
+
+	// only the user the quote was given to can redeem it
+	_, err = transferController.FXTransferTx(context.Background(), DB, transferController.FXTransferTxParams{
+		FromAccountID: from.Id,
+		ToAccountID:   to.Id,
+		QuoteID:       quote.Id,
+		Username:      util.RandomOwner(),
+	})
+	require.True(t, errors.Is(err, fxController.ErrQuoteUnavailable))
+
+	result, err := transferController.FXTransferTx(context.Background(), DB, args)
+	require.NoError(t, err)
+	require.Equal(t, int64(600), result.Transfer.Amount)
+	require.Equal(t, int64(297), result.Transfer.ToAmount)
+	require.Equal(t, rate.Rate, *result.Transfer.ExchangeRate)
+	require.Equal(t, int64(100), *result.Transfer.SpreadBps)
+	require.Equal(t, quote.Id, *result.Transfer.QuoteID)
+	require.Equal(t, int64(400), result.FromAccount.Balance)
+	require.Equal(t, int64(297), result.ToAccount.Balance)
+	require.Equal(t, int64(-600), result.EntryFrom.Amount)
+	require.Equal(t, entryController.TypeTransfer, result.EntryTo.Type)
+
+	// the settlement accounts take the other side in each currency
+	updatedUSD, err := accountController.GetAccountByID(context.Background(), DB, usdSettlement.Id)
+	require.NoError(t, err)
+	updatedEUR, err := accountController.GetAccountByID(context.Background(), DB, eurSettlement.Id)
+	require.NoError(t, err)
+	require.Equal(t, usdSettlement.Balance+600, updatedUSD.Balance)
+	require.Equal(t, eurSettlement.Balance-297, updatedEUR.Balance)
+
+	// a quote backs a single transfer
+	_, err = transferController.FXTransferTx(context.Background(), DB, args)
+	require.True(t, errors.Is(err, fxController.ErrQuoteUnavailable))
+}
+
+func TestTransferTxCurrencyMismatch(t *testing.T) {
+	from, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Currency: "USD",
+		Balance:  100,
+	})
+	require.NoError(t, err)
+	to, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Currency: "EUR",
+		Balance:  100,
+	})
+	require.NoError(t, err)
+
+	_, err = transferController.TransferTx(context.Background(), DB, transferController.TransferTxParams{
+		FromAccountID: from.Id,
+		ToAccountID:   to.Id,
+		Amount:        10,
+	})
+	require.True(t, errors.Is(err, transferController.ErrCurrencyMismatch))
+}
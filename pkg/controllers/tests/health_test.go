@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"simplebank/api"
+	"simplebank/pkg/connection"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testHealthResponse struct {
+	Status     string `json:"status"`
+	Components map[string]struct {
+		Status string         `json:"status"`
+		Error  string         `json:"error"`
+		Detail map[string]any `json:"detail"`
+	} `json:"components"`
+}
+
+func getHealth(t *testing.T, server *api.Server, path string) (int, testHealthResponse) {
+	recorder := serve(server, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var res testHealthResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	return recorder.Code, res
+}
+
+func TestHealthz(t *testing.T) {
+	server, _ := newTestServer(t)
+	code, res := getHealth(t, server, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok", res.Status)
+	require.Empty(t, res.Components)
+}
+
+func TestReadyz(t *testing.T) {
+	server, _ := newTestServer(t)
+	code, res := getHealth(t, server, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok", res.Status)
+
+	database := res.Components["database"]
+	require.Equal(t, "ok", database.Status)
+	require.NotEmpty(t, database.Detail["latency"])
+
+	migrations := res.Components["migrations"]
+	require.Equal(t, "ok", migrations.Status)
+	require.Equal(t, float64(connection.SchemaVersion), migrations.Detail["version"])
+	require.Equal(t, float64(connection.SchemaVersion), migrations.Detail["expected"])
+	require.Equal(t, false, migrations.Detail["dirty"])
+
+	require.Equal(t, "ok", res.Components["shutdown"].Status)
+}
+
+func TestReadyzShutdown(t *testing.T) {
+	server, _ := newTestServer(t)
+	require.NoError(t, server.Shutdown(context.Background(), 0))
+
+	// liveness is unaffected, readiness fails so traffic drains away
+	code, _ := getHealth(t, server, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+
+	code, res := getHealth(t, server, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "unavailable", res.Status)
+	require.Equal(t, "unavailable", res.Components["shutdown"].Status)
+	require.Equal(t, "ok", res.Components["database"].Status)
+}
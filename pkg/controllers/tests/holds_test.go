@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"simplebank/api"
+	accountController "simplebank/pkg/controllers/account"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/util"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHoldCapture(t *testing.T) {
+	from, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Currency: "EUR",
+		Balance:  100,
+	})
+	require.NoError(t, err)
+	to := createRandomAccountIn(t, "EUR")
+
+	authorize := func(amount int64) error {
+		_, err := transferController.AuthorizeHold(context.Background(), DB, transferController.AuthorizeHoldParams{
+			AccountID:   from.Id,
+			ToAccountID: to.Id,
+			Amount:      amount,
+			ExpiresAt:   time.Now().Add(time.Minute),
+		})
+		return err
+	}
+
+	hold, err := transferController.AuthorizeHold(context.Background(), DB, transferController.AuthorizeHoldParams{
+		AccountID:   from.Id,
+		ToAccountID: to.Id,
+		Amount:      70,
+		ExpiresAt:   time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+	require.Equal(t, transferController.HoldAuthorized, hold.Status)
+
+	// the balance is untouched, the available balance isn't
+	account, err := accountController.GetAccountByID(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), account.Balance)
+	require.Equal(t, int64(30), account.AvailableBalance)
+
+	require.True(t, errors.Is(authorize(31), transferController.ErrInsufficientFunds))
+
+	_, err = transferController.TransferTx(context.Background(), DB, transferController.TransferTxParams{
+		FromAccountID: from.Id,
+		ToAccountID:   to.Id,
+		Amount:        31,
+	})
+	require.True(t, errors.Is(err, transferController.ErrInsufficientFunds))
+
+	_, err = transferController.CaptureHold(context.Background(), DB, transferController.CaptureHoldParams{
+		HoldID: hold.Id,
+		Amount: 71,
+	})
+	require.True(t, errors.Is(err, transferController.ErrCaptureExceedsHold))
+
+	// a partial capture releases the rest
+	result, err := transferController.CaptureHold(context.Background(), DB, transferController.CaptureHoldParams{
+		HoldID: hold.Id,
+		Amount: 50,
+	})
+	require.NoError(t, err)
+	require.Equal(t, transferController.HoldCaptured, result.Hold.Status)
+	require.Equal(t, int64(50), result.Hold.CapturedAmount)
+	require.Equal(t, result.Transfer.Transfer.Id, *result.Hold.TransferID)
+	require.Equal(t, int64(50), result.Transfer.FromAccount.Balance)
+	require.Equal(t, int64(50), result.Transfer.FromAccount.AvailableBalance)
+	require.Zero(t, result.Transfer.FromAccount.HeldAmount)
+	require.Equal(t, to.Balance+50, result.Transfer.ToAccount.Balance)
+
+	_, err = transferController.CaptureHold(context.Background(), DB, transferController.CaptureHoldParams{HoldID: hold.Id})
+	require.True(t, errors.Is(err, transferController.ErrHoldNotAuthorized))
+	_, err = transferController.VoidHold(context.Background(), DB, hold.Id)
+	require.True(t, errors.Is(err, transferController.ErrHoldNotAuthorized))
+}
+
+func TestHoldVoidAndExpire(t *testing.T) {
+	from := createRandomAccountIn(t, "USD")
+	to := createRandomAccountIn(t, "USD")
+
+	hold, err := transferController.AuthorizeHold(context.Background(), DB, transferController.AuthorizeHoldParams{
+		AccountID:   from.Id,
+		ToAccountID: to.Id,
+		Amount:      10,
+		ExpiresAt:   time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+
+	hold, err = transferController.VoidHold(context.Background(), DB, hold.Id)
+	require.NoError(t, err)
+	require.Equal(t, transferController.HoldVoided, hold.Status)
+
+	expiring, err := transferController.AuthorizeHold(context.Background(), DB, transferController.AuthorizeHoldParams{
+		AccountID:   from.Id,
+		ToAccountID: to.Id,
+		Amount:      20,
+		ExpiresAt:   time.Now().Add(time.Second),
+	})
+	require.NoError(t, err)
+
+	account, err := accountController.GetAccountByID(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(20), account.HeldAmount)
+
+	time.Sleep(time.Second)
+
+	// past its expiry a hold can't be captured even before the sweep
+	_, err = transferController.CaptureHold(context.Background(), DB, transferController.CaptureHoldParams{HoldID: expiring.Id})
+	require.True(t, errors.Is(err, transferController.ErrHoldNotAuthorized))
+
+	expired, err := transferController.ExpireHolds(context.Background(), DB)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, expired, 1)
+
+	expiring, err = transferController.GetHold(context.Background(), DB, expiring.Id)
+	require.NoError(t, err)
+	require.Equal(t, transferController.HoldExpired, expiring.Status)
+
+	account, err = accountController.GetAccountByID(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Zero(t, account.HeldAmount)
+	require.Equal(t, from.Balance, account.Balance)
+}
+
+func TestHoldRequiresSecondFactor(t *testing.T) {
+	config := testConfig()
+	config.TransferTOTPThreshold = 100
+	server, err := api.NewServer(config, DB, logger.New(io.Discard, slog.LevelError))
+	require.NoError(t, err)
+
+	user := createRandomUser(t)
+	from, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    user.Username,
+		Currency: "USD",
+		Balance:  1000,
+	})
+	require.NoError(t, err)
+	to := createRandomAccountIn(t, "USD")
+
+	// the user has no TOTP enrolled, holds above the threshold are refused
+	body := fmt.Sprintf(`{"account_id":%d,"to_account_id":%d,"amount":500,"currency":"USD"}`, from.Id, to.Id)
+	req := httptest.NewRequest(http.MethodPost, "/holds", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessTokenFor(t, config, user.Username))
+	recorder := serve(server, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	holds, err := transferController.ListHolds(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Empty(t, holds)
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	accountController "simplebank/pkg/controllers/account"
+	importController "simplebank/pkg/controllers/imports"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportAccounts(t *testing.T) {
+	user := createRandomUser(t)
+	file := fmt.Sprintf("owner,currency,balance\n%[1]s,USD,1500\n%[1]s,GBP,10\nnobody0000,USD,0\n%[1]s,EUR,\n%[1]s,USD,ten\n",
+		user.Username)
+
+	settlement, err := accountController.GetSettlementAccount(context.Background(), DB, "USD")
+	require.NoError(t, err)
+
+	// a dry run reports the same errors and loads nothing
+	report, err := importController.ImportAccounts(context.Background(), DB, strings.NewReader(file), importController.ImportParams{
+		DryRun:    true,
+		ChunkSize: 2,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 5, report.Rows)
+	require.Equal(t, 2, report.Valid)
+	require.Equal(t, 0, report.Imported)
+	require.Equal(t, 3, report.Failed)
+	lines := make([]int, len(report.Errors))
+	for i, failure := range report.Errors {
+		lines[i] = failure.Line
+	}
+	require.ElementsMatch(t, []int{3, 4, 6}, lines)
+
+	accounts, err := accountController.GetAccountAll(context.Background(), DB, accountController.ListAccountParams{
+		Owner: user.Username,
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, accounts)
+
+	report, err = importController.ImportAccounts(context.Background(), DB, strings.NewReader(file), importController.ImportParams{
+		ChunkSize: 2,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Imported)
+	require.Equal(t, 3, report.Failed)
+
+	accounts, err = accountController.GetAccountAll(context.Background(), DB, accountController.ListAccountParams{
+		Owner: user.Username,
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+
+	// the opening balance came from the settlement account
+	after, err := accountController.GetSettlementAccount(context.Background(), DB, "USD")
+	require.NoError(t, err)
+	require.Equal(t, settlement.Balance-1500, after.Balance)
+
+	_, err = importController.ImportAccounts(context.Background(), DB, strings.NewReader("owner,colour\n"), importController.ImportParams{})
+	require.True(t, errors.Is(err, importController.ErrInvalidImport))
+}
+
+func TestImportTransfers(t *testing.T) {
+	from := createRandomAccountIn(t, "EUR")
+	to := createRandomAccountIn(t, "EUR")
+	other := createRandomAccountIn(t, "USD")
+
+	file := fmt.Sprintf("currency,from_account_id,to_account_id,amount\nEUR,%[1]d,%[2]d,10\nEUR,%[1]d,%[3]d,10\nEUR,%[1]d,%[2]d,%[4]d\nEUR,%[1]d,%[1]d,5\nEUR,%[1]d,%[2]d,20\n",
+		from.Id, to.Id, other.Id, from.Balance*2)
+
+	report, err := importController.ImportTransfers(context.Background(), DB, strings.NewReader(file), importController.ImportParams{})
+	require.NoError(t, err)
+	require.Equal(t, 5, report.Rows)
+	require.Equal(t, 3, report.Valid)
+	require.Equal(t, 2, report.Imported)
+	require.Equal(t, 3, report.Failed)
+	lines := make([]int, len(report.Errors))
+	for i, failure := range report.Errors {
+		lines[i] = failure.Line
+	}
+	require.ElementsMatch(t, []int{3, 4, 5}, lines)
+
+	account, err := accountController.GetAccountByID(context.Background(), DB, to.Id)
+	require.NoError(t, err)
+	require.Equal(t, to.Balance+30, account.Balance)
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	accountController "simplebank/pkg/controllers/account"
+	limitController "simplebank/pkg/controllers/limit"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/models"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+// createLimitedAccounts sets the limits of CAD business accounts, which no
+// other test uses, and returns two such accounts.
+func createLimitedAccounts(t *testing.T, maxTransfer int64, dailyLimit int64) (*models.Account, *models.Account) {
+	_, err := limitController.SetTransferLimit(context.Background(), DB, limitController.SetTransferLimitParams{
+		Currency:    "CAD",
+		Tier:        accountController.TierBusiness,
+		MaxTransfer: &maxTransfer,
+		DailyLimit:  &dailyLimit,
+	})
+	require.NoError(t, err)
+
+	from := createRandomAccountIn(t, "CAD")
+	from, err = accountController.UpdateAccountTier(context.Background(), DB, accountController.UpdateAccountTierParams{
+		Id:   from.Id,
+		Tier: accountController.TierBusiness,
+	})
+	require.NoError(t, err)
+
+	return from, createRandomAccountIn(t, "CAD")
+}
+
+func TestTransferTxLimits(t *testing.T) {
+	from, to := createLimitedAccounts(t, 100, 150)
+
+	transfer := func(amount int64) error {
+		_, err := transferController.TransferTx(context.Background(), DB, transferController.TransferTxParams{
+			FromAccountID: from.Id,
+			ToAccountID:   to.Id,
+			Amount:        amount,
+		})
+		return err
+	}
+
+	require.True(t, errors.Is(transfer(101), transferController.ErrLimitExceeded))
+	require.NoError(t, transfer(100))
+
+	allowance, err := transferController.GetAllowance(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), allowance.DailyUsed)
+	require.Equal(t, int64(50), *allowance.DailyRemaining)
+	require.Nil(t, allowance.MonthlyLimit)
+	require.Nil(t, allowance.MonthlyRemaining)
+
+	require.True(t, errors.Is(transfer(51), transferController.ErrLimitExceeded))
+	require.NoError(t, transfer(50))
+
+	// the rejected transfers left nothing behind
+	updated, err := accountController.GetAccountByID(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Equal(t, from.Balance-150, updated.Balance)
+}
+
+func TestTransferTxLimitsConcurrent(t *testing.T) {
+	from, to := createLimitedAccounts(t, 100, 150)
+
+	n := 5
+	errs := make(chan error)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := transferController.TransferTx(context.Background(), DB, transferController.TransferTxParams{
+				FromAccountID: from.Id,
+				ToAccountID:   to.Id,
+				Amount:        40,
+			})
+			errs <- err
+		}()
+	}
+
+	succeeded := 0
+	for i := 0; i < n; i++ {
+		err := <-errs
+		if err == nil {
+			succeeded++
+			continue
+		}
+		require.True(t, errors.Is(err, transferController.ErrLimitExceeded))
+	}
+	require.Equal(t, 3, succeeded)
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"simplebank/api"
+	"simplebank/pkg/logger"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerIsSensitive(t *testing.T) {
+	for key, sensitive := range map[string]bool{
+		"password":        true,
+		"hashed_password": true,
+		"Authorization":   true,
+		"refresh_token":   true,
+		"client_secret":   true,
+		"x_api_key":       true,
+		"totp_code":       true,
+		"otp":             true,
+		"recovery_code":   true,
+		"username":        false,
+		"request_id":      false,
+		"amount":          false,
+	} {
+		require.Equal(t, sensitive, logger.IsSensitive(key), key)
+	}
+}
+
+func TestLoggerRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.New(&buf, slog.LevelInfo)
+	log.Info("login", "username", "alice", "password", "hunter2", slog.Group("request", "authorization", "Bearer abc"))
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "alice", line["username"])
+	require.Equal(t, logger.Redacted, line["password"])
+	require.Equal(t, logger.Redacted, line["request"].(map[string]any)["authorization"])
+	require.NotContains(t, buf.String(), "hunter2")
+	require.NotContains(t, buf.String(), "Bearer abc")
+}
+
+func TestRequestID(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	// a request id is generated when the client sends none
+	recorder := serve(server, httptest.NewRequest(http.MethodGet, "/accounts/0", nil))
+	generated := recorder.Header().Get("X-Request-ID")
+	require.Len(t, generated, 32)
+
+	recorder = serve(server, httptest.NewRequest(http.MethodGet, "/accounts/0", nil))
+	require.NotEqual(t, generated, recorder.Header().Get("X-Request-ID"))
+
+	// and echoed back when it does
+	req := httptest.NewRequest(http.MethodGet, "/accounts/0", nil)
+	req.Header.Set("X-Request-ID", "client-chosen-id")
+	recorder = serve(server, req)
+	require.Equal(t, "client-chosen-id", recorder.Header().Get("X-Request-ID"))
+}
+
+func TestRequestLogLine(t *testing.T) {
+	var buf bytes.Buffer
+	server, err := api.NewServer(testConfig(), DB, logger.New(&buf, slog.LevelInfo))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts/0", nil)
+	req.Header.Set("X-Request-ID", "log-line-test")
+	recorder := serve(server, req)
+
+	var line map[string]any
+	decoder := json.NewDecoder(&buf)
+	for line["msg"] != "request completed" {
+		line = nil
+		require.NoError(t, decoder.Decode(&line))
+	}
+	require.Equal(t, "log-line-test", line["request_id"])
+	require.Equal(t, http.MethodGet, line["method"])
+	require.Equal(t, "/accounts/:id", line["route"])
+	require.Equal(t, float64(recorder.Code), line["status"])
+	require.Equal(t, "anonymous", line["user"])
+	require.Equal(t, "192.0.2.1", line["client_ip"])
+	require.Contains(t, line, "latency")
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"simplebank/pkg/connection"
+	accountController "simplebank/pkg/controllers/account"
+	transferController "simplebank/pkg/controllers/transfer"
+	userController "simplebank/pkg/controllers/user"
+	"simplebank/pkg/util"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// scrapeMetrics returns the samples exposed on /metrics by series, the
+// metric name with its labels as written in the text format.
+func scrapeMetrics(t *testing.T) map[string]float64 {
+	server, _ := newTestServer(t)
+	recorder := serve(server, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		require.NoError(t, err)
+		samples[line[:i]] = value
+	}
+	require.NoError(t, scanner.Err())
+	return samples
+}
+
+func TestMetricsHTTP(t *testing.T) {
+	server, _ := newTestServer(t)
+	recorder := serve(server, httptest.NewRequest(http.MethodGet, "/accounts/0", nil))
+	status := strconv.Itoa(recorder.Code)
+
+	count := `simple_bank_http_requests_total{method="GET",route="/accounts/:id",status="` + status + `"}`
+	duration := `simple_bank_http_request_duration_seconds_count{method="GET",route="/accounts/:id",status="` + status + `"}`
+	before := scrapeMetrics(t)
+
+	serve(server, httptest.NewRequest(http.MethodGet, "/accounts/0", nil))
+
+	samples := scrapeMetrics(t)
+	require.Equal(t, before[count]+1, samples[count])
+	require.Equal(t, before[duration]+1, samples[duration])
+}
+
+func TestMetricsTransfers(t *testing.T) {
+	currency := util.RandomCurrency()
+	var accounts [2]int64
+	for i := range accounts {
+		account, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+			Owner:    util.RandomOwner(),
+			Currency: currency,
+			Balance:  1000,
+		})
+		require.NoError(t, err)
+		accounts[i] = account.Id
+	}
+
+	count := `simple_bank_transfers_total{currency="` + currency + `"}`
+	amount := `simple_bank_transfer_amount_total{currency="` + currency + `"}`
+	before := scrapeMetrics(t)
+
+	_, err := transferController.TransferTx(context.Background(), DB, transferController.TransferTxParams{
+		FromAccountID: accounts[0],
+		ToAccountID:   accounts[1],
+		Amount:        25,
+	})
+	require.NoError(t, err)
+
+	samples := scrapeMetrics(t)
+	require.Equal(t, before[count]+1, samples[count])
+	require.Equal(t, before[amount]+25, samples[amount])
+}
+
+func TestMetricsLogins(t *testing.T) {
+	password := util.RandomString(8)
+	hashedPassword, err := util.HashPassword(password)
+	require.NoError(t, err)
+	user, err := userController.CreateUser(context.Background(), DB, userController.CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: hashedPassword,
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+
+	server, _ := newTestServer(t)
+	login := func(password string) int {
+		body := fmt.Sprintf(`{"username":%q,"password":%q}`, user.Username, password)
+		req := httptest.NewRequest(http.MethodPost, "/users/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serve(server, req).Code
+	}
+
+	success := `simple_bank_logins_total{result="success"}`
+	failure := `simple_bank_logins_total{result="failure"}`
+	before := scrapeMetrics(t)
+
+	require.Equal(t, http.StatusUnauthorized, login("wrong-password"))
+	require.Equal(t, http.StatusOK, login(password))
+
+	samples := scrapeMetrics(t)
+	require.Equal(t, before[failure]+1, samples[failure])
+	require.Equal(t, before[success]+1, samples[success])
+}
+
+func TestMetricsTransfersRolledBack(t *testing.T) {
+	currency := util.RandomCurrency()
+	from := createRandomAccountIn(t, currency)
+	to := createRandomAccountIn(t, currency)
+
+	count := `simple_bank_transfers_total{currency="` + currency + `"}`
+	before := scrapeMetrics(t)
+
+	// the transfer joins a transaction that rolls back
+	errRollback := errors.New("rollback")
+	err := connection.ExecTx(context.Background(), DB, func(tx connection.DBTX) error {
+		_, err := transferController.TransferTx(context.Background(), tx, transferController.TransferTxParams{
+			FromAccountID: from.Id,
+			ToAccountID:   to.Id,
+			Amount:        1,
+		})
+		require.NoError(t, err)
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+	require.Equal(t, before[count], scrapeMetrics(t)[count])
+
+	// or a savepoint that rolls back while the transaction commits
+	err = connection.ExecTx(context.Background(), DB, func(tx connection.DBTX) error {
+		err := connection.ExecSavepoint(context.Background(), tx, func(tx connection.DBTX) error {
+			_, err := transferController.TransferTx(context.Background(), tx, transferController.TransferTxParams{
+				FromAccountID: from.Id,
+				ToAccountID:   to.Id,
+				Amount:        1,
+			})
+			require.NoError(t, err)
+			return errRollback
+		})
+		require.ErrorIs(t, err, errRollback)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, before[count], scrapeMetrics(t)[count])
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	mfaController "simplebank/pkg/controllers/mfa"
+	userController "simplebank/pkg/controllers/user"
+	"simplebank/pkg/token"
+	"simplebank/pkg/totp"
+	"simplebank/pkg/util"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// test vectors from RFC 6238 appendix B, truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, expected := range vectors {
+		code, err := totp.Code(secret, totp.Step(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, expected, code)
+
+		step, ok := totp.Validate(secret, code, time.Unix(unix, 0))
+		require.True(t, ok)
+		require.Equal(t, totp.Step(time.Unix(unix, 0)), step)
+	}
+}
+
+func TestTOTPSkew(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	now := time.Now()
+
+	// codes of the periods just before and after now make up for clock drift
+	for offset := int64(-1); offset <= 1; offset++ {
+		code, err := totp.Code(secret, totp.Step(now)+offset)
+		require.NoError(t, err)
+
+		step, ok := totp.Validate(secret, code, now)
+		require.True(t, ok)
+		require.Equal(t, totp.Step(now)+offset, step)
+	}
+
+	for _, offset := range []int64{-2, 2} {
+		code, err := totp.Code(secret, totp.Step(now)+offset)
+		require.NoError(t, err)
+
+		_, ok := totp.Validate(secret, code, now)
+		require.False(t, ok)
+	}
+
+	_, ok := totp.Validate(secret, "12345", now)
+	require.False(t, ok)
+}
+
+func TestLoginMFAReplay(t *testing.T) {
+	server, config := newTestServer(t)
+	user := createRandomUser(t)
+	ctx := context.Background()
+
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	encryptedSecret, err := util.Encrypt(config.TOTPEncryptionKey, secret)
+	require.NoError(t, err)
+	require.NoError(t, mfaController.SetTOTPSecret(ctx, DB, user.Username, encryptedSecret))
+	require.NoError(t, mfaController.EnableTOTP(ctx, DB, user.Username, 0, nil))
+
+	maker, err := token.NewJWTMaker(config.TokenSymmetricKey)
+	require.NoError(t, err)
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+
+	loginMFA := func() int {
+		mfaToken, _, err := maker.CreateToken(user.Username, token.PurposeMFA, time.Minute)
+		require.NoError(t, err)
+
+		body := fmt.Sprintf(`{"mfa_token":%q,"code":%q}`, mfaToken, code)
+		req := httptest.NewRequest(http.MethodPost, "/users/login/mfa", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serve(server, req).Code
+	}
+
+	require.Equal(t, http.StatusOK, loginMFA())
+
+	// totp_last_used_step refuses the same code a second time
+	require.Equal(t, http.StatusUnauthorized, loginMFA())
+}
+
+func TestEnableTOTP(t *testing.T) {
+	user := createRandomUser(t)
+	ctx := context.Background()
+
+	err := mfaController.SetTOTPSecret(ctx, DB, user.Username, "encrypted")
+	require.NoError(t, err)
+
+	user, err = userController.GetUser(ctx, DB, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, "encrypted", user.TOTPSecret)
+	require.False(t, user.TOTPEnabled)
+
+	code := util.RandomString(10)
+	err = mfaController.EnableTOTP(ctx, DB, user.Username, 100, []string{util.HashToken(code)})
+	require.NoError(t, err)
+
+	user, err = userController.GetUser(ctx, DB, user.Username)
+	require.NoError(t, err)
+	require.True(t, user.TOTPEnabled)
+
+	// a step can only be used once, and never an older one
+	ok, err := mfaController.ConsumeTOTPStep(ctx, DB, user.Username, 100)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = mfaController.ConsumeTOTPStep(ctx, DB, user.Username, 101)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// recovery codes are single use
+	ok, err = mfaController.ConsumeRecoveryCode(ctx, DB, user.Username, util.HashToken(code))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = mfaController.ConsumeRecoveryCode(ctx, DB, user.Username, util.HashToken(code))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	err = mfaController.DisableTOTP(ctx, DB, user.Username)
+	require.NoError(t, err)
+
+	user, err = userController.GetUser(ctx, DB, user.Username)
+	require.NoError(t, err)
+	require.False(t, user.TOTPEnabled)
+	require.Empty(t, user.TOTPSecret)
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"simplebank/api"
+	"simplebank/pkg/oauth"
+	"simplebank/pkg/util"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testRedirectURI = "https://budget.example.com/callback"
+
+func postForm(server *api.Server, path string, form url.Values, bearer string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return serve(server, req)
+}
+
+type testTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	Error        string `json:"error"`
+}
+
+func decodeTokenResponse(t *testing.T, recorder *httptest.ResponseRecorder) testTokenResponse {
+	var res testTokenResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	return res
+}
+
+func TestPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	require.Equal(t, challenge, oauth.ChallengeS256(verifier))
+	require.True(t, oauth.VerifyPKCE(verifier, challenge))
+	require.False(t, oauth.VerifyPKCE(verifier[1:]+"A", challenge))
+	require.False(t, oauth.VerifyPKCE("short", oauth.ChallengeS256("short")))
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	server, config := newTestServer(t)
+	user := createRandomUser(t)
+	userToken := accessTokenFor(t, config, user.Username)
+
+	// register a public client
+	body, err := json.Marshal(map[string]interface{}{
+		"name":          "Budget App",
+		"redirect_uris": []string{testRedirectURI},
+		"scopes":        []string{"accounts:read"},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/oauth/clients", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+userToken)
+	recorder := serve(server, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var client struct {
+		Client struct {
+			Id string `json:"id"`
+		} `json:"client"`
+		ClientSecret string `json:"client_secret"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &client))
+	require.NotEmpty(t, client.Client.Id)
+	require.Empty(t, client.ClientSecret)
+
+	// the user approves the request
+	verifier := util.RandomString(64)
+	recorder = postForm(server, "/oauth/authorize", url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.Client.Id},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"accounts:read"},
+		"state":                 {"xyz"},
+		"code_challenge":        {oauth.ChallengeS256(verifier)},
+		"code_challenge_method": {oauth.CodeChallengeMethodS256},
+		"approve":               {"true"},
+	}, userToken)
+	require.Equal(t, http.StatusFound, recorder.Code)
+
+	location, err := url.Parse(recorder.Header().Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "xyz", location.Query().Get("state"))
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.Client.Id},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {util.RandomString(64)},
+	}
+
+	// a wrong verifier burns the code
+	recorder = postForm(server, "/oauth/token", exchange, "")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Equal(t, oauth.ErrInvalidGrant, decodeTokenResponse(t, recorder).Error)
+
+	recorder = postForm(server, "/oauth/authorize", url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.Client.Id},
+		"redirect_uri":          {testRedirectURI},
+		"code_challenge":        {oauth.ChallengeS256(verifier)},
+		"code_challenge_method": {oauth.CodeChallengeMethodS256},
+		"approve":               {"true"},
+	}, userToken)
+	require.Equal(t, http.StatusFound, recorder.Code)
+	location, err = url.Parse(recorder.Header().Get("Location"))
+	require.NoError(t, err)
+
+	exchange.Set("code", location.Query().Get("code"))
+	exchange.Set("code_verifier", verifier)
+	recorder = postForm(server, "/oauth/token", exchange, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	tokens := decodeTokenResponse(t, recorder)
+	require.NotEmpty(t, tokens.AccessToken)
+	require.NotEmpty(t, tokens.RefreshToken)
+	require.Equal(t, "accounts:read", tokens.Scope)
+
+	// the token is limited to its scopes
+	req = httptest.NewRequest(http.MethodGet, "/accounts?page_id=1&page_size=5", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	require.Equal(t, http.StatusOK, serve(server, req).Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(`{"currency":"USD"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	require.Equal(t, http.StatusForbidden, serve(server, req).Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/users/api_keys", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	require.Equal(t, http.StatusForbidden, serve(server, req).Code)
+
+	// refreshing rotates the refresh token
+	refresh := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {client.Client.Id},
+		"refresh_token": {tokens.RefreshToken},
+	}
+	recorder = postForm(server, "/oauth/token", refresh, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	refreshed := decodeTokenResponse(t, recorder)
+	require.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+	recorder = postForm(server, "/oauth/token", refresh, "")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// reusing the old refresh token revoked the new one too
+	refresh.Set("refresh_token", refreshed.RefreshToken)
+	recorder = postForm(server, "/oauth/token", refresh, "")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// revoked access tokens are rejected
+	recorder = postForm(server, "/oauth/revoke", url.Values{
+		"client_id": {client.Client.Id},
+		"token":     {refreshed.AccessToken},
+	}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/accounts?page_id=1&page_size=5", nil)
+	req.Header.Set("Authorization", "Bearer "+refreshed.AccessToken)
+	require.Equal(t, http.StatusUnauthorized, serve(server, req).Code)
+
+	// the code can't be redeemed twice
+	recorder = postForm(server, "/oauth/token", exchange, "")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestOAuthAuthorizeUnknownClient(t *testing.T) {
+	server, config := newTestServer(t)
+	user := createRandomUser(t)
+	userToken := accessTokenFor(t, config, user.Username)
+
+	// unknown clients get no redirect
+	recorder := postForm(server, "/oauth/authorize", url.Values{
+		"response_type": {"code"},
+		"client_id":     {util.RandomString(24)},
+		"redirect_uri":  {testRedirectURI},
+	}, userToken)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Empty(t, recorder.Header().Get("Location"))
+}
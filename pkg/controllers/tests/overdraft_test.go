@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	accountController "simplebank/pkg/controllers/account"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/util"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferTxOverdraft(t *testing.T) {
+	from, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Currency: "USD",
+		Balance:  100,
+	})
+	require.NoError(t, err)
+	to := createRandomAccountIn(t, "USD")
+
+	transfer := func(amount int64) (*transferController.TransferTxResult, error) {
+		return transferController.TransferTx(context.Background(), DB, transferController.TransferTxParams{
+			FromAccountID: from.Id,
+			ToAccountID:   to.Id,
+			Amount:        amount,
+		})
+	}
+
+	_, err = transfer(101)
+	require.True(t, errors.Is(err, transferController.ErrInsufficientFunds))
+
+	from, err = accountController.UpdateOverdraftLimit(context.Background(), DB, accountController.UpdateOverdraftLimitParams{
+		Id:             from.Id,
+		OverdraftLimit: 50,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(50), from.OverdraftLimit)
+
+	// down to exactly -overdraft_limit
+	result, err := transfer(150)
+	require.NoError(t, err)
+	require.Equal(t, int64(-50), result.FromAccount.Balance)
+
+	_, err = transfer(1)
+	require.True(t, errors.Is(err, transferController.ErrInsufficientFunds))
+
+	_, err = transferController.WithdrawTx(context.Background(), DB, transferController.CashTxParams{
+		AccountID: from.Id,
+		Amount:    1,
+	})
+	require.True(t, errors.Is(err, transferController.ErrInsufficientFunds))
+
+	// revoking keeps the negative balance but allows no further debit
+	from, err = accountController.UpdateOverdraftLimit(context.Background(), DB, accountController.UpdateOverdraftLimitParams{
+		Id: from.Id,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(-50), from.Balance)
+	require.Zero(t, from.OverdraftLimit)
+
+	deposit, err := transferController.DepositTx(context.Background(), DB, transferController.CashTxParams{
+		AccountID: from.Id,
+		Amount:    20,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(-30), deposit.Account.Balance)
+}
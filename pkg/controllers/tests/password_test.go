@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	userController "simplebank/pkg/controllers/user"
+	"simplebank/pkg/mail"
+	"simplebank/pkg/util"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var mailedToken = regexp.MustCompile(`token=([a-z]+)`)
+
+func createRandomUserToken(t *testing.T, username string, purpose string) string {
+	token := util.RandomString(32)
+
+	userToken, err := userController.CreateUserToken(context.Background(), DB, userController.CreateUserTokenParams{
+		TokenHash: util.HashToken(token),
+		Username:  username,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.Equal(t, username, userToken.Username)
+	require.Equal(t, purpose, userToken.Purpose)
+	require.Nil(t, userToken.UsedAt)
+
+	return token
+}
+
+func TestResetPassword(t *testing.T) {
+	user1 := createRandomUser(t)
+	oldToken := createRandomUserToken(t, user1.Username, userController.TokenPasswordReset)
+	token := createRandomUserToken(t, user1.Username, userController.TokenPasswordReset)
+
+	// only the latest token works
+	_, err := userController.ResetPassword(context.Background(), DB, util.HashToken(oldToken), "hashed")
+	require.Error(t, err)
+
+	// tokens are bound to their purpose
+	_, err = userController.VerifyEmail(context.Background(), DB, util.HashToken(token))
+	require.Error(t, err)
+
+	user2, err := userController.ResetPassword(context.Background(), DB, util.HashToken(token), "hashed")
+	require.NoError(t, err)
+	require.Equal(t, "hashed", user2.HashedPassword)
+	require.True(t, user2.PasswordChangedAt.After(user1.PasswordChangedAt))
+
+	// and single use
+	_, err = userController.ResetPassword(context.Background(), DB, util.HashToken(token), "hashed2")
+	require.Error(t, err)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	user1 := createRandomUser(t)
+	require.False(t, user1.EmailVerified)
+
+	token := createRandomUserToken(t, user1.Username, userController.TokenEmailVerification)
+
+	user2, err := userController.VerifyEmail(context.Background(), DB, util.HashToken(token))
+	require.NoError(t, err)
+	require.True(t, user2.EmailVerified)
+}
+
+func TestPasswordResetEndsSessions(t *testing.T) {
+	server, config := newTestServer(t)
+	user := createRandomUser(t)
+	userToken := accessTokenFor(t, config, user.Username)
+
+	req := httptest.NewRequest(http.MethodPost, "/users/password_reset", strings.NewReader(`{"email":"`+user.Email+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	require.Equal(t, http.StatusAccepted, serve(server, req).Code)
+
+	msg, ok := server.Mailer().(*mail.MemoryMailer).Last(user.Email)
+	require.True(t, ok)
+	match := mailedToken.FindStringSubmatch(msg.Body)
+	require.Len(t, match, 2)
+
+	// unknown emails get the same answer
+	req = httptest.NewRequest(http.MethodPost, "/users/password_reset", strings.NewReader(`{"email":"`+util.RandomEmail()+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	require.Equal(t, http.StatusAccepted, serve(server, req).Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/users/password_reset/confirm",
+		strings.NewReader(`{"token":"`+match[1]+`","password":"`+util.RandomString(10)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	require.Equal(t, http.StatusOK, serve(server, req).Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/accounts?page_id=1&page_size=5", nil)
+	req.Header.Set("Authorization", "Bearer "+userToken)
+	require.Equal(t, http.StatusUnauthorized, serve(server, req).Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/accounts?page_id=1&page_size=5", nil)
+	req.Header.Set("Authorization", "Bearer "+accessTokenFor(t, config, user.Username))
+	require.Equal(t, http.StatusOK, serve(server, req).Code)
+}
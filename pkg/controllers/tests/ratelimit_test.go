@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"simplebank/pkg/ratelimit"
+	"simplebank/pkg/util"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testRateLimitBackend(t *testing.T, backend ratelimit.Backend) {
+	policy := ratelimit.Per("test", 3, time.Hour)
+	key := "test:ip:" + util.RandomString(12)
+
+	for i := 0; i < policy.Burst; i++ {
+		res, err := backend.Allow(context.Background(), key, policy)
+		require.NoError(t, err)
+		require.True(t, res.Allowed)
+		require.Equal(t, policy.Burst, res.Limit)
+		require.Equal(t, policy.Burst-i-1, res.Remaining)
+	}
+
+	res, err := backend.Allow(context.Background(), key, policy)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Zero(t, res.Remaining)
+	require.Greater(t, res.RetryAfter, time.Duration(0))
+
+	// other keys have their own bucket
+	res, err = backend.Allow(context.Background(), key+"-other", policy)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+}
+
+func TestRateLimitMemoryBackend(t *testing.T) {
+	testRateLimitBackend(t, ratelimit.NewMemoryBackend())
+}
+
+func TestRateLimitPostgresBackend(t *testing.T) {
+	testRateLimitBackend(t, ratelimit.NewPostgresBackend(DB))
+}
+
+func TestRateLimitIgnoresForwardedFor(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	// without trusted proxies a new X-Forwarded-For on every request
+	// doesn't give the client a new bucket
+	remaining := make([]int, 3)
+	for i := range remaining {
+		req := httptest.NewRequest(http.MethodPost, "/users/login", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+		recorder := serve(server, req)
+
+		var err error
+		remaining[i], err = strconv.Atoi(recorder.Header().Get("X-RateLimit-Remaining"))
+		require.NoError(t, err)
+	}
+	require.Equal(t, remaining[0]-1, remaining[1])
+	require.Equal(t, remaining[0]-2, remaining[2])
+}
+
+func TestRateLimitSeparateLoginFlows(t *testing.T) {
+	server, _ := newTestServer(t)
+	post := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		return serve(server, req)
+	}
+
+	// the other flows don't take from the login bucket
+	for _, path := range []string{"/users/login/mfa", "/users/password_reset/confirm", "/users/email_verification/confirm"} {
+		for i := 0; i < 5; i++ {
+			require.NotEqual(t, http.StatusTooManyRequests, post(path).Code, path)
+		}
+	}
+
+	recorder := post("/users/login")
+	require.NotEqual(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, "4", recorder.Header().Get("X-RateLimit-Remaining"))
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	accountController "simplebank/pkg/controllers/account"
+	transferController "simplebank/pkg/controllers/transfer"
+	userController "simplebank/pkg/controllers/user"
+	"simplebank/pkg/models"
+	"simplebank/pkg/rbac"
+	"simplebank/pkg/schedule"
+	"simplebank/pkg/util"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomUserWithRole(t *testing.T, role rbac.Role) *models.User {
+	user, err := userController.UpdateUserRole(context.Background(), DB, createRandomUser(t).Username, string(role))
+	require.NoError(t, err)
+	return user
+}
+
+// requestAs serves a request authenticated as username.
+func requestAs(t *testing.T, method, path string, body io.Reader, username string) *httptest.ResponseRecorder {
+	server, config := newTestServer(t)
+
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessTokenFor(t, config, username))
+	return serve(server, req)
+}
+
+func TestRBACCustomerAccounts(t *testing.T) {
+	customer := createRandomUserWithRole(t, rbac.RoleCustomer)
+	own, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    customer.Username,
+		Currency: util.RandomCurrency(),
+		Balance:  util.RandomMoney(),
+	})
+	require.NoError(t, err)
+	other := createRandomAccount(t)
+
+	recorder := requestAs(t, http.MethodGet, fmt.Sprintf("/accounts/%d", own.Id), nil, customer.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = requestAs(t, http.MethodGet, fmt.Sprintf("/accounts/%d", other.Id), nil, customer.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = requestAs(t, http.MethodGet, "/audit_events?page_id=1&page_size=5", nil, customer.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestRBACAuditorReadOnly(t *testing.T) {
+	auditor := createRandomUserWithRole(t, rbac.RoleAuditor)
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+
+	// auditors read everything
+	recorder := requestAs(t, http.MethodGet, fmt.Sprintf("/accounts/%d", account1.Id), nil, auditor.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = requestAs(t, http.MethodGet, "/audit_events?page_id=1&page_size=5", nil, auditor.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// but can't move money
+	body := fmt.Sprintf(`{"from_account_id":%d,"to_account_id":%d,"amount":1,"currency":%q}`,
+		account1.Id, account2.Id, account1.Currency)
+	recorder = requestAs(t, http.MethodPost, "/transfers", strings.NewReader(body), auditor.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = requestAs(t, http.MethodPost, "/accounts", strings.NewReader(`{"currency":"USD"}`), auditor.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestRBACCash(t *testing.T) {
+	account, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    createRandomUser(t).Username,
+		Currency: "USD",
+		Balance:  util.RandomMoney(),
+	})
+	require.NoError(t, err)
+	body := fmt.Sprintf(`{"account_id":%d,"amount":10,"currency":"USD"}`, account.Id)
+
+	// even the owner of the account can't post cash to it
+	recorder := requestAs(t, http.MethodPost, "/deposits", strings.NewReader(body), account.Owner)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = requestAs(t, http.MethodPost, "/withdrawals", strings.NewReader(body), account.Owner)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	teller := createRandomUserWithRole(t, rbac.RoleTeller)
+	recorder = requestAs(t, http.MethodPost, "/deposits", strings.NewReader(body), teller.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = requestAs(t, http.MethodPost, "/withdrawals", strings.NewReader(body), teller.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestRBACFeeRules(t *testing.T) {
+	customer := createRandomUserWithRole(t, rbac.RoleCustomer)
+	recorder := requestAs(t, http.MethodGet, "/admin/fee_rules", nil, customer.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	// auditors review the fee rules but can't change them
+	auditor := createRandomUserWithRole(t, rbac.RoleAuditor)
+	recorder = requestAs(t, http.MethodGet, "/admin/fee_rules", nil, auditor.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = requestAs(t, http.MethodPost, "/admin/fee_rules", strings.NewReader(`{"flat_fee":10}`), auditor.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestRBACTransferLimits(t *testing.T) {
+	customer := createRandomUserWithRole(t, rbac.RoleCustomer)
+	recorder := requestAs(t, http.MethodGet, "/admin/transfer_limits", nil, customer.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	// auditors review the limits but can't change them
+	auditor := createRandomUserWithRole(t, rbac.RoleAuditor)
+	recorder = requestAs(t, http.MethodGet, "/admin/transfer_limits", nil, auditor.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = requestAs(t, http.MethodPut, "/admin/transfer_limits", strings.NewReader(`{"per_transaction":100}`), auditor.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestRBACScheduledTransfers(t *testing.T) {
+	from := createRandomAccountIn(t, "USD")
+	to := createRandomAccountIn(t, "USD")
+	transfer := createScheduledTransfer(t, from, to, schedule.Daily, time.Now().Add(time.Hour), nil)
+	path := fmt.Sprintf("/scheduled_transfers/%d", transfer.Id)
+
+	customer := createRandomUserWithRole(t, rbac.RoleCustomer)
+	recorder := requestAs(t, http.MethodGet, path, nil, customer.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = requestAs(t, http.MethodGet, "/scheduled_transfers?owner="+transfer.Owner, nil, customer.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	// auditors read the schedules of everyone but can't change them
+	auditor := createRandomUserWithRole(t, rbac.RoleAuditor)
+	recorder = requestAs(t, http.MethodGet, path, nil, auditor.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = requestAs(t, http.MethodGet, path+"/runs", nil, auditor.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = requestAs(t, http.MethodGet, "/scheduled_transfers?owner="+transfer.Owner, nil, auditor.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var transfers []models.ScheduledTransfer
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &transfers))
+	require.Len(t, transfers, 1)
+	require.Equal(t, transfer.Id, transfers[0].Id)
+
+	recorder = requestAs(t, http.MethodDelete, path, nil, auditor.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestRBACTransferBatch(t *testing.T) {
+	from := createRandomAccountIn(t, "USD")
+	to := createRandomAccountIn(t, "USD")
+	result, err := transferController.CreateTransferBatch(context.Background(), DB, transferController.CreateTransferBatchParams{
+		Owner: from.Owner,
+		Mode:  transferController.BatchAtomic,
+		Items: []transferController.TransferBatchItemParams{
+			{FromAccountID: from.Id, ToAccountID: to.Id, Amount: 10},
+		},
+	})
+	require.NoError(t, err)
+	path := fmt.Sprintf("/transfers/batch/%d", result.Batch.Id)
+
+	customer := createRandomUserWithRole(t, rbac.RoleCustomer)
+	recorder := requestAs(t, http.MethodGet, path, nil, customer.Username)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	// auditors can't move money but read every batch
+	auditor := createRandomUserWithRole(t, rbac.RoleAuditor)
+	recorder = requestAs(t, http.MethodGet, path, nil, auditor.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
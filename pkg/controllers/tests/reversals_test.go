@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	transferController "simplebank/pkg/controllers/transfer"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseTransfer(t *testing.T) {
+	from := createRandomAccountIn(t, "EUR")
+	to := createRandomAccountIn(t, "EUR")
+
+	transfer, err := transferController.TransferTx(context.Background(), DB, transferController.TransferTxParams{
+		FromAccountID: from.Id,
+		ToAccountID:   to.Id,
+		Amount:        100,
+	})
+	require.NoError(t, err)
+
+	// a partial refund first
+	result, err := transferController.ReverseTransfer(context.Background(), DB, transferController.ReverseTransferParams{
+		TransferID: transfer.Transfer.Id,
+		Amount:     30,
+		Reason:     "partial refund",
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(30), result.Transfer.ReversedAmount)
+	require.Equal(t, transfer.Transfer.Id, *result.Reversal.ReversalOf)
+	require.Equal(t, to.Id, result.Reversal.FromAccountID)
+	require.Equal(t, from.Id, result.Reversal.ToAccountID)
+	require.Equal(t, "partial refund", *result.Reversal.Reason)
+	require.Equal(t, int64(-30), result.EntryFrom.Amount)
+	require.Equal(t, int64(30), result.EntryTo.Amount)
+	require.Equal(t, transfer.ToAccount.Balance-30, result.FromAccount.Balance)
+	require.Equal(t, transfer.FromAccount.Balance+30, result.ToAccount.Balance)
+
+	_, err = transferController.ReverseTransfer(context.Background(), DB, transferController.ReverseTransferParams{
+		TransferID: transfer.Transfer.Id,
+		Amount:     71,
+		Reason:     "too much",
+	})
+	require.True(t, errors.Is(err, transferController.ErrReversalExceedsTransfer))
+
+	// the reversal itself can't be reversed
+	_, err = transferController.ReverseTransfer(context.Background(), DB, transferController.ReverseTransferParams{
+		TransferID: result.Reversal.Id,
+		Reason:     "reversal of a reversal",
+	})
+	require.True(t, errors.Is(err, transferController.ErrNotReversible))
+
+	// the rest, concurrently: only one of them gets it
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := transferController.ReverseTransfer(context.Background(), DB, transferController.ReverseTransferParams{
+				TransferID: transfer.Transfer.Id,
+				Reason:     "sent by mistake",
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var reversed int
+	for err := range errs {
+		if err == nil {
+			reversed++
+			continue
+		}
+		require.True(t, errors.Is(err, transferController.ErrReversalExceedsTransfer))
+	}
+	require.Equal(t, 1, reversed)
+
+	original, err := transferController.GetTransferByID(context.Background(), DB, transfer.Transfer.Id)
+	require.NoError(t, err)
+	require.Equal(t, original.Amount, original.ReversedAmount)
+}
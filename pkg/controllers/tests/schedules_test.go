@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	accountController "simplebank/pkg/controllers/account"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/models"
+	"simplebank/pkg/schedule"
+	"simplebank/pkg/util"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testRetryPolicy = transferController.RetryPolicy{MaxAttempts: 2}
+
+func createScheduledTransfer(t *testing.T, from, to *models.Account, frequency string, startAt time.Time, maxRuns *int32) *models.ScheduledTransfer {
+	user := createRandomUser(t)
+
+	transfer, err := transferController.CreateScheduledTransfer(context.Background(), DB, transferController.CreateScheduledTransferParams{
+		Owner:         user.Username,
+		FromAccountID: from.Id,
+		ToAccountID:   to.Id,
+		Amount:        10,
+		Frequency:     frequency,
+		StartAt:       startAt,
+		MaxRuns:       maxRuns,
+	})
+	require.NoError(t, err)
+	require.Equal(t, transferController.ScheduleActive, transfer.Status)
+	require.WithinDuration(t, startAt, *transfer.NextRunAt, time.Millisecond)
+
+	return transfer
+}
+
+func TestScheduledTransferRunsOnce(t *testing.T) {
+	from := createRandomAccountIn(t, "EUR")
+	to := createRandomAccountIn(t, "EUR")
+	transfer := createScheduledTransfer(t, from, to, schedule.Once, time.Now().Add(-time.Second), nil)
+
+	// several replicas running the scheduler at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := transferController.RunDueScheduledTransfers(context.Background(), DB, testRetryPolicy)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	transfer, err := transferController.GetScheduledTransfer(context.Background(), DB, transfer.Id)
+	require.NoError(t, err)
+	require.Equal(t, transferController.ScheduleCompleted, transfer.Status)
+	require.Equal(t, int32(1), transfer.Runs)
+	require.Nil(t, transfer.NextRunAt)
+
+	runs, err := transferController.ListScheduledTransferRuns(context.Background(), DB, transfer.Id)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	require.Equal(t, transferController.RunSucceeded, runs[0].Status)
+	require.NotNil(t, runs[0].TransferID)
+
+	account, err := accountController.GetAccountByID(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Equal(t, from.Balance-10, account.Balance)
+}
+
+func TestScheduledTransferRecurring(t *testing.T) {
+	from := createRandomAccountIn(t, "EUR")
+	to := createRandomAccountIn(t, "EUR")
+	count := int32(2)
+	// started two days ago, the missed occurrences catch up
+	transfer := createScheduledTransfer(t, from, to, schedule.Daily, time.Now().Add(-48*time.Hour), &count)
+
+	_, err := transferController.RunDueScheduledTransfers(context.Background(), DB, testRetryPolicy)
+	require.NoError(t, err)
+
+	transfer, err = transferController.GetScheduledTransfer(context.Background(), DB, transfer.Id)
+	require.NoError(t, err)
+	require.Equal(t, transferController.ScheduleCompleted, transfer.Status)
+	require.Equal(t, int32(2), transfer.Runs)
+
+	runs, err := transferController.ListScheduledTransferRuns(context.Background(), DB, transfer.Id)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	require.Equal(t, int32(1), runs[0].Occurrence)
+	require.Equal(t, int32(0), runs[1].Occurrence)
+
+	account, err := accountController.GetAccountByID(context.Background(), DB, to.Id)
+	require.NoError(t, err)
+	require.Equal(t, to.Balance+20, account.Balance)
+}
+
+func TestScheduledTransferRetries(t *testing.T) {
+	from, err := accountController.CreateAccount(context.Background(), DB, accountController.CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Currency: "EUR",
+		Balance:  0,
+	})
+	require.NoError(t, err)
+	to := createRandomAccountIn(t, "EUR")
+	transfer := createScheduledTransfer(t, from, to, schedule.Once, time.Now().Add(-time.Second), nil)
+
+	_, err = transferController.RunDueScheduledTransfers(context.Background(), DB, transferController.RetryPolicy{
+		MaxAttempts: 2,
+		Delay:       time.Hour,
+	})
+	require.NoError(t, err)
+
+	transfer, err = transferController.GetScheduledTransfer(context.Background(), DB, transfer.Id)
+	require.NoError(t, err)
+	require.Equal(t, transferController.ScheduleActive, transfer.Status)
+	require.Equal(t, int32(1), transfer.Attempts)
+	require.NotNil(t, transfer.LastError)
+	require.WithinDuration(t, time.Now().Add(time.Hour), *transfer.NextRunAt, time.Minute)
+
+	// without a delay the second attempt is due at once and is the last
+	_, err = DB.Exec(`UPDATE scheduled_transfers SET next_run_at = now() WHERE id = $1`, transfer.Id)
+	require.NoError(t, err)
+	_, err = transferController.RunDueScheduledTransfers(context.Background(), DB, testRetryPolicy)
+	require.NoError(t, err)
+
+	transfer, err = transferController.GetScheduledTransfer(context.Background(), DB, transfer.Id)
+	require.NoError(t, err)
+	require.Equal(t, transferController.ScheduleFailed, transfer.Status)
+	require.Equal(t, int32(1), transfer.Runs)
+
+	runs, err := transferController.ListScheduledTransferRuns(context.Background(), DB, transfer.Id)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	for _, run := range runs {
+		require.Equal(t, transferController.RunFailed, run.Status)
+		require.Nil(t, run.TransferID)
+	}
+
+	account, err := accountController.GetAccountByID(context.Background(), DB, from.Id)
+	require.NoError(t, err)
+	require.Zero(t, account.Balance)
+}
+
+func TestScheduledTransferCancel(t *testing.T) {
+	from := createRandomAccountIn(t, "EUR")
+	to := createRandomAccountIn(t, "EUR")
+	transfer := createScheduledTransfer(t, from, to, schedule.Monthly, time.Now().Add(time.Hour), nil)
+
+	transfer, err := transferController.PauseScheduledTransfer(context.Background(), DB, transfer.Id)
+	require.NoError(t, err)
+	require.Equal(t, transferController.SchedulePaused, transfer.Status)
+
+	transfer, err = transferController.CancelScheduledTransfer(context.Background(), DB, transfer.Id)
+	require.NoError(t, err)
+	require.Equal(t, transferController.ScheduleCancelled, transfer.Status)
+
+	_, err = transferController.ResumeScheduledTransfer(context.Background(), DB, transfer.Id)
+	require.True(t, errors.Is(err, transferController.ErrScheduleNotActive))
+}
+
+func TestScheduleMonthlyOccurrence(t *testing.T) {
+	start := time.Date(2026, time.January, 31, 9, 0, 0, 0, time.UTC)
+
+	require.Equal(t, time.Date(2026, time.February, 28, 9, 0, 0, 0, time.UTC), schedule.Occurrence(schedule.Monthly, start, 1))
+	require.Equal(t, time.Date(2026, time.March, 31, 9, 0, 0, 0, time.UTC), schedule.Occurrence(schedule.Monthly, start, 2))
+	require.Equal(t, time.Date(2027, time.January, 31, 9, 0, 0, 0, time.UTC), schedule.Occurrence(schedule.Monthly, start, 12))
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"simplebank/api"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/token"
+	"simplebank/pkg/util"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testConfig is the configuration of the environment with in-process
+// backends and random secrets when none are set.
+func testConfig() util.Config {
+	config := util.LoadConfig()
+	config.RateLimitBackend = "memory"
+	config.MailerBackend = "memory"
+	if config.TokenSymmetricKey == "" {
+		config.TokenSymmetricKey = util.RandomString(util.MinSymmetricKeySize)
+	}
+	if config.TOTPEncryptionKey == "" {
+		config.TOTPEncryptionKey = util.RandomString(util.MinSymmetricKeySize)
+	}
+	return config
+}
+
+func newTestServer(t *testing.T) (*api.Server, util.Config) {
+	config := testConfig()
+	server, err := api.NewServer(config, DB, logger.New(io.Discard, slog.LevelError))
+	require.NoError(t, err)
+
+	return server, config
+}
+
+func accessTokenFor(t *testing.T, config util.Config, username string) string {
+	maker, err := token.NewJWTMaker(config.TokenSymmetricKey)
+	require.NoError(t, err)
+
+	accessToken, _, err := maker.CreateToken(username, token.PurposeAccess, time.Minute)
+	require.NoError(t, err)
+	return accessToken
+}
+
+func serve(server *api.Server, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+	return recorder
+}
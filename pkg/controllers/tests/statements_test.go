@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	statementController "simplebank/pkg/controllers/statement"
+	transferController "simplebank/pkg/controllers/transfer"
+	"simplebank/pkg/statement"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStatement(t *testing.T) {
+	from := createRandomAccountIn(t, "USD")
+	to := createRandomAccountIn(t, "USD")
+
+	transfer, err := transferController.TransferTx(context.Background(), DB, transferController.TransferTxParams{
+		FromAccountID: from.Id,
+		ToAccountID:   to.Id,
+		Amount:        40,
+	})
+	require.NoError(t, err)
+	deposit, err := transferController.DepositTx(context.Background(), DB, transferController.CashTxParams{
+		AccountID: from.Id,
+		Amount:    25,
+	})
+	require.NoError(t, err)
+
+	args := statementController.StatementParams{
+		AccountID: from.Id,
+		From:      time.Now().Add(-time.Hour),
+		To:        time.Now().Add(time.Hour),
+	}
+
+	var buf bytes.Buffer
+	writer, err := statement.NewWriter(statement.FormatJSON, &buf)
+	require.NoError(t, err)
+	require.NoError(t, statementController.WriteStatement(context.Background(), DB, args, writer))
+
+	var res struct {
+		statement.Header
+		Entries []statement.Line `json:"entries"`
+		statement.Summary
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &res))
+	require.Equal(t, from.Balance, res.OpeningBalance)
+	require.Equal(t, deposit.Account.Balance, res.ClosingBalance)
+	require.Equal(t, res.OpeningBalance+res.TotalCredits-res.TotalDebits, res.ClosingBalance)
+	require.Equal(t, len(res.Entries), res.EntryCount)
+	require.GreaterOrEqual(t, len(res.Entries), 2)
+
+	first := res.Entries[0]
+	require.Equal(t, int64(-40), first.Amount)
+	require.Equal(t, from.Balance-40, first.Balance)
+	require.Equal(t, transfer.Transfer.Id, *first.TransferID)
+	require.Equal(t, fmt.Sprintf("account %d", to.Id), first.Counterparty)
+
+	last := res.Entries[len(res.Entries)-1]
+	require.Equal(t, int64(25), last.Amount)
+	require.Equal(t, "cash deposit", last.Counterparty)
+	require.Equal(t, res.ClosingBalance, last.Balance)
+
+	// nothing before the period
+	args.To = args.From
+	args.From = args.From.Add(-time.Hour)
+	buf.Reset()
+	writer, err = statement.NewWriter(statement.FormatPDF, &buf)
+	require.NoError(t, err)
+	require.NoError(t, statementController.WriteStatement(context.Background(), DB, args, writer))
+	require.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+	require.True(t, bytes.HasSuffix(buf.Bytes(), []byte("%%EOF\n")))
+}
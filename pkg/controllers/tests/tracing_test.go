@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	accountController "simplebank/pkg/controllers/account"
+	"simplebank/pkg/tracing"
+	"simplebank/pkg/util"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider keeping the ended spans in memory
+// for the duration of the test.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	_, err := tracing.Init(context.Background(), tracing.Config{Exporter: tracing.ExporterNone})
+	require.NoError(t, err)
+
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func findSpan(t *testing.T, exporter *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			return span
+		}
+	}
+	require.FailNow(t, "span not found", name)
+	return tracetest.SpanStub{}
+}
+
+func TestTracingRequestSpan(t *testing.T) {
+	exporter := recordSpans(t)
+
+	server, _ := newTestServer(t)
+	serve(server, httptest.NewRequest(http.MethodGet, "/accounts/0", nil))
+
+	span := findSpan(t, exporter, "GET /accounts/:id")
+	require.Equal(t, trace.SpanKindServer, span.SpanKind)
+	require.True(t, span.SpanContext.IsValid())
+	require.False(t, span.Parent.IsValid())
+}
+
+func TestTracingPropagation(t *testing.T) {
+	exporter := recordSpans(t)
+	server, _ := newTestServer(t)
+
+	// the request continues the trace of the W3C traceparent header
+	req := httptest.NewRequest(http.MethodGet, "/accounts/0", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	serve(server, req)
+
+	span := findSpan(t, exporter, "GET /accounts/:id")
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+	require.True(t, span.Parent.IsRemote())
+}
+
+func TestTracingTransactionSpan(t *testing.T) {
+	exporter := recordSpans(t)
+
+	ctx, parent := tracing.Tracer().Start(context.Background(), "test")
+	_, err := accountController.CreateAccount(ctx, DB, accountController.CreateAccountParams{
+		Owner:    util.RandomOwner(),
+		Currency: util.RandomCurrency(),
+		Balance:  util.RandomMoney(),
+	})
+	require.NoError(t, err)
+	parent.End()
+
+	span := findSpan(t, exporter, "execTx")
+	require.Equal(t, parent.SpanContext().TraceID(), span.SpanContext.TraceID())
+	require.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+}
@@ -7,12 +7,14 @@ import (
 	transferController "simplebank/pkg/controllers/transfer"
 	"testing"
 
+	"github.com/pkg/errors"
+
 	"github.com/stretchr/testify/require"
 )
 
 func TestTransferTx(t *testing.T) {
 	account1 := createRandomAccount(t)
-	account2 := createRandomAccount(t)
+	account2 := createRandomAccountIn(t, account1.Currency)
 
 	n := 5
 	amount := int64(10)
@@ -103,3 +105,27 @@ func TestTransferTx(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, account2.Balance+int64(n)*amount, updatedAccount2.Balance)
 }
+
+func TestTransferTxInactiveAccount(t *testing.T) {
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccountIn(t, account1.Currency)
+
+	_, err := accountController.UpdateAccountStatus(context.Background(), DB, accountController.UpdateAccountStatusParams{
+		Id:     account2.Id,
+		Status: accountController.StatusFrozen,
+	})
+	require.NoError(t, err)
+
+	_, err = transferController.TransferTx(context.Background(), DB, transferController.TransferTxParams{
+		FromAccountID: account1.Id,
+		ToAccountID:   account2.Id,
+		Amount:        10,
+	})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, transferController.ErrAccountNotActive))
+
+	// nothing moved
+	updatedAccount1, err := accountController.GetAccountByID(context.Background(), DB, account1.Id)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance, updatedAccount1.Balance)
+}
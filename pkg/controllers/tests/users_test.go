@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	auditController "simplebank/pkg/controllers/audit"
+	userController "simplebank/pkg/controllers/user"
+	"simplebank/pkg/models"
+	"simplebank/pkg/rbac"
+	"simplebank/pkg/util"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomUser(t *testing.T) *models.User {
+	hashedPassword, err := util.HashPassword(util.RandomString(6))
+	require.NoError(t, err)
+
+	args := userController.CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: hashedPassword,
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	}
+
+	user, err := userController.CreateUser(context.Background(), DB, args)
+	require.NoError(t, err)
+	require.NotEmpty(t, user)
+
+	require.Equal(t, args.Username, user.Username)
+	require.Equal(t, args.HashedPassword, user.HashedPassword)
+	require.Equal(t, args.FullName, user.FullName)
+	require.Equal(t, args.Email, user.Email)
+	require.Equal(t, string(rbac.RoleCustomer), user.Role)
+	require.True(t, user.PasswordChangedAt.IsZero())
+	require.NotZero(t, user.CreatedAt)
+
+	return user
+}
+
+func TestCreateUser(t *testing.T) {
+	createRandomUser(t)
+}
+
+func TestGetUser(t *testing.T) {
+	user1 := createRandomUser(t)
+	user2, err := userController.GetUser(context.Background(), DB, user1.Username)
+	require.NoError(t, err)
+
+	require.Equal(t, user1.Username, user2.Username)
+	require.Equal(t, user1.HashedPassword, user2.HashedPassword)
+	require.Equal(t, user1.Email, user2.Email)
+	require.WithinDuration(t, user1.CreatedAt, user2.CreatedAt, time.Second)
+}
+
+func TestLoginLockout(t *testing.T) {
+	user := createRandomUser(t)
+	policy := userController.LockoutPolicy{
+		MaxAttempts: 3,
+		Window:      time.Minute,
+		Lockout:     time.Minute,
+		MaxLockout:  3 * time.Minute,
+	}
+
+	var err error
+	for i := int32(1); i < policy.MaxAttempts; i++ {
+		user, err = userController.RecordFailedLogin(context.Background(), DB, user.Username, policy)
+		require.NoError(t, err)
+		require.Equal(t, i, user.FailedLoginAttempts)
+		require.False(t, userController.IsLocked(user, time.Now()))
+	}
+
+	user, err = userController.RecordFailedLogin(context.Background(), DB, user.Username, policy)
+	require.NoError(t, err)
+	require.True(t, userController.IsLocked(user, time.Now()))
+	require.Equal(t, int32(1), user.LockoutCount)
+	require.WithinDuration(t, time.Now().Add(policy.Lockout), user.LockedUntil.Time, 5*time.Second)
+	requireLockAudit(t, "user.lock", user)
+
+	// the second lockout lasts twice as long
+	for i := int32(0); i < policy.MaxAttempts; i++ {
+		user, err = userController.RecordFailedLogin(context.Background(), DB, user.Username, policy)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(2), user.LockoutCount)
+	require.WithinDuration(t, time.Now().Add(2*policy.Lockout), user.LockedUntil.Time, 5*time.Second)
+
+	user, err = userController.UnlockUser(context.Background(), DB, user.Username)
+	require.NoError(t, err)
+	require.False(t, userController.IsLocked(user, time.Now()))
+	require.Zero(t, user.LockoutCount)
+	require.Zero(t, user.FailedLoginAttempts)
+	requireLockAudit(t, "user.unlock", user)
+}
+
+// requireLockAudit checks the last action event on user records its lockout
+// state.
+func requireLockAudit(t *testing.T, action string, user *models.User) {
+	events, err := auditController.ListAuditEvents(context.Background(), DB, auditController.ListAuditEventParams{
+		Action:     action,
+		EntityType: "user",
+		EntityID:   user.Username,
+		Limit:      100,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+
+	var after struct {
+		LockoutCount int32      `json:"lockout_count"`
+		LockedUntil  *time.Time `json:"locked_until"`
+	}
+	require.NoError(t, json.Unmarshal(events[len(events)-1].After, &after))
+	require.Equal(t, user.LockoutCount, after.LockoutCount)
+	if user.LockedUntil.Valid {
+		require.NotNil(t, after.LockedUntil)
+		require.WithinDuration(t, user.LockedUntil.Time, *after.LockedUntil, time.Second)
+	} else {
+		require.Nil(t, after.LockedUntil)
+	}
+}
+
+func TestResetFailedLogins(t *testing.T) {
+	user := createRandomUser(t)
+	policy := userController.LockoutPolicy{MaxAttempts: 5, Window: time.Minute, Lockout: time.Minute, MaxLockout: time.Hour}
+
+	_, err := userController.RecordFailedLogin(context.Background(), DB, user.Username, policy)
+	require.NoError(t, err)
+
+	err = userController.ResetFailedLogins(context.Background(), DB, user.Username)
+	require.NoError(t, err)
+
+	user, err = userController.GetUser(context.Background(), DB, user.Username)
+	require.NoError(t, err)
+	require.Zero(t, user.FailedLoginAttempts)
+	require.False(t, user.FirstFailedLoginAt.Valid)
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	user := createRandomUser(t)
+
+	user, err := userController.UpdateUserRole(context.Background(), DB, user.Username, string(rbac.RoleTeller))
+	require.NoError(t, err)
+	require.Equal(t, string(rbac.RoleTeller), user.Role)
+
+	_, err = userController.UpdateUserRole(context.Background(), DB, user.Username, "superuser")
+	require.Error(t, err)
+}
+
+func TestRolePermissions(t *testing.T) {
+	require.True(t, rbac.RoleCustomer.Can(rbac.CreateOwnTransfers))
+	require.False(t, rbac.RoleCustomer.Can(rbac.ReadAllAccounts))
+	require.False(t, rbac.RoleCustomer.Can(rbac.ReadAudit))
+
+	require.True(t, rbac.RoleTeller.Can(rbac.PostCash))
+	require.False(t, rbac.RoleTeller.Can(rbac.ManageUsers))
+
+	require.True(t, rbac.RoleAuditor.Can(rbac.ReadAudit))
+	require.True(t, rbac.RoleAuditor.Can(rbac.ReadAllAccounts))
+	require.False(t, rbac.RoleAuditor.Can(rbac.CreateOwnTransfers))
+	require.False(t, rbac.RoleAuditor.Can(rbac.PostCash))
+	require.True(t, rbac.RoleAuditor.Can(rbac.ReadFees))
+	require.False(t, rbac.RoleAuditor.Can(rbac.ManageFees))
+	require.True(t, rbac.RoleAuditor.Can(rbac.ReadLimits))
+	require.False(t, rbac.RoleAuditor.Can(rbac.ManageLimits))
+
+	require.True(t, rbac.RoleAdmin.Can(rbac.ManageUsers))
+
+	for _, role := range rbac.Roles() {
+		require.True(t, role.Valid())
+	}
+	require.False(t, rbac.Role("superuser").Valid())
+}
@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const transferApprovalColumns = `id, hold_id, initiator, from_account_id, to_account_id, amount, status, decided_by, decision_reason,
+	decided_at, transfer_id, expires_at, created_at, updated_at`
+
+// Transfer approval statuses, only pending ones can be decided.
+const (
+	ApprovalPending  = "pending_approval"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+)
+
+var (
+	// ErrApprovalNotPending is returned when deciding a transfer that was
+	// already approved, rejected or has expired.
+	ErrApprovalNotPending = errors.New("transfer is not pending approval")
+	// ErrSelfApproval is returned when the initiator of a transfer tries to
+	// decide it.
+	ErrSelfApproval = errors.New("transfer can't be decided by its initiator")
+)
+
+type (
+	RequestTransferApprovalParams struct {
+		Initiator     string    `json:"initiator"`
+		FromAccountID int64     `json:"from_account_id"`
+		ToAccountID   int64     `json:"to_account_id"`
+		Amount        int64     `json:"amount"`
+		ExpiresAt     time.Time `json:"expires_at"`
+	}
+
+	DecideTransferParams struct {
+		ApprovalID int64  `json:"approval_id"`
+		Approver   string `json:"approver"`
+		Reason     string `json:"reason"`
+	}
+
+	ListTransferApprovalsParams struct {
+		// Status and Initiator narrow the list when set.
+		Status    string `json:"status"`
+		Initiator string `json:"initiator"`
+		Limit     int32  `json:"limit"`
+		Offset    int32  `json:"offset"`
+	}
+
+	ApproveTransferResult struct {
+		Approval *models.TransferApproval `json:"approval"`
+		Transfer *TransferTxResult        `json:"transfer"`
+	}
+)
+
+// RequestTransferApproval puts a transfer on hold until someone other than
+// its initiator approves it. The funds are held meanwhile, so the transfer
+// can't fail for lack of them once approved.
+func RequestTransferApproval(ctx context.Context, db connection.DBTX, args RequestTransferApprovalParams) (*models.TransferApproval, error) {
+	query := `INSERT INTO transfer_approvals ("hold_id", "initiator", "from_account_id", "to_account_id", "amount", "expires_at")
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING ` + transferApprovalColumns
+
+	var res models.TransferApproval
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		// the hold expires with the request and the hold sweep releases it
+		hold, err := AuthorizeHold(ctx, tx, AuthorizeHoldParams{
+			AccountID:   args.FromAccountID,
+			ToAccountID: args.ToAccountID,
+			Amount:      args.Amount,
+			ExpiresAt:   args.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = scanTransferApproval(tx.QueryRowContext(ctx, query, hold.Id, args.Initiator, args.FromAccountID, args.ToAccountID,
+			args.Amount, args.ExpiresAt), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "transfer_approval.request",
+			EntityType: "transfer_approval",
+			EntityID:   res.Id,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, errors.Wrap(err, "failed execTx")
+	}
+
+	logger.FromContext(ctx).Info("transfer pending approval", "approval_id", res.Id, "initiator", res.Initiator, "amount", res.Amount)
+	return &res, nil
+}
+
+// ApproveTransfer makes the transfer with the held funds. Limits and fees
+// apply as of now, a transfer they stop stays pending and can be rejected.
+func ApproveTransfer(ctx context.Context, db connection.DBTX, args DecideTransferParams) (*ApproveTransferResult, error) {
+	var result ApproveTransferResult
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := getPendingApprovalForUpdate(ctx, tx, args.ApprovalID, args.Approver)
+		if err != nil {
+			return err
+		}
+
+		capture, err := captureHold(ctx, tx, CaptureHoldParams{HoldID: before.HoldID})
+		if err != nil {
+			return err
+		}
+		result.Transfer = capture.Transfer
+
+		result.Approval, err = decideTransfer(ctx, tx, "transfer_approval.approve", before, ApprovalApproved, args,
+			&capture.Transfer.Transfer.Id)
+		return err
+	})
+	if err != nil {
+		return &result, errors.Wrap(err, "failed execTx")
+	}
+
+	logger.FromContext(ctx).Info("transfer approved", "approval_id", result.Approval.Id, "approver", args.Approver,
+		"transfer_id", result.Transfer.Transfer.Id)
+	return &result, nil
+}
+
+// RejectTransfer drops the transfer and releases the held funds.
+func RejectTransfer(ctx context.Context, db connection.DBTX, args DecideTransferParams) (*models.TransferApproval, error) {
+	var res *models.TransferApproval
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := getPendingApprovalForUpdate(ctx, tx, args.ApprovalID, args.Approver)
+		if err != nil {
+			return err
+		}
+
+		if _, err := voidHold(ctx, tx, before.HoldID); err != nil {
+			return err
+		}
+
+		res, err = decideTransfer(ctx, tx, "transfer_approval.reject", before, ApprovalRejected, args, nil)
+		return err
+	})
+	if err != nil {
+		return res, errors.Wrap(err, "failed execTx")
+	}
+
+	logger.FromContext(ctx).Info("transfer rejected", "approval_id", res.Id, "approver", args.Approver)
+	return res, nil
+}
+
+// ExpireTransferApprovals marks the requests nobody decided in time as
+// expired and returns how many. Their holds expire at the same time and
+// are released by ExpireHolds.
+func ExpireTransferApprovals(ctx context.Context, db connection.DBTX) (int, error) {
+	query := `UPDATE transfer_approvals SET status = $2, updated_at = now()
+		WHERE status = $1 AND expires_at <= now() RETURNING ` + transferApprovalColumns
+
+	var expired int
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		rows, err := tx.QueryContext(ctx, query, ApprovalPending, ApprovalExpired)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		var approvals []models.TransferApproval
+		for rows.Next() {
+			var approval models.TransferApproval
+			if err := scanTransferApproval(rows, &approval); err != nil {
+				rows.Close()
+				return errors.Wrap(err, "failed scanning the row")
+			}
+			approvals = append(approvals, approval)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		for _, approval := range approvals {
+			before := approval
+			before.Status = ApprovalPending
+			_, err := auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+				Action:     "transfer_approval.expire",
+				EntityType: "transfer_approval",
+				EntityID:   approval.Id,
+				Before:     before,
+				After:      approval,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		expired = len(approvals)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if expired > 0 {
+		logger.FromContext(ctx).Info("transfer approvals expired", "count", expired)
+	}
+	return expired, nil
+}
+
+func GetTransferApproval(ctx context.Context, db connection.DBTX, id int64) (*models.TransferApproval, error) {
+	query := `SELECT ` + transferApprovalColumns + ` FROM transfer_approvals WHERE id = $1 LIMIT 1`
+
+	var res models.TransferApproval
+	err := scanTransferApproval(db.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// ListTransferApprovals returns the approval requests, the oldest first so
+// approvers work through them in order.
+func ListTransferApprovals(ctx context.Context, db connection.DBTX, args ListTransferApprovalsParams) ([]models.TransferApproval, error) {
+	query := `SELECT ` + transferApprovalColumns + ` FROM transfer_approvals
+		WHERE ($1 = '' OR status = $1)
+		AND ($2 = '' OR initiator = $2)
+		ORDER BY id LIMIT $3 OFFSET $4`
+
+	rows, err := db.QueryContext(ctx, query, args.Status, args.Initiator, args.Limit, args.Offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	res := []models.TransferApproval{}
+	for rows.Next() {
+		var approval models.TransferApproval
+		if err := scanTransferApproval(rows, &approval); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		res = append(res, approval)
+	}
+
+	return res, rows.Err()
+}
+
+// getPendingApprovalForUpdate locks the approval request and checks
+// approver can still decide it. A request past its expiry counts as expired
+// even before ExpireTransferApprovals got to it.
+func getPendingApprovalForUpdate(ctx context.Context, tx connection.DBTX, id int64, approver string) (*models.TransferApproval, error) {
+	query := `SELECT ` + transferApprovalColumns + ` FROM transfer_approvals WHERE id = $1 LIMIT 1 FOR UPDATE`
+
+	var res models.TransferApproval
+	err := scanTransferApproval(tx.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return nil, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	if res.Status != ApprovalPending {
+		return nil, errors.Wrapf(ErrApprovalNotPending, "transfer approval [%d] is %s", res.Id, res.Status)
+	}
+	if !res.ExpiresAt.After(time.Now()) {
+		return nil, errors.Wrapf(ErrApprovalNotPending, "transfer approval [%d] expired at %s", res.Id, res.ExpiresAt)
+	}
+	if res.Initiator == approver {
+		return nil, errors.Wrapf(ErrSelfApproval, "%s initiated transfer approval [%d]", approver, res.Id)
+	}
+	return &res, nil
+}
+
+// decideTransfer records the decision on a locked approval request.
+func decideTransfer(ctx context.Context, tx connection.DBTX, action string, before *models.TransferApproval, status string,
+	args DecideTransferParams, transferID *int64) (*models.TransferApproval, error) {
+	query := `UPDATE transfer_approvals SET status = $2, decided_by = $3, decision_reason = NULLIF($4, ''), decided_at = now(),
+		transfer_id = $5, updated_at = now()
+		WHERE id = $1 RETURNING ` + transferApprovalColumns
+
+	var res models.TransferApproval
+	err := scanTransferApproval(tx.QueryRowContext(ctx, query, before.Id, status, args.Approver, args.Reason, transferID), &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed update")
+	}
+
+	_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+		Action:     action,
+		EntityType: "transfer_approval",
+		EntityID:   res.Id,
+		Before:     before,
+		After:      res,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func scanTransferApproval(row scanner, approval *models.TransferApproval) error {
+	return row.Scan(&approval.Id, &approval.HoldID, &approval.Initiator, &approval.FromAccountID, &approval.ToAccountID,
+		&approval.Amount, &approval.Status, &approval.DecidedBy, &approval.DecisionReason, &approval.DecidedAt,
+		&approval.TransferID, &approval.ExpiresAt, &approval.CreatedAt, &approval.UpdatedAt)
+}
@@ -0,0 +1,354 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"simplebank/pkg/connection"
+	accountController "simplebank/pkg/controllers/account"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const transferBatchColumns = `id, owner, mode, status, item_count, succeeded_count, failed_count, created_at, completed_at`
+
+const transferBatchItemColumns = `id, batch_id, position, from_account_id, to_account_id, amount, status, transfer_id, error`
+
+// Batch modes. An atomic batch makes all its transfers or none, a best
+// effort one makes each transfer that can be made.
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+// Batch statuses, a batch is processing until each item is decided.
+const (
+	BatchProcessing         = "processing"
+	BatchCompleted          = "completed"
+	BatchPartiallyCompleted = "partially_completed"
+	BatchFailed             = "failed"
+)
+
+// Batch item statuses. Skipped items weren't made because another item of
+// an atomic batch failed.
+const (
+	ItemPending   = "pending"
+	ItemSucceeded = "succeeded"
+	ItemFailed    = "failed"
+	ItemSkipped   = "skipped"
+)
+
+type (
+	TransferBatchItemParams struct {
+		FromAccountID int64 `json:"from_account_id"`
+		ToAccountID   int64 `json:"to_account_id"`
+		Amount        int64 `json:"amount"`
+	}
+
+	CreateTransferBatchParams struct {
+		Owner string                    `json:"owner"`
+		Mode  string                    `json:"mode"`
+		Items []TransferBatchItemParams `json:"items"`
+	}
+
+	TransferBatchResult struct {
+		Batch *models.TransferBatch      `json:"batch"`
+		Items []models.TransferBatchItem `json:"items"`
+	}
+)
+
+// CreateTransferBatch records a batch of transfers and makes them, in the
+// order given. The batch and its items are stored first so the outcome of
+// every item can be looked up whatever happens to the transfers.
+func CreateTransferBatch(ctx context.Context, db connection.DBTX, args CreateTransferBatchParams) (*TransferBatchResult, error) {
+	batch, items, err := insertTransferBatch(ctx, db, args)
+	if err != nil {
+		return &TransferBatchResult{}, err
+	}
+
+	if args.Mode == BatchAtomic {
+		err = runAtomicBatch(ctx, db, items)
+	} else {
+		err = runBestEffortBatch(ctx, db, items)
+	}
+	if err != nil {
+		return &TransferBatchResult{Batch: batch, Items: items}, err
+	}
+
+	batch, err = completeTransferBatch(ctx, db, batch.Id, items)
+	if err != nil {
+		return &TransferBatchResult{Items: items}, err
+	}
+
+	logger.FromContext(ctx).Info("transfer batch processed", "batch_id", batch.Id, "mode", batch.Mode, "status", batch.Status,
+		"succeeded", batch.SucceededCount, "failed", batch.FailedCount)
+	return &TransferBatchResult{Batch: batch, Items: items}, nil
+}
+
+// runAtomicBatch makes every transfer in one transaction. The accounts of
+// the batch and the revenue accounts of their currencies are locked first,
+// in id order like any transfer does, so a batch can't deadlock with other
+// transfers whatever the order of its items. The first item to fail rolls
+// back the batch and the other items are skipped.
+func runAtomicBatch(ctx context.Context, db connection.DBTX, items []models.TransferBatchItem) error {
+	lockQuery := `SELECT id FROM accounts
+		WHERE id = ANY($1) OR (kind = $2 AND currency IN (SELECT currency FROM accounts WHERE id = ANY($1)))
+		ORDER BY id FOR UPDATE`
+
+	ids := make([]int64, 0, 2*len(items))
+	for _, item := range items {
+		ids = append(ids, item.FromAccountID, item.ToAccountID)
+	}
+
+	failed := -1
+	var itemErr error
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		// reset by a retry of the transaction
+		failed, itemErr = -1, nil
+
+		rows, err := tx.QueryContext(ctx, lockQuery, pq.Int64Array(ids), accountController.KindRevenue)
+		if err != nil {
+			return errors.Wrap(err, "failed retrieving the rows")
+		}
+		// the accounts are locked as the rows are read
+		for rows.Next() {
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return errors.Wrap(err, "failed retrieving the rows")
+		}
+
+		for i := range items {
+			result, err := TransferTx(ctx, tx, TransferTxParams{
+				FromAccountID: items[i].FromAccountID,
+				ToAccountID:   items[i].ToAccountID,
+				Amount:        items[i].Amount,
+			})
+			if err != nil {
+				failed, itemErr = i, err
+				return err
+			}
+			items[i].Status, items[i].TransferID = ItemSucceeded, &result.Transfer.Id
+		}
+
+		return updateTransferBatchItems(ctx, tx, items)
+	})
+	if err == nil {
+		return nil
+	}
+	if failed < 0 {
+		return err
+	}
+
+	logger.FromContext(ctx).Warn("atomic transfer batch failed", "batch_id", items[failed].BatchID, "position", failed, "error", itemErr)
+	message := itemErr.Error()
+	for i := range items {
+		items[i].Status, items[i].TransferID, items[i].Error = ItemSkipped, nil, nil
+	}
+	items[failed].Status, items[failed].Error = ItemFailed, &message
+
+	return updateTransferBatchItems(ctx, db, items)
+}
+
+// runBestEffortBatch makes each transfer in its own transaction, together
+// with the status of its item. A failed item doesn't stop the others.
+func runBestEffortBatch(ctx context.Context, db connection.DBTX, items []models.TransferBatchItem) error {
+	for i := range items {
+		item := &items[i]
+		err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+			result, err := TransferTx(ctx, tx, TransferTxParams{
+				FromAccountID: item.FromAccountID,
+				ToAccountID:   item.ToAccountID,
+				Amount:        item.Amount,
+			})
+			if err != nil {
+				return err
+			}
+
+			succeeded := *item
+			succeeded.Status, succeeded.TransferID = ItemSucceeded, &result.Transfer.Id
+			if err := updateTransferBatchItems(ctx, tx, []models.TransferBatchItem{succeeded}); err != nil {
+				return err
+			}
+			*item = succeeded
+			return nil
+		})
+		if err == nil {
+			continue
+		}
+
+		message := err.Error()
+		item.Status, item.Error = ItemFailed, &message
+		if err := updateTransferBatchItems(ctx, db, []models.TransferBatchItem{*item}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func GetTransferBatch(ctx context.Context, db connection.DBTX, id int64) (*models.TransferBatch, error) {
+	query := `SELECT ` + transferBatchColumns + ` FROM transfer_batches WHERE id = $1 LIMIT 1`
+
+	var res models.TransferBatch
+	err := scanTransferBatch(db.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// ListTransferBatchItems returns the items of a batch in their order.
+func ListTransferBatchItems(ctx context.Context, db connection.DBTX, batchID int64) ([]models.TransferBatchItem, error) {
+	query := `SELECT ` + transferBatchItemColumns + ` FROM transfer_batch_items WHERE batch_id = $1 ORDER BY position`
+
+	rows, err := db.QueryContext(ctx, query, batchID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	res := []models.TransferBatchItem{}
+	for rows.Next() {
+		var item models.TransferBatchItem
+		if err := scanTransferBatchItem(rows, &item); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		res = append(res, item)
+	}
+
+	return res, rows.Err()
+}
+
+func insertTransferBatch(ctx context.Context, db connection.DBTX, args CreateTransferBatchParams) (*models.TransferBatch, []models.TransferBatchItem, error) {
+	batchQuery := `INSERT INTO transfer_batches ("owner", "mode", "item_count") VALUES ($1, $2, $3) RETURNING ` + transferBatchColumns
+	itemsQuery := `INSERT INTO transfer_batch_items ("batch_id", "position", "from_account_id", "to_account_id", "amount")
+		SELECT $1, item.* FROM unnest($2::int[], $3::bigint[], $4::bigint[], $5::bigint[]) AS item
+		RETURNING ` + transferBatchItemColumns
+
+	positions := make([]int64, len(args.Items))
+	from := make([]int64, len(args.Items))
+	to := make([]int64, len(args.Items))
+	amounts := make([]int64, len(args.Items))
+	for i, item := range args.Items {
+		positions[i], from[i], to[i], amounts[i] = int64(i), item.FromAccountID, item.ToAccountID, item.Amount
+	}
+
+	var batch models.TransferBatch
+	items := make([]models.TransferBatchItem, len(args.Items))
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		err := scanTransferBatch(tx.QueryRowContext(ctx, batchQuery, args.Owner, args.Mode, len(args.Items)), &batch)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		rows, err := tx.QueryContext(ctx, itemsQuery, batch.Id, pq.Int64Array(positions), pq.Int64Array(from), pq.Int64Array(to),
+			pq.Int64Array(amounts))
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var item models.TransferBatchItem
+			if err := scanTransferBatchItem(rows, &item); err != nil {
+				return errors.Wrap(err, "failed scanning the row")
+			}
+			items[item.Position] = item
+		}
+		if err := rows.Err(); err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "transfer_batch.create",
+			EntityType: "transfer_batch",
+			EntityID:   batch.Id,
+			After:      batch,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &batch, items, nil
+}
+
+// updateTransferBatchItems writes the status, transfer and error of items.
+func updateTransferBatchItems(ctx context.Context, db connection.DBTX, items []models.TransferBatchItem) error {
+	query := `UPDATE transfer_batch_items SET status = item.status, transfer_id = item.transfer_id, error = item.error
+		FROM unnest($1::bigint[], $2::varchar[], $3::bigint[], $4::varchar[]) AS item(id, status, transfer_id, error)
+		WHERE transfer_batch_items.id = item.id`
+
+	ids := make([]int64, len(items))
+	statuses := make([]string, len(items))
+	transferIDs := make([]sql.NullInt64, len(items))
+	messages := make([]sql.NullString, len(items))
+	for i, item := range items {
+		ids[i], statuses[i] = item.Id, item.Status
+		if item.TransferID != nil {
+			transferIDs[i] = sql.NullInt64{Int64: *item.TransferID, Valid: true}
+		}
+		if item.Error != nil {
+			messages[i] = sql.NullString{String: *item.Error, Valid: true}
+		}
+	}
+
+	_, err := db.ExecContext(ctx, query, pq.Int64Array(ids), pq.StringArray(statuses), pq.GenericArray{A: transferIDs},
+		pq.GenericArray{A: messages})
+	if err != nil {
+		return errors.Wrap(err, "failed update")
+	}
+
+	return nil
+}
+
+// completeTransferBatch sets the final status and counts of a batch from
+// its items.
+func completeTransferBatch(ctx context.Context, db connection.DBTX, id int64, items []models.TransferBatchItem) (*models.TransferBatch, error) {
+	query := `UPDATE transfer_batches SET status = $2, succeeded_count = $3, failed_count = $4, completed_at = now()
+		WHERE id = $1 RETURNING ` + transferBatchColumns
+
+	var succeeded, failed int32
+	for _, item := range items {
+		switch item.Status {
+		case ItemSucceeded:
+			succeeded++
+		case ItemFailed:
+			failed++
+		}
+	}
+
+	status := BatchPartiallyCompleted
+	switch {
+	case int(succeeded) == len(items):
+		status = BatchCompleted
+	case succeeded == 0:
+		status = BatchFailed
+	}
+
+	var res models.TransferBatch
+	err := scanTransferBatch(db.QueryRowContext(ctx, query, id, status, succeeded, failed), &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed update")
+	}
+
+	return &res, nil
+}
+
+func scanTransferBatch(row scanner, batch *models.TransferBatch) error {
+	return row.Scan(&batch.Id, &batch.Owner, &batch.Mode, &batch.Status, &batch.ItemCount, &batch.SucceededCount,
+		&batch.FailedCount, &batch.CreatedAt, &batch.CompletedAt)
+}
+
+func scanTransferBatchItem(row scanner, item *models.TransferBatchItem) error {
+	return row.Scan(&item.Id, &item.BatchID, &item.Position, &item.FromAccountID, &item.ToAccountID, &item.Amount, &item.Status,
+		&item.TransferID, &item.Error)
+}
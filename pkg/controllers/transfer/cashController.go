@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"simplebank/pkg/connection"
+	accountController "simplebank/pkg/controllers/account"
+	auditController "simplebank/pkg/controllers/audit"
+	entryController "simplebank/pkg/controllers/entry"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/metrics"
+	"simplebank/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	CashTxParams struct {
+		AccountID int64 `json:"account_id"`
+		Amount    int64 `json:"amount"`
+	}
+
+	CashTxResult struct {
+		Account         *models.Account `json:"account"`
+		Entry           *models.Entry   `json:"entry"`
+		SettlementEntry *models.Entry   `json:"settlement_entry"`
+	}
+)
+
+// DepositTx credits cash paid in at a counter to an account. The settlement
+// account of the currency is debited by the same amount.
+func DepositTx(ctx context.Context, db connection.DBTX, args CashTxParams) (*CashTxResult, error) {
+	return cashTx(ctx, db, entryController.TypeDeposit, args.AccountID, args.Amount)
+}
+
+// WithdrawTx debits cash paid out at a counter from an account, failing with
+// ErrInsufficientFunds when the balance and overdraft don't cover it. The settlement
+// account of the currency is credited by the same amount.
+func WithdrawTx(ctx context.Context, db connection.DBTX, args CashTxParams) (*CashTxResult, error) {
+	return cashTx(ctx, db, entryController.TypeWithdrawal, args.AccountID, -args.Amount)
+}
+
+func cashTx(ctx context.Context, db connection.DBTX, entryType string, accountID int64, amount int64) (*CashTxResult, error) {
+	var result CashTxResult
+
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		account, err := accountController.GetAccountByID(ctx, tx, accountID)
+		if err != nil {
+			return err
+		}
+		if account.Kind != accountController.KindCustomer {
+			return errors.Wrapf(ErrNotCustomerAccount, "account [%d] is a %s account", account.Id, account.Kind)
+		}
+
+		settlement, err := accountController.GetSettlementAccount(ctx, tx, account.Currency)
+		if err != nil {
+			return err
+		}
+
+		result.Entry, err = entryController.CreateEntry(ctx, tx, entryController.CreateEntryParams{
+			AccountID:             account.Id,
+			Amount:                amount,
+			Type:                  entryType,
+			CounterpartyAccountID: &settlement.Id,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.SettlementEntry, err = entryController.CreateEntry(ctx, tx, entryController.CreateEntryParams{
+			AccountID:             settlement.Id,
+			Amount:                -amount,
+			Type:                  entryType,
+			CounterpartyAccountID: &account.Id,
+		})
+		if err != nil {
+			return err
+		}
+
+		accounts, err := applyBalanceChanges(ctx, tx, map[int64]int64{account.Id: amount, settlement.Id: -amount})
+		if err != nil {
+			return err
+		}
+		result.Account = accounts[account.Id]
+		if amount < 0 {
+			if err := checkFunds(result.Account); err != nil {
+				return err
+			}
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "account." + entryType,
+			EntityType: "account",
+			EntityID:   account.Id,
+			Before:     account,
+			After:      result.Account,
+		})
+		return err
+	})
+	if err != nil {
+		return &result, errors.Wrap(err, "failed execTx")
+	}
+
+	metrics.CashOperations.WithLabelValues(entryType, result.Account.Currency).Inc()
+	logger.FromContext(ctx).Info("cash operation posted", "type", entryType, "account_id", result.Account.Id, "amount", amount)
+	return &result, nil
+}
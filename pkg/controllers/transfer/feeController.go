@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"context"
+	"simplebank/pkg/connection"
+	accountController "simplebank/pkg/controllers/account"
+	feeController "simplebank/pkg/controllers/fee"
+	"simplebank/pkg/fees"
+	"simplebank/pkg/models"
+)
+
+// FeePreview is what a transfer would cost without making it.
+type FeePreview struct {
+	Currency string          `json:"currency"`
+	Amount   int64           `json:"amount"`
+	Fee      int64           `json:"fee"`
+	Total    int64           `json:"total"`
+	Rule     *models.FeeRule `json:"rule,omitempty"`
+}
+
+// PreviewFee returns the fee TransferTx would charge for args with the
+// current rules.
+func PreviewFee(ctx context.Context, db connection.DBTX, args TransferTxParams) (*FeePreview, error) {
+	from, err := accountController.GetAccountByID(ctx, db, args.FromAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	fee, rule, err := computeFee(ctx, db, from, args.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FeePreview{
+		Currency: from.Currency,
+		Amount:   args.Amount,
+		Fee:      fee,
+		Total:    args.Amount + fee,
+		Rule:     rule,
+	}, nil
+}
+
+func computeFee(ctx context.Context, db connection.DBTX, from *models.Account, amount int64) (int64, *models.FeeRule, error) {
+	rules, err := feeController.ListFeeRules(ctx, db)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	fee, rule := fees.Fee(rules, from.Currency, from.Tier, amount)
+	return fee, rule, nil
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"simplebank/pkg/connection"
+	accountController "simplebank/pkg/controllers/account"
+	entryController "simplebank/pkg/controllers/entry"
+	fxController "simplebank/pkg/controllers/fx"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+type FXTransferTxParams struct {
+	FromAccountID int64  `json:"from_account_id"`
+	ToAccountID   int64  `json:"to_account_id"`
+	QuoteID       string `json:"quote_id"`
+	// Username is who redeems the quote, it has to be the user it was
+	// given to.
+	Username string `json:"username"`
+}
+
+// FXTransferTx moves money between accounts of different currencies at the
+// rate locked by a quote. The source account is debited the quoted amount in
+// its currency and the destination credited the converted amount in its
+// own. Each currency's settlement account takes the other side so the
+// entries of every currency still sum to zero.
+func FXTransferTx(ctx context.Context, db connection.DBTX, args FXTransferTxParams) (*TransferTxResult, error) {
+	var result TransferTxResult
+
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		quote, err := fxController.ConsumeQuote(ctx, tx, args.QuoteID, args.Username)
+		if err != nil {
+			return err
+		}
+
+		fromSettlement, err := accountController.GetSettlementAccount(ctx, tx, quote.FromCurrency)
+		if err != nil {
+			return err
+		}
+		toSettlement, err := accountController.GetSettlementAccount(ctx, tx, quote.ToCurrency)
+		if err != nil {
+			return err
+		}
+
+		result.Transfer, err = insertTransfer(ctx, tx, models.Transfer{
+			FromAccountID: args.FromAccountID,
+			ToAccountID:   args.ToAccountID,
+			Amount:        quote.FromAmount,
+			ToAmount:      quote.ToAmount,
+			ExchangeRate:  &quote.Rate,
+			SpreadBps:     &quote.SpreadBps,
+			QuoteID:       &quote.Id,
+		})
+		if err != nil {
+			return err
+		}
+
+		// each side of the exchange is booked against its settlement account,
+		// the customers still see each other as counterparties
+		legs := []struct {
+			accountID      int64
+			amount         int64
+			entryType      string
+			counterpartyID int64
+			entry          **models.Entry
+		}{
+			{args.FromAccountID, -quote.FromAmount, entryController.TypeTransfer, args.ToAccountID, &result.EntryFrom},
+			{fromSettlement.Id, quote.FromAmount, entryController.TypeExchange, args.FromAccountID, nil},
+			{toSettlement.Id, -quote.ToAmount, entryController.TypeExchange, args.ToAccountID, nil},
+			{args.ToAccountID, quote.ToAmount, entryController.TypeTransfer, args.FromAccountID, &result.EntryTo},
+		}
+		changes := make(map[int64]int64, len(legs))
+		for _, leg := range legs {
+			counterpartyID := leg.counterpartyID
+			entry, err := entryController.CreateEntry(ctx, tx, entryController.CreateEntryParams{
+				AccountID:             leg.accountID,
+				Amount:                leg.amount,
+				Type:                  leg.entryType,
+				TransferID:            &result.Transfer.Id,
+				CounterpartyAccountID: &counterpartyID,
+			})
+			if err != nil {
+				return err
+			}
+			if leg.entry != nil {
+				*leg.entry = entry
+			}
+			changes[leg.accountID] += leg.amount
+		}
+
+		accounts, err := applyBalanceChanges(ctx, tx, changes)
+		if err != nil {
+			return err
+		}
+		result.FromAccount, result.ToAccount = accounts[args.FromAccountID], accounts[args.ToAccountID]
+
+		for _, account := range []*models.Account{result.FromAccount, result.ToAccount} {
+			if account.Kind != accountController.KindCustomer {
+				return errors.Wrapf(ErrNotCustomerAccount, "account [%d] is a %s account", account.Id, account.Kind)
+			}
+		}
+		if result.FromAccount.Currency != quote.FromCurrency || result.ToAccount.Currency != quote.ToCurrency {
+			return errors.Wrapf(ErrCurrencyMismatch, "quote is %s to %s, accounts are %s to %s",
+				quote.FromCurrency, quote.ToCurrency, result.FromAccount.Currency, result.ToAccount.Currency)
+		}
+		if err := checkFunds(result.FromAccount); err != nil {
+			return err
+		}
+		if err := checkLimits(ctx, tx, result.FromAccount, quote.FromAmount); err != nil {
+			return err
+		}
+
+		recordTransfer(tx, result.FromAccount.Currency, result.Transfer.Amount)
+		return nil
+	})
+	if err != nil {
+		return &result, errors.Wrap(err, "failed execTx")
+	}
+
+	logger.FromContext(ctx).Info("fx transfer", "transfer_id", result.Transfer.Id, "quote_id", args.QuoteID,
+		"rate", *result.Transfer.ExchangeRate, "spread_bps", *result.Transfer.SpreadBps)
+	return &result, nil
+}
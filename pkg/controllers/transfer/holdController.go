@@ -0,0 +1,361 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"simplebank/pkg/connection"
+	accountController "simplebank/pkg/controllers/account"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const holdColumns = `id, account_id, to_account_id, amount, captured_amount, status, transfer_id, expires_at, created_at, updated_at`
+
+// Hold statuses, only authorized holds reserve funds.
+const (
+	HoldAuthorized = "authorized"
+	HoldCaptured   = "captured"
+	HoldVoided     = "voided"
+	HoldExpired    = "expired"
+)
+
+// expireBatchSize bounds how many holds one ExpireHolds call releases.
+const expireBatchSize = 100
+
+var (
+	// ErrHoldNotAuthorized is returned when capturing or voiding a hold that
+	// was already captured, voided or has expired.
+	ErrHoldNotAuthorized = errors.New("hold is no longer authorized")
+	// ErrCaptureExceedsHold is returned when capturing more than was held.
+	ErrCaptureExceedsHold = errors.New("capture exceeds the held amount")
+	// ErrHoldPendingApproval is returned when capturing or voiding a hold
+	// that reserves the funds of a transfer waiting for approval, which is
+	// only settled by deciding the transfer.
+	ErrHoldPendingApproval = errors.New("hold backs a transfer pending approval")
+)
+
+type (
+	AuthorizeHoldParams struct {
+		AccountID   int64     `json:"account_id"`
+		ToAccountID int64     `json:"to_account_id"`
+		Amount      int64     `json:"amount"`
+		ExpiresAt   time.Time `json:"expires_at"`
+	}
+
+	CaptureHoldParams struct {
+		HoldID int64 `json:"hold_id"`
+		// Amount defaults to the whole hold. What isn't captured is released.
+		Amount int64 `json:"amount"`
+	}
+
+	CaptureHoldResult struct {
+		Hold     *models.Hold      `json:"hold"`
+		Transfer *TransferTxResult `json:"transfer"`
+	}
+)
+
+// AuthorizeHold reserves amount on the account for a later capture to
+// ToAccountID. The available balance goes down, the balance doesn't move.
+func AuthorizeHold(ctx context.Context, db connection.DBTX, args AuthorizeHoldParams) (*models.Hold, error) {
+	query := `INSERT INTO holds ("account_id", "to_account_id", "amount", "expires_at")
+		VALUES ($1, $2, $3, $4) RETURNING ` + holdColumns
+
+	var res models.Hold
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		to, err := accountController.GetAccountByID(ctx, tx, args.ToAccountID)
+		if err != nil {
+			return err
+		}
+
+		from, err := getActiveAccountForUpdate(ctx, tx, args.AccountID)
+		if err != nil {
+			return err
+		}
+		for _, account := range []*models.Account{from, to} {
+			if account.Kind != accountController.KindCustomer {
+				return errors.Wrapf(ErrNotCustomerAccount, "account [%d] is a %s account", account.Id, account.Kind)
+			}
+		}
+		if from.Currency != to.Currency {
+			return errors.Wrapf(ErrCurrencyMismatch, "%s to %s", from.Currency, to.Currency)
+		}
+
+		from, err = accountController.AddHeldAmount(ctx, tx, from.Id, args.Amount)
+		if err != nil {
+			return err
+		}
+		if err := checkFunds(from); err != nil {
+			return err
+		}
+
+		err = scanHold(tx.QueryRowContext(ctx, query, args.AccountID, args.ToAccountID, args.Amount, args.ExpiresAt), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "hold.authorize",
+			EntityType: "hold",
+			EntityID:   res.Id,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, errors.Wrap(err, "failed execTx")
+	}
+
+	logger.FromContext(ctx).Info("hold authorized", "hold_id", res.Id, "account_id", res.AccountID, "amount", res.Amount)
+	return &res, nil
+}
+
+// CaptureHold settles a hold with a transfer of the captured amount, fees
+// and limits applying as to any transfer. A hold is captured once, the
+// part left over is released.
+func CaptureHold(ctx context.Context, db connection.DBTX, args CaptureHoldParams) (*CaptureHoldResult, error) {
+	if err := checkNotApprovalHold(ctx, db, args.HoldID); err != nil {
+		return &CaptureHoldResult{}, err
+	}
+	return captureHold(ctx, db, args)
+}
+
+func captureHold(ctx context.Context, db connection.DBTX, args CaptureHoldParams) (*CaptureHoldResult, error) {
+	query := `UPDATE holds SET status = $2, captured_amount = $3, transfer_id = $4, updated_at = now()
+		WHERE id = $1 RETURNING ` + holdColumns
+
+	var result CaptureHoldResult
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := getAuthorizedHoldForUpdate(ctx, tx, args.HoldID)
+		if err != nil {
+			return err
+		}
+
+		amount := args.Amount
+		if amount == 0 {
+			amount = before.Amount
+		}
+		if amount > before.Amount {
+			return errors.Wrapf(ErrCaptureExceedsHold, "capturing %d of a %d hold", amount, before.Amount)
+		}
+
+		result.Transfer, err = transferTx(ctx, tx, TransferTxParams{
+			FromAccountID: before.AccountID,
+			ToAccountID:   before.ToAccountID,
+			Amount:        amount,
+		}, before.Amount)
+		if err != nil {
+			return err
+		}
+
+		var hold models.Hold
+		err = scanHold(tx.QueryRowContext(ctx, query, before.Id, HoldCaptured, amount, result.Transfer.Transfer.Id), &hold)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+		result.Hold = &hold
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "hold.capture",
+			EntityType: "hold",
+			EntityID:   hold.Id,
+			Before:     before,
+			After:      hold,
+		})
+		return err
+	})
+	if err != nil {
+		return &result, errors.Wrap(err, "failed execTx")
+	}
+
+	return &result, nil
+}
+
+// VoidHold cancels a hold and releases the funds.
+func VoidHold(ctx context.Context, db connection.DBTX, id int64) (*models.Hold, error) {
+	if err := checkNotApprovalHold(ctx, db, id); err != nil {
+		return &models.Hold{}, err
+	}
+	return voidHold(ctx, db, id)
+}
+
+func voidHold(ctx context.Context, db connection.DBTX, id int64) (*models.Hold, error) {
+	var res models.Hold
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := getAuthorizedHoldForUpdate(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		hold, err := releaseHold(ctx, tx, before, HoldVoided)
+		if err != nil {
+			return err
+		}
+		res = *hold
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "hold.void",
+			EntityType: "hold",
+			EntityID:   res.Id,
+			Before:     before,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, errors.Wrap(err, "failed execTx")
+	}
+
+	return &res, nil
+}
+
+// ExpireHolds releases the authorized holds past their expiry and returns
+// how many it did. Holds another transaction is working on are skipped, the
+// next run picks them up if they are still authorized.
+func ExpireHolds(ctx context.Context, db connection.DBTX) (int, error) {
+	query := `SELECT ` + holdColumns + ` FROM holds
+		WHERE status = $1 AND expires_at <= now()
+		ORDER BY account_id, id LIMIT $2
+		FOR UPDATE SKIP LOCKED`
+
+	var expired int
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		rows, err := tx.QueryContext(ctx, query, HoldAuthorized, expireBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "failed retrieving the rows")
+		}
+
+		var holds []models.Hold
+		for rows.Next() {
+			var hold models.Hold
+			if err := scanHold(rows, &hold); err != nil {
+				rows.Close()
+				return errors.Wrap(err, "failed scanning the row")
+			}
+			holds = append(holds, hold)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return errors.Wrap(err, "failed retrieving the rows")
+		}
+
+		// ordered by account so the accounts are locked in id order
+		for i := range holds {
+			if _, err := releaseHold(ctx, tx, &holds[i], HoldExpired); err != nil {
+				return err
+			}
+		}
+		expired = len(holds)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if expired > 0 {
+		logger.FromContext(ctx).Info("holds expired", "count", expired)
+	}
+	return expired, nil
+}
+
+func GetHold(ctx context.Context, db connection.DBTX, id int64) (*models.Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM holds WHERE id = $1 LIMIT 1`
+
+	var res models.Hold
+	err := scanHold(db.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// ListHolds returns the holds on an account, the latest first.
+func ListHolds(ctx context.Context, db connection.DBTX, accountID int64) ([]models.Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM holds WHERE account_id = $1 ORDER BY id DESC`
+
+	rows, err := db.QueryContext(ctx, query, accountID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	res := []models.Hold{}
+	for rows.Next() {
+		var hold models.Hold
+		if err := scanHold(rows, &hold); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		res = append(res, hold)
+	}
+
+	return res, rows.Err()
+}
+
+// getAuthorizedHoldForUpdate locks the hold and checks it can still be
+// captured or voided. A hold past its expiry counts as expired even before
+// ExpireHolds got to it.
+func getAuthorizedHoldForUpdate(ctx context.Context, tx connection.DBTX, id int64) (*models.Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM holds WHERE id = $1 LIMIT 1 FOR UPDATE`
+
+	var res models.Hold
+	err := scanHold(tx.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return nil, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	if res.Status != HoldAuthorized {
+		return nil, errors.Wrapf(ErrHoldNotAuthorized, "hold [%d] is %s", res.Id, res.Status)
+	}
+	if !res.ExpiresAt.After(time.Now()) {
+		return nil, errors.Wrapf(ErrHoldNotAuthorized, "hold [%d] expired at %s", res.Id, res.ExpiresAt)
+	}
+	return &res, nil
+}
+
+// checkNotApprovalHold fails with ErrHoldPendingApproval when the hold was
+// placed by RequestTransferApproval. That is decided with the hold, so the
+// check needs no lock.
+func checkNotApprovalHold(ctx context.Context, db connection.DBTX, id int64) error {
+	query := `SELECT EXISTS (SELECT 1 FROM transfer_approvals WHERE hold_id = $1)`
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return errors.Wrap(err, "failed retrieving the row")
+	}
+	if exists {
+		return errors.Wrapf(ErrHoldPendingApproval, "hold [%d]", id)
+	}
+	return nil
+}
+
+// releaseHold gives the held funds back and moves the hold to status.
+func releaseHold(ctx context.Context, tx connection.DBTX, hold *models.Hold, status string) (*models.Hold, error) {
+	query := `UPDATE holds SET status = $2, updated_at = now() WHERE id = $1 RETURNING ` + holdColumns
+
+	if _, err := accountController.AddHeldAmount(ctx, tx, hold.AccountID, -hold.Amount); err != nil {
+		return nil, err
+	}
+
+	var res models.Hold
+	err := scanHold(tx.QueryRowContext(ctx, query, hold.Id, status), &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed update")
+	}
+
+	return &res, nil
+}
+
+func scanHold(row scanner, hold *models.Hold) error {
+	return row.Scan(&hold.Id, &hold.AccountID, &hold.ToAccountID, &hold.Amount, &hold.CapturedAmount, &hold.Status,
+		&hold.TransferID, &hold.ExpiresAt, &hold.CreatedAt, &hold.UpdatedAt)
+}
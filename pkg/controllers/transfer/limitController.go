@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"simplebank/pkg/connection"
+	accountController "simplebank/pkg/controllers/account"
+	limitController "simplebank/pkg/controllers/limit"
+	"simplebank/pkg/models"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Allowance is how much an account can still send. A nil limit means there
+// is none.
+type Allowance struct {
+	AccountID        int64  `json:"account_id"`
+	Currency         string `json:"currency"`
+	Tier             string `json:"tier"`
+	MaxTransfer      *int64 `json:"max_transfer"`
+	DailyLimit       *int64 `json:"daily_limit"`
+	DailyUsed        int64  `json:"daily_used"`
+	DailyRemaining   *int64 `json:"daily_remaining"`
+	MonthlyLimit     *int64 `json:"monthly_limit"`
+	MonthlyUsed      int64  `json:"monthly_used"`
+	MonthlyRemaining *int64 `json:"monthly_remaining"`
+}
+
+// GetAllowance returns the limits of the account and what is left of them.
+// Days and months are counted in UTC.
+func GetAllowance(ctx context.Context, db connection.DBTX, accountID int64) (*Allowance, error) {
+	account, err := accountController.GetAccountByID(ctx, db, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	return allowance(ctx, db, account, time.Now())
+}
+
+// checkLimits fails with ErrLimitExceeded when sending amount takes the
+// account over one of its limits. It runs with the account locked and after
+// the transfer was inserted, so the totals already count it and concurrent
+// transfers from the account wait for the lock and then see it.
+func checkLimits(ctx context.Context, tx connection.DBTX, from *models.Account, amount int64) error {
+	allowed, err := allowance(ctx, tx, from, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if allowed.MaxTransfer != nil && amount > *allowed.MaxTransfer {
+		return errors.Wrapf(ErrLimitExceeded, "transfers are limited to %d %s", *allowed.MaxTransfer, from.Currency)
+	}
+	if allowed.DailyLimit != nil && allowed.DailyUsed > *allowed.DailyLimit {
+		return errors.Wrapf(ErrLimitExceeded, "daily limit of %d %s, %d left today",
+			*allowed.DailyLimit, from.Currency, remaining(*allowed.DailyLimit, allowed.DailyUsed-amount))
+	}
+	if allowed.MonthlyLimit != nil && allowed.MonthlyUsed > *allowed.MonthlyLimit {
+		return errors.Wrapf(ErrLimitExceeded, "monthly limit of %d %s, %d left this month",
+			*allowed.MonthlyLimit, from.Currency, remaining(*allowed.MonthlyLimit, allowed.MonthlyUsed-amount))
+	}
+
+	return nil
+}
+
+func allowance(ctx context.Context, db connection.DBTX, account *models.Account, now time.Time) (*Allowance, error) {
+	res := Allowance{
+		AccountID: account.Id,
+		Currency:  account.Currency,
+		Tier:      account.Tier,
+	}
+
+	limit, err := limitController.GetTransferLimit(ctx, db, account.Currency, account.Tier)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &res, nil
+		}
+		return nil, err
+	}
+	res.MaxTransfer, res.DailyLimit, res.MonthlyLimit = limit.MaxTransfer, limit.DailyLimit, limit.MonthlyLimit
+
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	if res.DailyLimit != nil {
+		res.DailyUsed, err = limitController.OutgoingTotal(ctx, db, account.Id, day)
+		if err != nil {
+			return nil, err
+		}
+		left := remaining(*res.DailyLimit, res.DailyUsed)
+		res.DailyRemaining = &left
+	}
+	if res.MonthlyLimit != nil {
+		res.MonthlyUsed, err = limitController.OutgoingTotal(ctx, db, account.Id, month)
+		if err != nil {
+			return nil, err
+		}
+		left := remaining(*res.MonthlyLimit, res.MonthlyUsed)
+		res.MonthlyRemaining = &left
+	}
+
+	return &res, nil
+}
+
+func remaining(limit int64, used int64) int64 {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
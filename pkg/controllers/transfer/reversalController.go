@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	entryController "simplebank/pkg/controllers/entry"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/metrics"
+	"simplebank/pkg/models"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotReversible is returned when reversing a reversal or a transfer
+	// between currencies, which is undone with a new quote instead.
+	ErrNotReversible = errors.New("transfer can't be reversed")
+	// ErrReversalExceedsTransfer is returned when a reversal would give back
+	// more than what is left of the transfer, which includes reversing a
+	// transfer that is already fully reversed.
+	ErrReversalExceedsTransfer = errors.New("reversal exceeds the transfer")
+)
+
+type (
+	ReverseTransferParams struct {
+		TransferID int64 `json:"transfer_id"`
+		// Amount defaults to what is left to reverse of the transfer.
+		Amount int64  `json:"amount"`
+		Reason string `json:"reason"`
+	}
+
+	ReverseTransferResult struct {
+		// Transfer is the original transfer, its ReversedAmount updated.
+		Transfer *models.Transfer `json:"transfer"`
+		Reversal *models.Transfer `json:"reversal"`
+		// FromAccount and ToAccount are those of the reversal, the receiver
+		// of the original transfer giving the money back to its sender.
+		FromAccount *models.Account `json:"from_account"`
+		ToAccount   *models.Account `json:"to_account"`
+		EntryFrom   *models.Entry   `json:"from_entry"`
+		EntryTo     *models.Entry   `json:"to_entry"`
+	}
+)
+
+// ReverseTransfer gives back amount of a transfer to its sender with a
+// reversal transfer going the other way, linked to the original. A transfer
+// can be reversed in several parts up to its amount, never more. The fee of
+// the original transfer is kept and the limits don't apply, but the
+// receiver needs the funds, within its overdraft.
+func ReverseTransfer(ctx context.Context, db connection.DBTX, args ReverseTransferParams) (*ReverseTransferResult, error) {
+	query := `UPDATE transfers SET reversed_amount = reversed_amount + $2 WHERE id = $1 RETURNING ` + transferColumns
+
+	var result ReverseTransferResult
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		// locking the original first serializes the reversals of a transfer
+		before, err := getTransferForUpdate(ctx, tx, args.TransferID)
+		if err != nil {
+			return err
+		}
+		if before.ReversalOf != nil {
+			return errors.Wrapf(ErrNotReversible, "transfer [%d] is a reversal", before.Id)
+		}
+		if before.ExchangeRate != nil {
+			return errors.Wrapf(ErrNotReversible, "transfer [%d] is between currencies", before.Id)
+		}
+
+		remaining := before.Amount - before.ReversedAmount
+		amount := args.Amount
+		if amount == 0 {
+			amount = remaining
+		}
+		if amount <= 0 || amount > remaining {
+			return errors.Wrapf(ErrReversalExceedsTransfer, "reversing %d of transfer [%d], %d of %d left",
+				amount, before.Id, remaining, before.Amount)
+		}
+
+		var transfer models.Transfer
+		err = scanTransfer(tx.QueryRowContext(ctx, query, before.Id, amount), &transfer)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+		result.Transfer = &transfer
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "transfer.reverse",
+			EntityType: "transfer",
+			EntityID:   transfer.Id,
+			Before:     before,
+			After:      transfer,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.Reversal, err = insertTransfer(ctx, tx, models.Transfer{
+			FromAccountID: before.ToAccountID,
+			ToAccountID:   before.FromAccountID,
+			Amount:        amount,
+			ToAmount:      amount,
+			ReversalOf:    &before.Id,
+			Reason:        &args.Reason,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.EntryFrom, err = entryController.CreateEntry(ctx, tx, entryController.CreateEntryParams{
+			AccountID:             before.ToAccountID,
+			Amount:                -amount,
+			Type:                  entryController.TypeReversal,
+			TransferID:            &result.Reversal.Id,
+			CounterpartyAccountID: &before.FromAccountID,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.EntryTo, err = entryController.CreateEntry(ctx, tx, entryController.CreateEntryParams{
+			AccountID:             before.FromAccountID,
+			Amount:                amount,
+			Type:                  entryController.TypeReversal,
+			TransferID:            &result.Reversal.Id,
+			CounterpartyAccountID: &before.ToAccountID,
+		})
+		if err != nil {
+			return err
+		}
+
+		accounts, err := applyBalanceChanges(ctx, tx, map[int64]int64{
+			before.ToAccountID:   -amount,
+			before.FromAccountID: amount,
+		})
+		if err != nil {
+			return err
+		}
+		result.FromAccount, result.ToAccount = accounts[before.ToAccountID], accounts[before.FromAccountID]
+
+		return checkFunds(result.FromAccount)
+	})
+	if err != nil {
+		return &result, errors.Wrap(err, "failed execTx")
+	}
+
+	metrics.Reversals.WithLabelValues(result.FromAccount.Currency).Inc()
+	logger.FromContext(ctx).Info("transfer reversed", "transfer_id", result.Transfer.Id, "reversal_id", result.Reversal.Id,
+		"amount", result.Reversal.Amount, "reason", args.Reason)
+	return &result, nil
+}
+
+func getTransferForUpdate(ctx context.Context, tx connection.DBTX, id int64) (*models.Transfer, error) {
+	query := `SELECT ` + transferColumns + ` FROM transfers WHERE id = $1 LIMIT 1 FOR UPDATE`
+
+	var res models.Transfer
+	err := scanTransfer(tx.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return nil, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
@@ -0,0 +1,492 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+	"simplebank/pkg/schedule"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const scheduledTransferColumns = `id, owner, from_account_id, to_account_id, amount, frequency, start_at, end_at, max_runs, runs, attempts,
+	next_run_at, status, last_error, created_at, updated_at`
+
+const scheduledTransferRunColumns = `id, scheduled_transfer_id, occurrence, scheduled_for, attempt, status, transfer_id, error, created_at`
+
+// Scheduled transfer statuses, only active ones are run. Completed, failed
+// and cancelled are final.
+const (
+	ScheduleActive    = "active"
+	SchedulePaused    = "paused"
+	ScheduleCompleted = "completed"
+	ScheduleFailed    = "failed"
+	ScheduleCancelled = "cancelled"
+)
+
+// Statuses of a run, one row per attempt at an occurrence.
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// scheduleBatchSize bounds how many scheduled transfers one
+// RunDueScheduledTransfers call runs.
+const scheduleBatchSize = 100
+
+var (
+	// ErrInvalidSchedule is returned when a schedule ends before its first
+	// occurrence.
+	ErrInvalidSchedule = errors.New("schedule has no occurrence")
+	// ErrScheduleNotActive is returned when changing a scheduled transfer
+	// that is completed, failed or cancelled, or resuming one not paused.
+	ErrScheduleNotActive = errors.New("scheduled transfer is not active")
+)
+
+type (
+	CreateScheduledTransferParams struct {
+		Owner         string     `json:"owner"`
+		FromAccountID int64      `json:"from_account_id"`
+		ToAccountID   int64      `json:"to_account_id"`
+		Amount        int64      `json:"amount"`
+		Frequency     string     `json:"frequency"`
+		StartAt       time.Time  `json:"start_at"`
+		EndAt         *time.Time `json:"end_at"`
+		MaxRuns       *int32     `json:"max_runs"`
+	}
+
+	// UpdateScheduledTransferParams replaces the amount and the end of a
+	// schedule, a nil EndAt or MaxRuns removes that bound.
+	UpdateScheduledTransferParams struct {
+		Id      int64      `json:"id"`
+		Amount  int64      `json:"amount"`
+		EndAt   *time.Time `json:"end_at"`
+		MaxRuns *int32     `json:"max_runs"`
+	}
+
+	// RetryPolicy says how a failed occurrence is retried: up to MaxAttempts
+	// times in all, waiting Delay times the number of failed attempts in
+	// between. An occurrence still failing after that is skipped.
+	RetryPolicy struct {
+		MaxAttempts int32
+		Delay       time.Duration
+	}
+)
+
+// CreateScheduledTransfer schedules a transfer for StartAt, repeated at
+// Frequency until EndAt or MaxRuns occurrences when set.
+func CreateScheduledTransfer(ctx context.Context, db connection.DBTX, args CreateScheduledTransferParams) (*models.ScheduledTransfer, error) {
+	query := `INSERT INTO scheduled_transfers ("owner", "from_account_id", "to_account_id", "amount", "frequency", "start_at", "end_at", "max_runs", "next_run_at")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $6) RETURNING ` + scheduledTransferColumns
+
+	var res models.ScheduledTransfer
+	_, ok := schedule.Next(&models.ScheduledTransfer{
+		Frequency: args.Frequency,
+		StartAt:   args.StartAt,
+		EndAt:     args.EndAt,
+		MaxRuns:   args.MaxRuns,
+	}, 0)
+	if !ok {
+		return &res, errors.Wrapf(ErrInvalidSchedule, "ends at %s, before it starts at %s", args.EndAt, args.StartAt)
+	}
+
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		err := scanScheduledTransfer(tx.QueryRowContext(ctx, query, args.Owner, args.FromAccountID, args.ToAccountID, args.Amount,
+			args.Frequency, args.StartAt, args.EndAt, args.MaxRuns), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "scheduled_transfer.create",
+			EntityType: "scheduled_transfer",
+			EntityID:   res.Id,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	logger.FromContext(ctx).Info("transfer scheduled", "scheduled_transfer_id", res.Id, "frequency", res.Frequency, "start_at", res.StartAt)
+	return &res, nil
+}
+
+func GetScheduledTransfer(ctx context.Context, db connection.DBTX, id int64) (*models.ScheduledTransfer, error) {
+	query := `SELECT ` + scheduledTransferColumns + ` FROM scheduled_transfers WHERE id = $1 LIMIT 1`
+
+	var res models.ScheduledTransfer
+	err := scanScheduledTransfer(db.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// ListScheduledTransfers returns the scheduled transfers of owner, the
+// latest first.
+func ListScheduledTransfers(ctx context.Context, db connection.DBTX, owner string) ([]models.ScheduledTransfer, error) {
+	query := `SELECT ` + scheduledTransferColumns + ` FROM scheduled_transfers WHERE owner = $1 ORDER BY id DESC`
+
+	rows, err := db.QueryContext(ctx, query, owner)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	res := []models.ScheduledTransfer{}
+	for rows.Next() {
+		var transfer models.ScheduledTransfer
+		if err := scanScheduledTransfer(rows, &transfer); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		res = append(res, transfer)
+	}
+
+	return res, rows.Err()
+}
+
+// ListScheduledTransferRuns returns the attempts at the occurrences of a
+// scheduled transfer, the latest first.
+func ListScheduledTransferRuns(ctx context.Context, db connection.DBTX, scheduledTransferID int64) ([]models.ScheduledTransferRun, error) {
+	query := `SELECT ` + scheduledTransferRunColumns + ` FROM scheduled_transfer_runs WHERE scheduled_transfer_id = $1 ORDER BY id DESC`
+
+	rows, err := db.QueryContext(ctx, query, scheduledTransferID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the rows")
+	}
+	defer rows.Close()
+
+	res := []models.ScheduledTransferRun{}
+	for rows.Next() {
+		var run models.ScheduledTransferRun
+		if err := scanScheduledTransferRun(rows, &run); err != nil {
+			return nil, errors.Wrap(err, "failed scanning the row")
+		}
+		res = append(res, run)
+	}
+
+	return res, rows.Err()
+}
+
+// UpdateScheduledTransfer changes the amount and the end of an active or
+// paused schedule. A schedule whose new end is already reached completes.
+func UpdateScheduledTransfer(ctx context.Context, db connection.DBTX, args UpdateScheduledTransferParams) (*models.ScheduledTransfer, error) {
+	var res models.ScheduledTransfer
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := getOpenScheduledTransferForUpdate(ctx, tx, args.Id)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.Amount, after.EndAt, after.MaxRuns = args.Amount, args.EndAt, args.MaxRuns
+		if after.Attempts == 0 {
+			next, ok := schedule.Next(&after, after.Runs)
+			if ok {
+				after.NextRunAt = &next
+			} else {
+				after.NextRunAt, after.Status = nil, ScheduleCompleted
+			}
+		}
+
+		return saveScheduledTransfer(ctx, tx, "scheduled_transfer.update", before, &after, &res)
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+// PauseScheduledTransfer stops an active schedule from running until it is
+// resumed.
+func PauseScheduledTransfer(ctx context.Context, db connection.DBTX, id int64) (*models.ScheduledTransfer, error) {
+	var res models.ScheduledTransfer
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := getOpenScheduledTransferForUpdate(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.Status = SchedulePaused
+		return saveScheduledTransfer(ctx, tx, "scheduled_transfer.pause", before, &after, &res)
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+// ResumeScheduledTransfer runs a paused schedule again. The occurrences
+// that fell while it was paused are skipped rather than paid late.
+func ResumeScheduledTransfer(ctx context.Context, db connection.DBTX, id int64) (*models.ScheduledTransfer, error) {
+	var res models.ScheduledTransfer
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := getOpenScheduledTransferForUpdate(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if before.Status != SchedulePaused {
+			return errors.Wrapf(ErrScheduleNotActive, "scheduled transfer [%d] is %s", before.Id, before.Status)
+		}
+
+		after := *before
+		after.Status, after.Attempts = ScheduleActive, 0
+		now := time.Now()
+		for {
+			next, ok := schedule.Next(&after, after.Runs)
+			if !ok {
+				after.NextRunAt, after.Status = nil, ScheduleCompleted
+				break
+			}
+			// a one-off transfer still runs, late
+			if !next.Before(now) || after.Frequency == schedule.Once {
+				after.NextRunAt = &next
+				break
+			}
+			after.Runs++
+		}
+
+		return saveScheduledTransfer(ctx, tx, "scheduled_transfer.resume", before, &after, &res)
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+// CancelScheduledTransfer stops a schedule for good. Its runs are kept.
+func CancelScheduledTransfer(ctx context.Context, db connection.DBTX, id int64) (*models.ScheduledTransfer, error) {
+	var res models.ScheduledTransfer
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := getOpenScheduledTransferForUpdate(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.NextRunAt, after.Status = nil, ScheduleCancelled
+		return saveScheduledTransfer(ctx, tx, "scheduled_transfer.cancel", before, &after, &res)
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	logger.FromContext(ctx).Info("scheduled transfer cancelled", "scheduled_transfer_id", res.Id)
+	return &res, nil
+}
+
+// RunDueScheduledTransfers runs the active scheduled transfers whose time
+// has come and returns how many it ran, successfully or not. Each one runs
+// in its own transaction that locks the schedule, makes the transfer and
+// moves the schedule on, so an occurrence is paid exactly once however many
+// replicas run the scheduler: the ones another replica holds are skipped.
+func RunDueScheduledTransfers(ctx context.Context, db connection.DBTX, policy RetryPolicy) (int, error) {
+	query := `SELECT ` + scheduledTransferColumns + ` FROM scheduled_transfers
+		WHERE status = $1 AND next_run_at <= now()
+		ORDER BY next_run_at LIMIT 1
+		FOR UPDATE SKIP LOCKED`
+
+	var ran int
+	for ran < scheduleBatchSize {
+		var claimed bool
+		err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+			var transfer models.ScheduledTransfer
+			err := scanScheduledTransfer(tx.QueryRowContext(ctx, query, ScheduleActive), &transfer)
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			if err != nil {
+				return errors.Wrap(err, "failed retrieving the row")
+			}
+
+			claimed = true
+			return runScheduledTransfer(ctx, tx, &transfer, policy)
+		})
+		if err != nil {
+			return ran, err
+		}
+		if !claimed {
+			break
+		}
+		ran++
+	}
+
+	if ran > 0 {
+		logger.FromContext(ctx).Info("scheduled transfers ran", "count", ran)
+	}
+	return ran, nil
+}
+
+// runScheduledTransfer attempts the current occurrence of a schedule locked
+// by the caller. A failed transfer is rolled back on its own and recorded,
+// then retried or skipped following policy. Errors that retrying can't fix,
+// such as a closed account, fail the whole schedule.
+func runScheduledTransfer(ctx context.Context, tx connection.DBTX, transfer *models.ScheduledTransfer, policy RetryPolicy) error {
+	log := logger.FromContext(ctx).With("scheduled_transfer_id", transfer.Id, "occurrence", transfer.Runs)
+
+	run := models.ScheduledTransferRun{
+		ScheduledTransferID: transfer.Id,
+		Occurrence:          transfer.Runs,
+		ScheduledFor:        schedule.Occurrence(transfer.Frequency, transfer.StartAt, transfer.Runs),
+		Attempt:             transfer.Attempts + 1,
+		Status:              RunSucceeded,
+	}
+
+	err := connection.ExecSavepoint(ctx, tx, func(tx connection.DBTX) error {
+		result, err := TransferTx(ctx, tx, TransferTxParams{
+			FromAccountID: transfer.FromAccountID,
+			ToAccountID:   transfer.ToAccountID,
+			Amount:        transfer.Amount,
+		})
+		if err != nil {
+			return err
+		}
+
+		run.TransferID = &result.Transfer.Id
+		return insertScheduledTransferRun(ctx, tx, &run)
+	})
+
+	after := *transfer
+	if err == nil {
+		after.Runs, after.Attempts, after.LastError = after.Runs+1, 0, nil
+	} else {
+		log.Warn("scheduled transfer failed", "attempt", run.Attempt, "error", err)
+
+		message := err.Error()
+		run.Status, run.TransferID, run.Error = RunFailed, nil, &message
+		if err := insertScheduledTransferRun(ctx, tx, &run); err != nil {
+			return err
+		}
+
+		after.LastError = &message
+		switch {
+		case isPermanent(err):
+			after.NextRunAt, after.Status = nil, ScheduleFailed
+		case run.Attempt < policy.MaxAttempts:
+			retryAt := time.Now().Add(policy.Delay * time.Duration(run.Attempt))
+			after.Attempts, after.NextRunAt = run.Attempt, &retryAt
+		default:
+			// give up on this occurrence, the next one is tried as usual
+			after.Runs, after.Attempts = after.Runs+1, 0
+		}
+	}
+
+	if after.Status == ScheduleActive && after.Attempts == 0 {
+		next, ok := schedule.Next(&after, after.Runs)
+		switch {
+		case ok:
+			after.NextRunAt = &next
+		case after.Frequency == schedule.Once && err != nil:
+			after.NextRunAt, after.Status = nil, ScheduleFailed
+		default:
+			after.NextRunAt, after.Status = nil, ScheduleCompleted
+		}
+	}
+
+	var res models.ScheduledTransfer
+	if err := updateScheduledTransfer(ctx, tx, &after, &res); err != nil {
+		return err
+	}
+
+	if res.Status != ScheduleActive {
+		log.Info("scheduled transfer ended", "status", res.Status)
+	}
+	return nil
+}
+
+// isPermanent reports whether a failed scheduled transfer would fail again
+// however many times it is retried.
+func isPermanent(err error) bool {
+	return errors.Is(err, ErrAccountNotActive) ||
+		errors.Is(err, ErrNotCustomerAccount) ||
+		errors.Is(err, ErrCurrencyMismatch) ||
+		errors.Is(err, sql.ErrNoRows)
+}
+
+// getOpenScheduledTransferForUpdate locks the scheduled transfer and checks
+// it is active or paused.
+func getOpenScheduledTransferForUpdate(ctx context.Context, tx connection.DBTX, id int64) (*models.ScheduledTransfer, error) {
+	query := `SELECT ` + scheduledTransferColumns + ` FROM scheduled_transfers WHERE id = $1 LIMIT 1 FOR UPDATE`
+
+	var res models.ScheduledTransfer
+	err := scanScheduledTransfer(tx.QueryRowContext(ctx, query, id), &res)
+	if err == sql.ErrNoRows {
+		return nil, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	if res.Status != ScheduleActive && res.Status != SchedulePaused {
+		return nil, errors.Wrapf(ErrScheduleNotActive, "scheduled transfer [%d] is %s", res.Id, res.Status)
+	}
+	return &res, nil
+}
+
+// saveScheduledTransfer writes after over before and audits the change.
+func saveScheduledTransfer(ctx context.Context, tx connection.DBTX, action string, before, after, res *models.ScheduledTransfer) error {
+	if err := updateScheduledTransfer(ctx, tx, after, res); err != nil {
+		return err
+	}
+
+	_, err := auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+		Action:     action,
+		EntityType: "scheduled_transfer",
+		EntityID:   res.Id,
+		Before:     before,
+		After:      res,
+	})
+	return err
+}
+
+func updateScheduledTransfer(ctx context.Context, tx connection.DBTX, transfer, res *models.ScheduledTransfer) error {
+	query := `UPDATE scheduled_transfers SET amount = $2, end_at = $3, max_runs = $4, runs = $5, attempts = $6, next_run_at = $7,
+		status = $8, last_error = $9, updated_at = now()
+		WHERE id = $1 RETURNING ` + scheduledTransferColumns
+
+	err := scanScheduledTransfer(tx.QueryRowContext(ctx, query, transfer.Id, transfer.Amount, transfer.EndAt, transfer.MaxRuns,
+		transfer.Runs, transfer.Attempts, transfer.NextRunAt, transfer.Status, transfer.LastError), res)
+	if err != nil {
+		return errors.Wrap(err, "failed update")
+	}
+
+	return nil
+}
+
+func insertScheduledTransferRun(ctx context.Context, tx connection.DBTX, run *models.ScheduledTransferRun) error {
+	query := `INSERT INTO scheduled_transfer_runs ("scheduled_transfer_id", "occurrence", "scheduled_for", "attempt", "status", "transfer_id", "error")
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING ` + scheduledTransferRunColumns
+
+	err := scanScheduledTransferRun(tx.QueryRowContext(ctx, query, run.ScheduledTransferID, run.Occurrence, run.ScheduledFor,
+		run.Attempt, run.Status, run.TransferID, run.Error), run)
+	if err != nil {
+		return errors.Wrap(err, "failed insert")
+	}
+
+	return nil
+}
+
+func scanScheduledTransfer(row scanner, transfer *models.ScheduledTransfer) error {
+	return row.Scan(&transfer.Id, &transfer.Owner, &transfer.FromAccountID, &transfer.ToAccountID, &transfer.Amount, &transfer.Frequency,
+		&transfer.StartAt, &transfer.EndAt, &transfer.MaxRuns, &transfer.Runs, &transfer.Attempts, &transfer.NextRunAt, &transfer.Status,
+		&transfer.LastError, &transfer.CreatedAt, &transfer.UpdatedAt)
+}
+
+func scanScheduledTransferRun(row scanner, run *models.ScheduledTransferRun) error {
+	return row.Scan(&run.Id, &run.ScheduledTransferID, &run.Occurrence, &run.ScheduledFor, &run.Attempt, &run.Status,
+		&run.TransferID, &run.Error, &run.CreatedAt)
+}
@@ -3,14 +3,36 @@ package controller
 import (
 	"context"
 	"database/sql"
+	"simplebank/pkg/connection"
 	accountController "simplebank/pkg/controllers/account"
+	auditController "simplebank/pkg/controllers/audit"
 	entryController "simplebank/pkg/controllers/entry"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/metrics"
 	"simplebank/pkg/models"
-	"sync"
+	"sort"
 
 	"github.com/pkg/errors"
+)
+
+const transferColumns = `id, from_account_id, to_account_id, amount, to_amount, fee, exchange_rate, spread_bps, quote_id, reversal_of, reversed_amount, reason, created_at`
 
-	"github.com/jmoiron/sqlx"
+var (
+	// ErrAccountNotActive is returned when money is moved from or to an
+	// account that is frozen or closed.
+	ErrAccountNotActive = errors.New("account is not active")
+	// ErrNotCustomerAccount is returned when a transfer, deposit or
+	// withdrawal names a settlement account.
+	ErrNotCustomerAccount = errors.New("not a customer account")
+	// ErrInsufficientFunds is returned when a transfer or withdrawal would
+	// take the balance below the overdraft limit of the account.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrCurrencyMismatch is returned when the accounts of a transfer don't
+	// hold the currencies it moves. Transfers between currencies need a quote.
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrLimitExceeded is returned when a transfer is above the limits set
+	// for the currency and tier of the sending account.
+	ErrLimitExceeded = errors.New("transfer limit exceeded")
 )
 
 type (
@@ -21,87 +43,139 @@ type (
 	}
 
 	TransferTxResult struct {
-		Transfer    *models.Transfer
-		FromAccount *models.Account
-		ToAccount   *models.Account
-		EntryFrom   *models.Entry
-		EntryTo     *models.Entry
+		Transfer    *models.Transfer `json:"transfer"`
+		FromAccount *models.Account  `json:"from_account"`
+		ToAccount   *models.Account  `json:"to_account"`
+		EntryFrom   *models.Entry    `json:"from_entry"`
+		EntryTo     *models.Entry    `json:"to_entry"`
+		// Fee is charged to FromAccount on top of the amount, FeeEntry is
+		// only set when it isn't zero.
+		Fee      int64         `json:"fee"`
+		FeeEntry *models.Entry `json:"fee_entry,omitempty"`
 	}
 )
 
-var mutex sync.Mutex
-
-func execTx(ctx context.Context, db *sqlx.DB, fn func() error) error {
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return errors.Wrap(err, "failed begin transaction")
-	}
-
-	err = fn()
-	if err != nil {
-		if rtx := tx.Rollback(); rtx != nil {
-			return errors.Wrapf(err, "failed tx err: %v, rtx err: %v", err, rtx)
-		}
-		return errors.Wrap(err, "failed transaction")
-	}
-
-	return tx.Commit()
+// TransferTx moves amount between two accounts of the same currency. The
+// fee set by the fee rules is charged to the sender on top of amount and
+// posted to the revenue account of the currency.
+func TransferTx(ctx context.Context, db connection.DBTX, args TransferTxParams) (*TransferTxResult, error) {
+	return transferTx(ctx, db, args, 0)
 }
 
-func TransferTx(ctx context.Context, db *sqlx.DB, args TransferTxParams) (*TransferTxResult, error) {
+// transferTx releases held of the funds reserved on the sending account
+// once it is locked, for captures of a hold.
+func transferTx(ctx context.Context, db connection.DBTX, args TransferTxParams, held int64) (*TransferTxResult, error) {
 	var result TransferTxResult
 
-	err := execTx(ctx, db, func() error {
-		var err error
-
-		result.Transfer, err = CreateTransfer(ctx, db, args)
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		from, err := accountController.GetAccountByID(ctx, tx, args.FromAccountID)
 		if err != nil {
 			return err
 		}
 
-		result.EntryFrom, err = entryController.CreateEntry(ctx, db, entryController.CreateEntryParams{
-			AccountID: args.FromAccountID,
-			Amount:    -args.Amount,
-		})
+		var rule *models.FeeRule
+		result.Fee, rule, err = computeFee(ctx, tx, from, args.Amount)
 		if err != nil {
 			return err
 		}
 
-		result.EntryTo, err = entryController.CreateEntry(ctx, db, entryController.CreateEntryParams{
-			AccountID: args.ToAccountID,
-			Amount:    args.Amount,
+		result.Transfer, err = insertTransfer(ctx, tx, models.Transfer{
+			FromAccountID: args.FromAccountID,
+			ToAccountID:   args.ToAccountID,
+			Amount:        args.Amount,
+			ToAmount:      args.Amount,
+			Fee:           result.Fee,
 		})
 		if err != nil {
 			return err
 		}
 
-		// Get account & Update account's balance
-		mutex.Lock()
-		account1, err := accountController.GetAccountByIDForUpdate(context.Background(), db, args.FromAccountID)
+		result.EntryFrom, err = entryController.CreateEntry(ctx, tx, entryController.CreateEntryParams{
+			AccountID:             args.FromAccountID,
+			Amount:                -args.Amount,
+			TransferID:            &result.Transfer.Id,
+			CounterpartyAccountID: &args.ToAccountID,
+		})
 		if err != nil {
 			return err
 		}
-		result.FromAccount, err = accountController.UpdateAccount(context.Background(), db, accountController.UpdateAccountParams{
-			Id:      args.FromAccountID,
-			Balance: account1.Balance - args.Amount,
+
+		result.EntryTo, err = entryController.CreateEntry(ctx, tx, entryController.CreateEntryParams{
+			AccountID:             args.ToAccountID,
+			Amount:                args.Amount,
+			TransferID:            &result.Transfer.Id,
+			CounterpartyAccountID: &args.FromAccountID,
 		})
 		if err != nil {
 			return err
 		}
 
-		account2, err := accountController.GetAccountByIDForUpdate(context.Background(), db, args.ToAccountID)
+		changes := map[int64]int64{
+			args.FromAccountID: -args.Amount,
+		}
+		changes[args.ToAccountID] += args.Amount
+
+		if result.Fee > 0 {
+			revenue, err := accountController.GetRevenueAccount(ctx, tx, from.Currency)
+			if err != nil {
+				return err
+			}
+
+			result.FeeEntry, err = entryController.CreateEntry(ctx, tx, entryController.CreateEntryParams{
+				AccountID:             args.FromAccountID,
+				Amount:                -result.Fee,
+				Type:                  entryController.TypeFee,
+				TransferID:            &result.Transfer.Id,
+				CounterpartyAccountID: &revenue.Id,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = entryController.CreateEntry(ctx, tx, entryController.CreateEntryParams{
+				AccountID:             revenue.Id,
+				Amount:                result.Fee,
+				Type:                  entryController.TypeFee,
+				TransferID:            &result.Transfer.Id,
+				CounterpartyAccountID: &args.FromAccountID,
+			})
+			if err != nil {
+				return err
+			}
+
+			changes[args.FromAccountID] -= result.Fee
+			changes[revenue.Id] += result.Fee
+			logger.FromContext(ctx).Info("transfer fee charged", "transfer_id", result.Transfer.Id, "fee", result.Fee, "fee_rule_id", rule.Id)
+		}
+
+		accounts, err := applyBalanceChanges(ctx, tx, changes)
 		if err != nil {
 			return err
 		}
-		result.ToAccount, err = accountController.UpdateAccount(context.Background(), db, accountController.UpdateAccountParams{
-			Id:      args.ToAccountID,
-			Balance: account2.Balance + args.Amount,
-		})
-		if err != nil {
+		result.FromAccount, result.ToAccount = accounts[args.FromAccountID], accounts[args.ToAccountID]
+
+		if held > 0 {
+			result.FromAccount, err = accountController.AddHeldAmount(ctx, tx, args.FromAccountID, -held)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, account := range []*models.Account{result.FromAccount, result.ToAccount} {
+			if account.Kind != accountController.KindCustomer {
+				return errors.Wrapf(ErrNotCustomerAccount, "account [%d] is a %s account", account.Id, account.Kind)
+			}
+		}
+		if result.FromAccount.Currency != result.ToAccount.Currency {
+			return errors.Wrapf(ErrCurrencyMismatch, "%s to %s", result.FromAccount.Currency, result.ToAccount.Currency)
+		}
+		if err := checkFunds(result.FromAccount); err != nil {
+			return err
+		}
+		if err := checkLimits(ctx, tx, result.FromAccount, args.Amount); err != nil {
 			return err
 		}
-		mutex.Unlock()
 
+		recordTransfer(tx, result.FromAccount.Currency, args.Amount)
 		return nil
 	})
 	if err != nil {
@@ -111,32 +185,76 @@ func TransferTx(ctx context.Context, db *sqlx.DB, args TransferTxParams) (*Trans
 	return &result, nil
 }
 
-func CreateTransfer(ctx context.Context, db *sqlx.DB, args TransferTxParams) (*models.Transfer, error) {
-	query := `INSERT INTO transfers ("from_account_id", "to_account_id", "amount") VALUES ($1, $2, $3) RETURNING *`
+// recordTransfer counts a transfer once the transaction it is part of
+// commits, a transfer that joined a batch rolled back doesn't count.
+func recordTransfer(tx connection.DBTX, currency string, amount int64) {
+	connection.AfterCommit(tx, func() {
+		metrics.Transfers.WithLabelValues(currency).Inc()
+		metrics.TransferAmount.WithLabelValues(currency).Add(float64(amount))
+	})
+}
 
-	var transfer models.Transfer
-	row, err := db.QueryContext(ctx, query, args.FromAccountID, args.ToAccountID, args.Amount)
-	if err == sql.ErrNoRows {
-		return &transfer, nil
-	}
-	if err != nil {
-		return &transfer, errors.Wrap(err, "failed insert")
+// applyBalanceChanges adds each amount to the balance of its account. The
+// accounts are locked in id order so that concurrent transfers touching the
+// same accounts can't deadlock.
+func applyBalanceChanges(ctx context.Context, tx connection.DBTX, changes map[int64]int64) (map[int64]*models.Account, error) {
+	ids := make([]int64, 0, len(changes))
+	for id := range changes {
+		ids = append(ids, id)
 	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
 
-	defer row.Close()
-	for row.Next() {
-		err := row.Scan(&transfer.Id, &transfer.FromAccountID, &transfer.ToAccountID, &transfer.Amount, &transfer.CreatedAt)
+	accounts := make(map[int64]*models.Account, len(ids))
+	for _, id := range ids {
+		account, err := getActiveAccountForUpdate(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		accounts[id], err = accountController.UpdateAccount(ctx, tx, accountController.UpdateAccountParams{
+			Id:      id,
+			Balance: account.Balance + changes[id],
+		})
 		if err != nil {
-			return &transfer, errors.Wrap(err, "failed scan")
+			return nil, err
 		}
 	}
 
-	// log.Println("Transfer created")
-	return &transfer, nil
+	return accounts, nil
+}
+
+// checkFunds fails with ErrInsufficientFunds when a debit or a hold took the
+// available balance of account below -OverdraftLimit. The caller rolls back.
+func checkFunds(account *models.Account) error {
+	if account.AvailableBalance < -account.OverdraftLimit {
+		return errors.Wrapf(ErrInsufficientFunds, "account [%d] would have %d available with an overdraft limit of %d",
+			account.Id, account.AvailableBalance, account.OverdraftLimit)
+	}
+	return nil
+}
+
+// getActiveAccountForUpdate locks the account and checks it can move money.
+func getActiveAccountForUpdate(ctx context.Context, tx connection.DBTX, id int64) (*models.Account, error) {
+	account, err := accountController.GetAccountByIDForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if account.Status != accountController.StatusActive {
+		return nil, errors.Wrapf(ErrAccountNotActive, "account [%d] is %s", account.Id, account.Status)
+	}
+	return account, nil
+}
+
+func CreateTransfer(ctx context.Context, db connection.DBTX, args TransferTxParams) (*models.Transfer, error) {
+	return insertTransfer(ctx, db, models.Transfer{
+		FromAccountID: args.FromAccountID,
+		ToAccountID:   args.ToAccountID,
+		Amount:        args.Amount,
+		ToAmount:      args.Amount,
+	})
 }
 
-func GetTransferByID(ctx context.Context, db *sqlx.DB, id int64) (*models.Transfer, error) {
-	query := `SELECT * FROM transfers WHERE id = $1 LIMIT 1`
+func GetTransferByID(ctx context.Context, db connection.DBTX, id int64) (*models.Transfer, error) {
+	query := `SELECT ` + transferColumns + ` FROM transfers WHERE id = $1 LIMIT 1`
 
 	var res models.Transfer
 	row, err := db.QueryContext(ctx, query, id)
@@ -149,7 +267,7 @@ func GetTransferByID(ctx context.Context, db *sqlx.DB, id int64) (*models.Transf
 
 	defer row.Close()
 	for row.Next() {
-		err := row.Scan(&res.Id, &res.FromAccountID, &res.ToAccountID, &res.Amount, &res.CreatedAt)
+		err := scanTransfer(row, &res)
 		if err != nil {
 			return &res, errors.Wrap(err, "failed scan")
 		}
@@ -157,3 +275,41 @@ func GetTransferByID(ctx context.Context, db *sqlx.DB, id int64) (*models.Transf
 
 	return &res, nil
 }
+
+func insertTransfer(ctx context.Context, db connection.DBTX, args models.Transfer) (*models.Transfer, error) {
+	query := `INSERT INTO transfers ("from_account_id", "to_account_id", "amount", "to_amount", "fee", "exchange_rate", "spread_bps", "quote_id",
+		"reversal_of", "reason")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING ` + transferColumns
+
+	var transfer models.Transfer
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		err := scanTransfer(tx.QueryRowContext(ctx, query, args.FromAccountID, args.ToAccountID, args.Amount, args.ToAmount, args.Fee,
+			args.ExchangeRate, args.SpreadBps, args.QuoteID, args.ReversalOf, args.Reason), &transfer)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "transfer.create",
+			EntityType: "transfer",
+			EntityID:   transfer.Id,
+			After:      transfer,
+		})
+		return err
+	})
+	if err != nil {
+		return &transfer, err
+	}
+
+	return &transfer, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTransfer(row scanner, transfer *models.Transfer) error {
+	return row.Scan(&transfer.Id, &transfer.FromAccountID, &transfer.ToAccountID, &transfer.Amount, &transfer.ToAmount, &transfer.Fee,
+		&transfer.ExchangeRate, &transfer.SpreadBps, &transfer.QuoteID, &transfer.ReversalOf, &transfer.ReversedAmount, &transfer.Reason,
+		&transfer.CreatedAt)
+}
@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+)
+
+const userColumns = `username, hashed_password, full_name, email, email_verified, role, password_changed_at,
+	failed_login_attempts, first_failed_login_at, lockout_count, locked_until,
+	totp_secret, totp_enabled, totp_last_used_step, created_at`
+
+type (
+	CreateUserParams struct {
+		Username       string `json:"username"`
+		HashedPassword string `json:"hashed_password"`
+		FullName       string `json:"full_name"`
+		Email          string `json:"email"`
+	}
+
+	// LockoutPolicy locks a user once MaxAttempts logins failed within
+	// Window. The first lockout lasts Lockout and every consecutive one
+	// doubles it, up to MaxLockout.
+	LockoutPolicy struct {
+		MaxAttempts int32
+		Window      time.Duration
+		Lockout     time.Duration
+		MaxLockout  time.Duration
+	}
+
+	// lockState is what the lock and unlock audit events record. The
+	// lockout fields of models.User aren't serialized.
+	lockState struct {
+		Username            string     `json:"username"`
+		FailedLoginAttempts int32      `json:"failed_login_attempts"`
+		FirstFailedLoginAt  *time.Time `json:"first_failed_login_at"`
+		LockoutCount        int32      `json:"lockout_count"`
+		LockedUntil         *time.Time `json:"locked_until"`
+	}
+)
+
+func CreateUser(ctx context.Context, db connection.DBTX, args CreateUserParams) (*models.User, error) {
+	query := `INSERT INTO users ("username", "hashed_password", "full_name", "email")
+		VALUES ($1, $2, $3, $4) RETURNING ` + userColumns
+
+	var res models.User
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		err := scanUser(tx.QueryRowContext(ctx, query, args.Username, args.HashedPassword, args.FullName, args.Email), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "user.create",
+			EntityType: "user",
+			EntityID:   res.Username,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+func GetUser(ctx context.Context, db connection.DBTX, username string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1 LIMIT 1`
+
+	var res models.User
+	err := scanUser(db.QueryRowContext(ctx, query, username), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+func GetUserForUpdate(ctx context.Context, db connection.DBTX, username string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1 LIMIT 1 FOR UPDATE`
+
+	var res models.User
+	err := scanUser(db.QueryRowContext(ctx, query, username), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// IsLocked reports whether the user is locked out at the given time.
+func IsLocked(user *models.User, now time.Time) bool {
+	return user.LockedUntil.Valid && user.LockedUntil.Time.After(now)
+}
+
+func newLockState(user *models.User) lockState {
+	state := lockState{
+		Username:            user.Username,
+		FailedLoginAttempts: user.FailedLoginAttempts,
+		LockoutCount:        user.LockoutCount,
+	}
+	if user.FirstFailedLoginAt.Valid {
+		state.FirstFailedLoginAt = &user.FirstFailedLoginAt.Time
+	}
+	if user.LockedUntil.Valid {
+		state.LockedUntil = &user.LockedUntil.Time
+	}
+	return state
+}
+
+// RecordFailedLogin counts a failed login for username and locks the user
+// when the policy says so.
+func RecordFailedLogin(ctx context.Context, db connection.DBTX, username string, policy LockoutPolicy) (*models.User, error) {
+	query := `UPDATE users SET failed_login_attempts = $2, first_failed_login_at = $3, lockout_count = $4, locked_until = $5
+		WHERE username = $1 RETURNING ` + userColumns
+
+	var res models.User
+	var locked bool
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		user, err := GetUserForUpdate(ctx, tx, username)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		attempts := user.FailedLoginAttempts + 1
+		firstFailedAt := user.FirstFailedLoginAt
+		if !firstFailedAt.Valid || now.Sub(firstFailedAt.Time) > policy.Window {
+			attempts = 1
+			firstFailedAt = sql.NullTime{Time: now, Valid: true}
+		}
+
+		lockoutCount := user.LockoutCount
+		lockedUntil := user.LockedUntil
+		locked = attempts >= policy.MaxAttempts
+		if locked {
+			lockoutCount++
+			lockedUntil = sql.NullTime{Time: now.Add(policy.lockoutFor(lockoutCount)), Valid: true}
+			attempts = 0
+			firstFailedAt = sql.NullTime{}
+		}
+
+		err = scanUser(tx.QueryRowContext(ctx, query, username, attempts, firstFailedAt, lockoutCount, lockedUntil), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+		if !locked {
+			return nil
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "user.lock",
+			EntityType: "user",
+			EntityID:   username,
+			Before:     newLockState(user),
+			After:      newLockState(&res),
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	if locked {
+		logger.FromContext(ctx).Warn("user locked out",
+			"username", username,
+			"lockout_count", res.LockoutCount,
+			"locked_until", res.LockedUntil.Time,
+		)
+	}
+	return &res, nil
+}
+
+// ResetFailedLogins clears the failed login counters after a successful login.
+func ResetFailedLogins(ctx context.Context, db connection.DBTX, username string) error {
+	query := `UPDATE users SET failed_login_attempts = 0, first_failed_login_at = NULL, lockout_count = 0, locked_until = NULL
+		WHERE username = $1 AND (failed_login_attempts > 0 OR lockout_count > 0)`
+
+	_, err := db.ExecContext(ctx, query, username)
+	if err != nil {
+		return errors.Wrap(err, "failed update")
+	}
+
+	return nil
+}
+
+// UnlockUser lifts a lockout and resets the escalation.
+func UnlockUser(ctx context.Context, db connection.DBTX, username string) (*models.User, error) {
+	query := `UPDATE users SET failed_login_attempts = 0, first_failed_login_at = NULL, lockout_count = 0, locked_until = NULL
+		WHERE username = $1 RETURNING ` + userColumns
+
+	var res models.User
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := GetUserForUpdate(ctx, tx, username)
+		if err != nil {
+			return err
+		}
+
+		err = scanUser(tx.QueryRowContext(ctx, query, username), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "user.unlock",
+			EntityType: "user",
+			EntityID:   username,
+			Before:     newLockState(before),
+			After:      newLockState(&res),
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	logger.FromContext(ctx).Info("user unlocked", "username", username)
+	return &res, nil
+}
+
+// UpdateUserRole changes the role of a user.
+func UpdateUserRole(ctx context.Context, db connection.DBTX, username string, role string) (*models.User, error) {
+	query := `UPDATE users SET role = $2 WHERE username = $1 RETURNING ` + userColumns
+
+	var res models.User
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		before, err := GetUserForUpdate(ctx, tx, username)
+		if err != nil {
+			return err
+		}
+
+		err = scanUser(tx.QueryRowContext(ctx, query, username, role), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "user.role",
+			EntityType: "user",
+			EntityID:   username,
+			Before:     before,
+			After:      res,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	logger.FromContext(ctx).Info("user role changed", "username", username, "role", role)
+	return &res, nil
+}
+
+func (policy LockoutPolicy) lockoutFor(lockoutCount int32) time.Duration {
+	lockout := float64(policy.Lockout) * math.Pow(2, float64(lockoutCount-1))
+	if lockout > float64(policy.MaxLockout) {
+		return policy.MaxLockout
+	}
+	return time.Duration(lockout)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner, user *models.User) error {
+	return row.Scan(&user.Username, &user.HashedPassword, &user.FullName, &user.Email, &user.EmailVerified, &user.Role, &user.PasswordChangedAt,
+		&user.FailedLoginAttempts, &user.FirstFailedLoginAt, &user.LockoutCount, &user.LockedUntil,
+		&user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastUsedStep, &user.CreatedAt)
+}
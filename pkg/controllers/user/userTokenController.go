@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"simplebank/pkg/connection"
+	auditController "simplebank/pkg/controllers/audit"
+	oauthController "simplebank/pkg/controllers/oauth"
+	"simplebank/pkg/logger"
+	"simplebank/pkg/models"
+)
+
+// Purposes of the single-use tokens mailed to users.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+const userTokenColumns = `token_hash, username, purpose, expires_at, used_at, created_at`
+
+type CreateUserTokenParams struct {
+	TokenHash string    `json:"token_hash"`
+	Username  string    `json:"username"`
+	Purpose   string    `json:"purpose"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func GetUserByEmail(ctx context.Context, db connection.DBTX, email string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1 LIMIT 1`
+
+	var res models.User
+	err := scanUser(db.QueryRowContext(ctx, query, email), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed retrieving the row")
+	}
+
+	return &res, nil
+}
+
+// CreateUserToken stores a new token and invalidates the unused tokens the
+// user had for the same purpose, so only the latest mail works.
+func CreateUserToken(ctx context.Context, db connection.DBTX, args CreateUserTokenParams) (*models.UserToken, error) {
+	query := `INSERT INTO user_tokens ("token_hash", "username", "purpose", "expires_at")
+		VALUES ($1, $2, $3, $4) RETURNING ` + userTokenColumns
+
+	var res models.UserToken
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		if err := expireUserTokens(ctx, tx, args.Username, args.Purpose); err != nil {
+			return err
+		}
+
+		err := scanUserToken(tx.QueryRowContext(ctx, query, args.TokenHash, args.Username, args.Purpose, args.ExpiresAt), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed insert")
+		}
+		return nil
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+// ResetPassword redeems a password reset token and sets the new password.
+// Moving password_changed_at invalidates every access token issued before,
+// and the refresh tokens held by OAuth clients are revoked.
+func ResetPassword(ctx context.Context, db connection.DBTX, tokenHash string, hashedPassword string) (*models.User, error) {
+	query := `UPDATE users SET hashed_password = $2, password_changed_at = $3,
+		failed_login_attempts = 0, first_failed_login_at = NULL, lockout_count = 0, locked_until = NULL
+		WHERE username = $1 RETURNING ` + userColumns
+
+	var res models.User
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		token, err := consumeUserToken(ctx, tx, tokenHash, TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		if err := expireUserTokens(ctx, tx, token.Username, TokenPasswordReset); err != nil {
+			return err
+		}
+
+		// truncated to what the database keeps, tokens issued from now on
+		// compare as not older than the change
+		changedAt := time.Now().Truncate(time.Microsecond)
+		err = scanUser(tx.QueryRowContext(ctx, query, token.Username, hashedPassword, changedAt), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		if err := oauthController.RevokeUserRefreshTokens(ctx, tx, token.Username); err != nil {
+			return err
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "user.password_reset",
+			EntityType: "user",
+			EntityID:   token.Username,
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	logger.FromContext(ctx).Info("password reset", "username", res.Username)
+	return &res, nil
+}
+
+// VerifyEmail redeems an email verification token.
+func VerifyEmail(ctx context.Context, db connection.DBTX, tokenHash string) (*models.User, error) {
+	query := `UPDATE users SET email_verified = true WHERE username = $1 RETURNING ` + userColumns
+
+	var res models.User
+	err := connection.ExecTx(ctx, db, func(tx connection.DBTX) error {
+		token, err := consumeUserToken(ctx, tx, tokenHash, TokenEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		err = scanUser(tx.QueryRowContext(ctx, query, token.Username), &res)
+		if err != nil {
+			return errors.Wrap(err, "failed update")
+		}
+
+		_, err = auditController.CreateAuditEvent(ctx, tx, auditController.CreateAuditEventParams{
+			Action:     "user.email_verify",
+			EntityType: "user",
+			EntityID:   token.Username,
+			After:      map[string]string{"email": res.Email},
+		})
+		return err
+	})
+	if err != nil {
+		return &res, err
+	}
+
+	return &res, nil
+}
+
+// consumeUserToken marks an unused, unexpired token as used. Any other token
+// fails with sql.ErrNoRows.
+func consumeUserToken(ctx context.Context, tx connection.DBTX, tokenHash string, purpose string) (*models.UserToken, error) {
+	query := `UPDATE user_tokens SET used_at = now()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+		RETURNING ` + userTokenColumns
+
+	var res models.UserToken
+	err := scanUserToken(tx.QueryRowContext(ctx, query, tokenHash, purpose), &res)
+	if err == sql.ErrNoRows {
+		return &res, errors.Wrap(err, "row not found")
+	}
+	if err != nil {
+		return &res, errors.Wrap(err, "failed update")
+	}
+
+	return &res, nil
+}
+
+func expireUserTokens(ctx context.Context, tx connection.DBTX, username string, purpose string) error {
+	query := `UPDATE user_tokens SET expires_at = now()
+		WHERE username = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()`
+
+	_, err := tx.ExecContext(ctx, query, username, purpose)
+	if err != nil {
+		return errors.Wrap(err, "failed update")
+	}
+
+	return nil
+}
+
+func scanUserToken(row scanner, token *models.UserToken) error {
+	return row.Scan(&token.TokenHash, &token.Username, &token.Purpose, &token.ExpiresAt, &token.UsedAt, &token.CreatedAt)
+}
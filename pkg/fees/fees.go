@@ -0,0 +1,70 @@
+// Package fees picks the fee rule that applies to a transfer and computes
+// the fee. Rules come from the fee_rules table, the most specific match
+// wins: a rule naming the currency beats one that doesn't, then one naming
+// the tier, then the highest min_amount the transfer reaches.
+package fees
+
+import (
+	"simplebank/pkg/models"
+)
+
+const bpsDenominator = 10000
+
+// Match returns the rule that applies to a transfer of amount in currency
+// from an account of tier, or nil when none does.
+func Match(rules []models.FeeRule, currency string, tier string, amount int64) *models.FeeRule {
+	var best *models.FeeRule
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Currency != nil && *rule.Currency != currency {
+			continue
+		}
+		if rule.Tier != nil && *rule.Tier != tier {
+			continue
+		}
+		if amount < rule.MinAmount {
+			continue
+		}
+		if best == nil || moreSpecific(rule, best) {
+			best = rule
+		}
+	}
+	return best
+}
+
+// Compute returns the fee rule charges on amount. A nil rule charges nothing.
+func Compute(rule *models.FeeRule, amount int64) int64 {
+	if rule == nil || rule.Waived {
+		return 0
+	}
+
+	// split to keep amount * bps from overflowing, the result is rounded down
+	fee := rule.FlatFee + amount/bpsDenominator*rule.PercentBps + amount%bpsDenominator*rule.PercentBps/bpsDenominator
+	if fee < rule.MinFee {
+		fee = rule.MinFee
+	}
+	if rule.MaxFee != nil && fee > *rule.MaxFee {
+		fee = *rule.MaxFee
+	}
+	return fee
+}
+
+// Fee matches the rules and computes the fee in one go.
+func Fee(rules []models.FeeRule, currency string, tier string, amount int64) (int64, *models.FeeRule) {
+	rule := Match(rules, currency, tier, amount)
+	return Compute(rule, amount), rule
+}
+
+func moreSpecific(a, b *models.FeeRule) bool {
+	if (a.Currency != nil) != (b.Currency != nil) {
+		return a.Currency != nil
+	}
+	if (a.Tier != nil) != (b.Tier != nil) {
+		return a.Tier != nil
+	}
+	if a.MinAmount != b.MinAmount {
+		return a.MinAmount > b.MinAmount
+	}
+	// the latest rule replaces an identical older one
+	return a.Id > b.Id
+}
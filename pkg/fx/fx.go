@@ -0,0 +1,46 @@
+// Package fx converts amounts between currencies. Rates are kept as decimal
+// strings and the arithmetic is exact, only the final amount is rounded.
+package fx
+
+import (
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// MaxSpreadBps is the largest spread accepted, in basis points.
+const MaxSpreadBps = 10000
+
+var errInvalidRate = errors.New("rate must be a positive decimal number")
+
+// ParseRate parses a decimal rate such as "0.92".
+func ParseRate(rate string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(rate)
+	if !ok || r.Sign() <= 0 {
+		return nil, errors.Wrapf(errInvalidRate, "invalid rate %q", rate)
+	}
+	return r, nil
+}
+
+// Convert returns amount exchanged at rate less a spread of spreadBps basis
+// points. The result is rounded down, in minor units of the target currency.
+func Convert(amount int64, rate string, spreadBps int64) (int64, error) {
+	r, err := ParseRate(rate)
+	if err != nil {
+		return 0, err
+	}
+	if spreadBps < 0 || spreadBps >= MaxSpreadBps {
+		return 0, errors.Errorf("invalid spread %d bps", spreadBps)
+	}
+
+	res := new(big.Rat).SetInt64(amount)
+	res.Mul(res, r)
+	res.Mul(res, big.NewRat(MaxSpreadBps-spreadBps, MaxSpreadBps))
+
+	// Quo truncates towards zero, amounts are positive
+	converted := new(big.Int).Quo(res.Num(), res.Denom())
+	if !converted.IsInt64() {
+		return 0, errors.New("converted amount overflows")
+	}
+	return converted.Int64(), nil
+}
@@ -0,0 +1,35 @@
+// Package jobs runs the periodic background work of the server, such as
+// releasing expired holds.
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"simplebank/pkg/logger"
+)
+
+// Func is one run of a job.
+type Func func(ctx context.Context) error
+
+// Run calls fn every interval until ctx is done. A failed run is logged and
+// retried at the next tick. Every replica runs its jobs, so fn has to be
+// safe to run concurrently with itself.
+func Run(ctx context.Context, name string, interval time.Duration, fn Func) {
+	log := logger.FromContext(ctx).With("job", name)
+	ctx = logger.WithContext(ctx, log)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil {
+				log.Error("job failed", "error", err)
+			}
+		}
+	}
+}
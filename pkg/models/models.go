@@ -1,30 +1,287 @@
 package models
 
-import "time"
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
 
 type (
 	Account struct {
-		Id        int64     `db:"id" json:"id"`
-		Owner     string    `db:"owner" json:"owner"`
-		Currency  string    `db:"currency" json:"currency"`
-		Balance   int64     `db:"balance" json:"balance"`
-		CreatedAt time.Time `db:"created_at" json:"created_at"`
-		Limit     int64
-		Offset    int64
+		Id               int64     `db:"id" json:"id"`
+		Owner            string    `db:"owner" json:"owner"`
+		Currency         string    `db:"currency" json:"currency"`
+		Balance          int64     `db:"balance" json:"balance"`
+		Status           string    `db:"status" json:"status"`
+		Kind             string    `db:"kind" json:"kind"`
+		Tier             string    `db:"tier" json:"tier"`
+		OverdraftLimit   int64     `db:"overdraft_limit" json:"overdraft_limit"`
+		HeldAmount       int64     `db:"held_amount" json:"held_amount"`
+		AvailableBalance int64     `db:"-" json:"available_balance"`
+		CreatedAt        time.Time `db:"created_at" json:"created_at"`
+		Limit            int64
+		Offset           int64
 	}
 
 	Entry struct {
+		Id                    int64     `db:"id" json:"id"`
+		AccountID             int64     `db:"account_id" json:"account_id"`
+		Amount                int64     `db:"amount" json:"amount"`
+		Type                  string    `db:"type" json:"type"`
+		TransferID            *int64    `db:"transfer_id" json:"transfer_id"`
+		CounterpartyAccountID *int64    `db:"counterparty_account_id" json:"counterparty_account_id"`
+		CreatedAt             time.Time `db:"created_at" json:"created_at"`
+	}
+
+	BalanceSnapshot struct {
 		Id        int64     `db:"id" json:"id"`
 		AccountID int64     `db:"account_id" json:"account_id"`
-		Amount    int64     `db:"amount" json:"amount"`
+		Balance   int64     `db:"balance" json:"balance"`
+		TakenAt   time.Time `db:"taken_at" json:"taken_at"`
 		CreatedAt time.Time `db:"created_at" json:"created_at"`
 	}
 
 	Transfer struct {
+		Id             int64     `db:"id" json:"id"`
+		FromAccountID  int64     `db:"from_account_id" json:"from_account_id"`
+		ToAccountID    int64     `db:"to_account_id" json:"to_account_id"`
+		Amount         int64     `db:"amount" json:"amount"`
+		ToAmount       int64     `db:"to_amount" json:"to_amount"`
+		Fee            int64     `db:"fee" json:"fee"`
+		ExchangeRate   *string   `db:"exchange_rate" json:"exchange_rate,omitempty"`
+		SpreadBps      *int64    `db:"spread_bps" json:"spread_bps,omitempty"`
+		QuoteID        *string   `db:"quote_id" json:"quote_id,omitempty"`
+		ReversalOf     *int64    `db:"reversal_of" json:"reversal_of,omitempty"`
+		ReversedAmount int64     `db:"reversed_amount" json:"reversed_amount"`
+		Reason         *string   `db:"reason" json:"reason,omitempty"`
+		CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	}
+
+	FeeRule struct {
+		Id         int64     `db:"id" json:"id"`
+		Currency   *string   `db:"currency" json:"currency,omitempty"`
+		Tier       *string   `db:"tier" json:"tier,omitempty"`
+		MinAmount  int64     `db:"min_amount" json:"min_amount"`
+		FlatFee    int64     `db:"flat_fee" json:"flat_fee"`
+		PercentBps int64     `db:"percent_bps" json:"percent_bps"`
+		MinFee     int64     `db:"min_fee" json:"min_fee"`
+		MaxFee     *int64    `db:"max_fee" json:"max_fee,omitempty"`
+		Waived     bool      `db:"waived" json:"waived"`
+		CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	}
+
+	Hold struct {
+		Id             int64     `db:"id" json:"id"`
+		AccountID      int64     `db:"account_id" json:"account_id"`
+		ToAccountID    int64     `db:"to_account_id" json:"to_account_id"`
+		Amount         int64     `db:"amount" json:"amount"`
+		CapturedAmount int64     `db:"captured_amount" json:"captured_amount"`
+		Status         string    `db:"status" json:"status"`
+		TransferID     *int64    `db:"transfer_id" json:"transfer_id,omitempty"`
+		ExpiresAt      time.Time `db:"expires_at" json:"expires_at"`
+		CreatedAt      time.Time `db:"created_at" json:"created_at"`
+		UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+	}
+
+	TransferApproval struct {
+		Id             int64      `db:"id" json:"id"`
+		HoldID         int64      `db:"hold_id" json:"hold_id"`
+		Initiator      string     `db:"initiator" json:"initiator"`
+		FromAccountID  int64      `db:"from_account_id" json:"from_account_id"`
+		ToAccountID    int64      `db:"to_account_id" json:"to_account_id"`
+		Amount         int64      `db:"amount" json:"amount"`
+		Status         string     `db:"status" json:"status"`
+		DecidedBy      *string    `db:"decided_by" json:"decided_by,omitempty"`
+		DecisionReason *string    `db:"decision_reason" json:"decision_reason,omitempty"`
+		DecidedAt      *time.Time `db:"decided_at" json:"decided_at,omitempty"`
+		TransferID     *int64     `db:"transfer_id" json:"transfer_id,omitempty"`
+		ExpiresAt      time.Time  `db:"expires_at" json:"expires_at"`
+		CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+		UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
+	}
+
+	TransferBatch struct {
+		Id             int64      `db:"id" json:"id"`
+		Owner          string     `db:"owner" json:"owner"`
+		Mode           string     `db:"mode" json:"mode"`
+		Status         string     `db:"status" json:"status"`
+		ItemCount      int32      `db:"item_count" json:"item_count"`
+		SucceededCount int32      `db:"succeeded_count" json:"succeeded_count"`
+		FailedCount    int32      `db:"failed_count" json:"failed_count"`
+		CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+		CompletedAt    *time.Time `db:"completed_at" json:"completed_at,omitempty"`
+	}
+
+	TransferBatchItem struct {
+		Id            int64   `db:"id" json:"id"`
+		BatchID       int64   `db:"batch_id" json:"batch_id"`
+		Position      int32   `db:"position" json:"position"`
+		FromAccountID int64   `db:"from_account_id" json:"from_account_id"`
+		ToAccountID   int64   `db:"to_account_id" json:"to_account_id"`
+		Amount        int64   `db:"amount" json:"amount"`
+		Status        string  `db:"status" json:"status"`
+		TransferID    *int64  `db:"transfer_id" json:"transfer_id,omitempty"`
+		Error         *string `db:"error" json:"error,omitempty"`
+	}
+
+	ScheduledTransfer struct {
+		Id            int64      `db:"id" json:"id"`
+		Owner         string     `db:"owner" json:"owner"`
+		FromAccountID int64      `db:"from_account_id" json:"from_account_id"`
+		ToAccountID   int64      `db:"to_account_id" json:"to_account_id"`
+		Amount        int64      `db:"amount" json:"amount"`
+		Frequency     string     `db:"frequency" json:"frequency"`
+		StartAt       time.Time  `db:"start_at" json:"start_at"`
+		EndAt         *time.Time `db:"end_at" json:"end_at,omitempty"`
+		MaxRuns       *int32     `db:"max_runs" json:"max_runs,omitempty"`
+		Runs          int32      `db:"runs" json:"runs"`
+		Attempts      int32      `db:"attempts" json:"attempts"`
+		NextRunAt     *time.Time `db:"next_run_at" json:"next_run_at,omitempty"`
+		Status        string     `db:"status" json:"status"`
+		LastError     *string    `db:"last_error" json:"last_error,omitempty"`
+		CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+		UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`
+	}
+
+	ScheduledTransferRun struct {
+		Id                  int64     `db:"id" json:"id"`
+		ScheduledTransferID int64     `db:"scheduled_transfer_id" json:"scheduled_transfer_id"`
+		Occurrence          int32     `db:"occurrence" json:"occurrence"`
+		ScheduledFor        time.Time `db:"scheduled_for" json:"scheduled_for"`
+		Attempt             int32     `db:"attempt" json:"attempt"`
+		Status              string    `db:"status" json:"status"`
+		TransferID          *int64    `db:"transfer_id" json:"transfer_id,omitempty"`
+		Error               *string   `db:"error" json:"error,omitempty"`
+		CreatedAt           time.Time `db:"created_at" json:"created_at"`
+	}
+
+	TransferLimit struct {
+		Id           int64     `db:"id" json:"id"`
+		Currency     string    `db:"currency" json:"currency"`
+		Tier         string    `db:"tier" json:"tier"`
+		MaxTransfer  *int64    `db:"max_transfer" json:"max_transfer"`
+		DailyLimit   *int64    `db:"daily_limit" json:"daily_limit"`
+		MonthlyLimit *int64    `db:"monthly_limit" json:"monthly_limit"`
+		CreatedAt    time.Time `db:"created_at" json:"created_at"`
+		UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+	}
+
+	ExchangeRate struct {
 		Id            int64     `db:"id" json:"id"`
-		FromAccountID int64     `db:"from_account_id" json:"from_account_id"`
-		ToAccountID   int64     `db:"to_account_id" json:"to_account_id"`
-		Amount        int64     `db:"amount" json:"amount"`
+		BaseCurrency  string    `db:"base_currency" json:"base_currency"`
+		QuoteCurrency string    `db:"quote_currency" json:"quote_currency"`
+		Rate          string    `db:"rate" json:"rate"`
+		EffectiveAt   time.Time `db:"effective_at" json:"effective_at"`
 		CreatedAt     time.Time `db:"created_at" json:"created_at"`
 	}
+
+	FXQuote struct {
+		Id           string     `db:"id" json:"id"`
+		Username     string     `db:"username" json:"username"`
+		FromCurrency string     `db:"from_currency" json:"from_currency"`
+		ToCurrency   string     `db:"to_currency" json:"to_currency"`
+		FromAmount   int64      `db:"from_amount" json:"from_amount"`
+		ToAmount     int64      `db:"to_amount" json:"to_amount"`
+		Rate         string     `db:"rate" json:"rate"`
+		SpreadBps    int64      `db:"spread_bps" json:"spread_bps"`
+		ExpiresAt    time.Time  `db:"expires_at" json:"expires_at"`
+		UsedAt       *time.Time `db:"used_at" json:"used_at,omitempty"`
+		CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	}
+
+	AuditEvent struct {
+		Id         int64           `db:"id" json:"id"`
+		Actor      string          `db:"actor" json:"actor"`
+		Action     string          `db:"action" json:"action"`
+		EntityType string          `db:"entity_type" json:"entity_type"`
+		EntityID   string          `db:"entity_id" json:"entity_id"`
+		Before     json.RawMessage `db:"before" json:"before"`
+		After      json.RawMessage `db:"after" json:"after"`
+		RequestID  string          `db:"request_id" json:"request_id"`
+		ClientIP   string          `db:"client_ip" json:"client_ip"`
+		CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+	}
+
+	User struct {
+		Username            string       `db:"username" json:"username"`
+		HashedPassword      string       `db:"hashed_password" json:"-"`
+		FullName            string       `db:"full_name" json:"full_name"`
+		Email               string       `db:"email" json:"email"`
+		EmailVerified       bool         `db:"email_verified" json:"email_verified"`
+		Role                string       `db:"role" json:"role"`
+		PasswordChangedAt   time.Time    `db:"password_changed_at" json:"password_changed_at"`
+		FailedLoginAttempts int32        `db:"failed_login_attempts" json:"-"`
+		FirstFailedLoginAt  sql.NullTime `db:"first_failed_login_at" json:"-"`
+		LockoutCount        int32        `db:"lockout_count" json:"-"`
+		LockedUntil         sql.NullTime `db:"locked_until" json:"-"`
+		TOTPSecret          string       `db:"totp_secret" json:"-"`
+		TOTPEnabled         bool         `db:"totp_enabled" json:"totp_enabled"`
+		TOTPLastUsedStep    int64        `db:"totp_last_used_step" json:"-"`
+		CreatedAt           time.Time    `db:"created_at" json:"created_at"`
+	}
+
+	UserToken struct {
+		TokenHash string     `db:"token_hash" json:"-"`
+		Username  string     `db:"username" json:"username"`
+		Purpose   string     `db:"purpose" json:"purpose"`
+		ExpiresAt time.Time  `db:"expires_at" json:"expires_at"`
+		UsedAt    *time.Time `db:"used_at" json:"used_at,omitempty"`
+		CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	}
+
+	APIKey struct {
+		Id         int64          `db:"id" json:"id"`
+		Username   string         `db:"username" json:"username"`
+		Name       string         `db:"name" json:"name"`
+		Prefix     string         `db:"prefix" json:"prefix"`
+		SecretHash string         `db:"secret_hash" json:"-"`
+		Scopes     pq.StringArray `db:"scopes" json:"scopes"`
+		ExpiresAt  *time.Time     `db:"expires_at" json:"expires_at,omitempty"`
+		LastUsedAt *time.Time     `db:"last_used_at" json:"last_used_at,omitempty"`
+		RevokedAt  *time.Time     `db:"revoked_at" json:"revoked_at,omitempty"`
+		CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+	}
+
+	OAuthClient struct {
+		Id           string         `db:"id" json:"id"`
+		Owner        string         `db:"owner" json:"owner"`
+		Name         string         `db:"name" json:"name"`
+		SecretHash   string         `db:"secret_hash" json:"-"`
+		RedirectURIs pq.StringArray `db:"redirect_uris" json:"redirect_uris"`
+		Scopes       pq.StringArray `db:"scopes" json:"scopes"`
+		CreatedAt    time.Time      `db:"created_at" json:"created_at"`
+	}
+
+	OAuthConsent struct {
+		Username  string         `db:"username" json:"username"`
+		ClientID  string         `db:"client_id" json:"client_id"`
+		Scopes    pq.StringArray `db:"scopes" json:"scopes"`
+		RevokedAt *time.Time     `db:"revoked_at" json:"revoked_at,omitempty"`
+		CreatedAt time.Time      `db:"created_at" json:"created_at"`
+		UpdatedAt time.Time      `db:"updated_at" json:"updated_at"`
+	}
+
+	OAuthAuthorizationCode struct {
+		CodeHash      string         `db:"code_hash" json:"-"`
+		ClientID      string         `db:"client_id" json:"client_id"`
+		Username      string         `db:"username" json:"username"`
+		RedirectURI   string         `db:"redirect_uri" json:"redirect_uri"`
+		Scopes        pq.StringArray `db:"scopes" json:"scopes"`
+		CodeChallenge string         `db:"code_challenge" json:"-"`
+		ExpiresAt     time.Time      `db:"expires_at" json:"expires_at"`
+		UsedAt        *time.Time     `db:"used_at" json:"used_at,omitempty"`
+		CreatedAt     time.Time      `db:"created_at" json:"created_at"`
+	}
+
+	OAuthRefreshToken struct {
+		TokenHash string         `db:"token_hash" json:"-"`
+		ClientID  string         `db:"client_id" json:"client_id"`
+		Username  string         `db:"username" json:"username"`
+		Scopes    pq.StringArray `db:"scopes" json:"scopes"`
+		ExpiresAt time.Time      `db:"expires_at" json:"expires_at"`
+		RevokedAt *time.Time     `db:"revoked_at" json:"revoked_at,omitempty"`
+		CreatedAt time.Time      `db:"created_at" json:"created_at"`
+	}
 )
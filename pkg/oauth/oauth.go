@@ -0,0 +1,103 @@
+// Package oauth holds the protocol pieces of the OAuth 2.0 authorization
+// server that don't need the database: PKCE, scope strings and error codes.
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+)
+
+// Error codes from RFC 6749 returned to clients.
+const (
+	ErrInvalidRequest          = "invalid_request"
+	ErrInvalidClient           = "invalid_client"
+	ErrInvalidGrant            = "invalid_grant"
+	ErrInvalidScope            = "invalid_scope"
+	ErrAccessDenied            = "access_denied"
+	ErrUnsupportedGrantType    = "unsupported_grant_type"
+	ErrUnsupportedResponseType = "unsupported_response_type"
+	ErrServerError             = "server_error"
+)
+
+// CodeChallengeMethodS256 is the only PKCE method accepted, plain challenges
+// would leak the verifier along with the authorization request.
+const CodeChallengeMethodS256 = "S256"
+
+const (
+	minVerifierLength = 43
+	maxVerifierLength = 128
+)
+
+// ChallengeS256 derives the S256 code challenge of a PKCE verifier.
+func ChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE reports whether verifier is well formed and matches challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < minVerifierLength || len(verifier) > maxVerifierLength {
+		return false
+	}
+	for _, c := range verifier {
+		if !isUnreserved(c) {
+			return false
+		}
+	}
+
+	return subtle.ConstantTimeCompare([]byte(ChallengeS256(verifier)), []byte(challenge)) == 1
+}
+
+func isUnreserved(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// ParseScope splits a space separated scope parameter, dropping duplicates.
+func ParseScope(scope string) []string {
+	scopes := []string{}
+	for _, s := range strings.Fields(scope) {
+		if !Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// FormatScope joins scopes into a scope parameter.
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// Contains reports whether scopes holds scope.
+func Contains(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Subset reports whether every scope of scopes is in allowed.
+func Subset(scopes, allowed []string) bool {
+	for _, s := range scopes {
+		if !Contains(allowed, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Union returns the scopes of a followed by those of b it doesn't have.
+func Union(a, b []string) []string {
+	res := append([]string{}, a...)
+	for _, s := range b {
+		if !Contains(res, s) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery controls how often idle buckets are dropped from memory.
+const sweepEvery = time.Minute
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	policy    Policy
+}
+
+// MemoryBackend keeps buckets in process memory. Limits are per replica.
+type MemoryBackend struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (backend *MemoryBackend) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	now := backend.now()
+	backend.sweep(now)
+
+	b, ok := backend.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Burst), updatedAt: now, policy: policy}
+		backend.buckets[key] = b
+	}
+
+	b.tokens = refill(b.tokens, now.Sub(b.updatedAt), policy)
+	b.updatedAt = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return result(policy, allowed, b.tokens), nil
+}
+
+// sweep drops buckets that have refilled completely, they behave exactly
+// like a missing bucket.
+func (backend *MemoryBackend) sweep(now time.Time) {
+	if now.Sub(backend.lastSweep) < sweepEvery {
+		return
+	}
+	backend.lastSweep = now
+
+	for key, b := range backend.buckets {
+		if refill(b.tokens, now.Sub(b.updatedAt), b.policy) >= float64(b.policy.Burst) {
+			delete(backend.buckets, key)
+		}
+	}
+}
+
+func refill(tokens float64, elapsed time.Duration, policy Policy) float64 {
+	return math.Min(float64(policy.Burst), tokens+elapsed.Seconds()*policy.Rate)
+}
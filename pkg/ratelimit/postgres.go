@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"simplebank/pkg/connection"
+)
+
+// PostgresBackend keeps buckets in the rate_limit_buckets table so every
+// replica shares the same limits.
+type PostgresBackend struct {
+	db connection.DBTX
+}
+
+func NewPostgresBackend(db connection.DBTX) *PostgresBackend {
+	return &PostgresBackend{db: db}
+}
+
+func (backend *PostgresBackend) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	// The refill is computed from the stored row while it is locked by the
+	// upsert, so concurrent requests for the same key are serialized.
+	query := `INSERT INTO rate_limit_buckets AS b ("key", "tokens", "allowed", "updated_at")
+		VALUES ($1, $2::float8 - 1, true, now())
+		ON CONFLICT ("key") DO UPDATE SET
+			tokens = CASE
+				WHEN LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8) >= 1
+				THEN LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8) - 1
+				ELSE LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8)
+			END,
+			allowed = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8) >= 1,
+			updated_at = now()
+		RETURNING tokens, allowed`
+
+	var tokens float64
+	var allowed bool
+	err := backend.db.QueryRowContext(ctx, query, key, policy.Burst, policy.Rate).Scan(&tokens, &allowed)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed taking token")
+	}
+
+	return result(policy, allowed, tokens), nil
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Policy describes a token bucket: Burst requests may be made at once and
+// the bucket refills at Rate tokens per second.
+type Policy struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// Per builds a policy allowing n requests per period with a burst of n.
+func Per(name string, n int, period time.Duration) Policy {
+	return Policy{
+		Name:  name,
+		Rate:  float64(n) / period.Seconds(),
+		Burst: n,
+	}
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Backend stores token buckets. Implementations must be safe for
+// concurrent use.
+type Backend interface {
+	Allow(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// result derives the client facing numbers from the tokens left in a bucket.
+func result(policy Policy, allowed bool, tokens float64) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     policy.Burst,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     seconds((float64(policy.Burst) - tokens) / policy.Rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / policy.Rate)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,148 @@
+// Package rbac defines the roles users can have and what each of them is
+// allowed to do.
+package rbac
+
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleTeller   Role = "teller"
+	RoleAuditor  Role = "auditor"
+	RoleAdmin    Role = "admin"
+)
+
+type Permission string
+
+const (
+	// ReadOwnAccounts lets a user see the accounts they own.
+	ReadOwnAccounts Permission = "accounts:read:own"
+	// ReadAllAccounts lets a user see every account.
+	ReadAllAccounts Permission = "accounts:read:all"
+	// CreateOwnAccounts lets a user open accounts in their own name.
+	CreateOwnAccounts Permission = "accounts:create:own"
+	// CreateOwnTransfers lets a user move money out of accounts they own.
+	CreateOwnTransfers Permission = "transfers:create:own"
+	// PostCash lets a user post deposits and withdrawals on any account.
+	PostCash Permission = "cash:post"
+	// ReadAudit lets a user query the audit log.
+	ReadAudit Permission = "audit:read"
+	// ManageUsers lets a user change roles and unlock users.
+	ManageUsers Permission = "users:manage"
+	// ManageAccounts lets a user change the status of any account.
+	ManageAccounts Permission = "accounts:manage"
+	// ManageExchangeRates lets a user publish exchange rates.
+	ManageExchangeRates Permission = "exchange_rates:manage"
+	// ReadFees lets a user see the transfer fee rules.
+	ReadFees Permission = "fees:read"
+	// ManageFees lets a user change the transfer fee rules.
+	ManageFees Permission = "fees:manage"
+	// ReadLimits lets a user see the transfer limits.
+	ReadLimits Permission = "limits:read"
+	// ManageLimits lets a user change the transfer limits.
+	ManageLimits Permission = "limits:manage"
+	// ReverseTransfers lets a user give back the money of any transfer.
+	ReverseTransfers Permission = "transfers:reverse"
+	// ApproveTransfers lets a user approve or reject the transfers of others
+	// waiting for approval.
+	ApproveTransfers Permission = "transfers:approve"
+	// ImportData lets a user load accounts and transfers in bulk from files.
+	ImportData Permission = "data:import"
+)
+
+var matrix = map[Role][]Permission{
+	RoleCustomer: {
+		ReadOwnAccounts,
+		CreateOwnAccounts,
+		CreateOwnTransfers,
+	},
+	RoleTeller: {
+		ReadOwnAccounts,
+		ReadAllAccounts,
+		PostCash,
+	},
+	RoleAuditor: {
+		ReadOwnAccounts,
+		ReadAllAccounts,
+		ReadAudit,
+		ReadFees,
+		ReadLimits,
+	},
+	RoleAdmin: {
+		ReadOwnAccounts,
+		ReadAllAccounts,
+		CreateOwnAccounts,
+		CreateOwnTransfers,
+		PostCash,
+		ReadAudit,
+		ManageUsers,
+		ManageAccounts,
+		ManageExchangeRates,
+		ReadFees,
+		ManageFees,
+		ReadLimits,
+		ManageLimits,
+		ReverseTransfers,
+		ApproveTransfers,
+		ImportData,
+	},
+}
+
+// Roles lists every role, in increasing order of privilege.
+func Roles() []Role {
+	return []Role{RoleCustomer, RoleTeller, RoleAuditor, RoleAdmin}
+}
+
+// Valid reports whether role is a known role.
+func (role Role) Valid() bool {
+	_, ok := matrix[role]
+	return ok
+}
+
+// Can reports whether role grants permission.
+func (role Role) Can(permission Permission) bool {
+	for _, granted := range matrix[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Scope narrows what an API key can do. A request made with an API key
+// needs both its owner's role and one of the key's scopes to grant the
+// permission. No scope grants ManageUsers, ManageAccounts,
+// ManageExchangeRates, ManageFees or ManageLimits, those always need an
+// interactive login.
+type Scope string
+
+const (
+	ScopeAccountsRead   Scope = "accounts:read"
+	ScopeAccountsWrite  Scope = "accounts:write"
+	ScopeTransfersWrite Scope = "transfers:write"
+	ScopeCashWrite      Scope = "cash:write"
+	ScopeAuditRead      Scope = "audit:read"
+)
+
+var scopes = map[Scope][]Permission{
+	ScopeAccountsRead:   {ReadOwnAccounts, ReadAllAccounts},
+	ScopeAccountsWrite:  {CreateOwnAccounts},
+	ScopeTransfersWrite: {CreateOwnTransfers},
+	ScopeCashWrite:      {PostCash},
+	ScopeAuditRead:      {ReadAudit},
+}
+
+// Valid reports whether scope is a known scope.
+func (scope Scope) Valid() bool {
+	_, ok := scopes[scope]
+	return ok
+}
+
+// Grants reports whether scope covers permission.
+func (scope Scope) Grants(permission Permission) bool {
+	for _, granted := range scopes[scope] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package reqmeta
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// SystemActor is recorded when a call does not originate from an HTTP request.
+const SystemActor = "system"
+
+// Meta describes who is behind the current request.
+type Meta struct {
+	RequestID string
+	Actor     string
+	ClientIP  string
+}
+
+type contextKey struct{}
+
+// With returns a copy of ctx carrying meta.
+func With(ctx context.Context, meta Meta) context.Context {
+	return context.WithValue(ctx, contextKey{}, meta)
+}
+
+// From returns the Meta stored in ctx, defaulting the actor to SystemActor.
+func From(ctx context.Context) Meta {
+	meta, _ := ctx.Value(contextKey{}).(Meta)
+	if meta.Actor == "" {
+		meta.Actor = SystemActor
+	}
+	return meta
+}
+
+// NewID generates a random request id.
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
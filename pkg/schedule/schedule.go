@@ -0,0 +1,65 @@
+// Package schedule computes when the occurrences of a scheduled transfer
+// fall. Occurrences are counted from the start of the schedule rather than
+// from the previous run, so a late or retried run doesn't shift the ones
+// after it.
+package schedule
+
+import (
+	"time"
+
+	"simplebank/pkg/models"
+)
+
+// Frequencies of a scheduled transfer, Once runs a single time.
+const (
+	Once    = "once"
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+)
+
+// Occurrence returns when the nth occurrence, counting from 0, of a schedule
+// starting at start falls. Monthly schedules keep the day of the month of
+// start, moved back to the last day of shorter months: one starting on the
+// 31st runs on the 28th or 29th in February and on the 31st again in March.
+func Occurrence(frequency string, start time.Time, n int32) time.Time {
+	switch frequency {
+	case Daily:
+		return start.AddDate(0, 0, int(n))
+	case Weekly:
+		return start.AddDate(0, 0, 7*int(n))
+	case Monthly:
+		year, month, day := start.Date()
+		month += time.Month(n)
+		if last := daysIn(year, month, start.Location()); day > last {
+			day = last
+		}
+		hour, min, sec := start.Clock()
+		return time.Date(year, month, day, hour, min, sec, start.Nanosecond(), start.Location())
+	default:
+		return start
+	}
+}
+
+// Next returns when the occurrence after the first runs ones of transfer
+// falls, and false once the schedule is over: a one-off transfer ran, the
+// count was reached or the next occurrence is past the end date.
+func Next(transfer *models.ScheduledTransfer, runs int32) (time.Time, bool) {
+	if transfer.Frequency == Once && runs > 0 {
+		return time.Time{}, false
+	}
+	if transfer.MaxRuns != nil && runs >= *transfer.MaxRuns {
+		return time.Time{}, false
+	}
+
+	next := Occurrence(transfer.Frequency, transfer.StartAt, runs)
+	if transfer.EndAt != nil && next.After(*transfer.EndAt) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// daysIn returns the number of days of month, which may be past December.
+func daysIn(year int, month time.Month, loc *time.Location) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+}
@@ -0,0 +1,59 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvWriter writes one row per entry between an opening and a closing row,
+// the closing row carrying the totals. Amounts are in minor units like
+// everywhere in the API, debits and credits in their own columns.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (writer *csvWriter) Begin(header Header) error {
+	err := writer.w.Write([]string{"date", "entry_id", "type", "counterparty", "transfer_id", "debit", "credit", "balance"})
+	if err != nil {
+		return err
+	}
+	return writer.w.Write([]string{
+		header.From.Format(time.RFC3339), "", "opening_balance", "", "", "", "", strconv.FormatInt(header.OpeningBalance, 10),
+	})
+}
+
+func (writer *csvWriter) Line(line Line) error {
+	var debit, credit string
+	if line.Amount < 0 {
+		debit = strconv.FormatInt(-line.Amount, 10)
+	} else {
+		credit = strconv.FormatInt(line.Amount, 10)
+	}
+	var transferID string
+	if line.TransferID != nil {
+		transferID = strconv.FormatInt(*line.TransferID, 10)
+	}
+
+	return writer.w.Write([]string{
+		line.Date.Format(time.RFC3339), strconv.FormatInt(line.EntryID, 10), line.Type, line.Counterparty, transferID,
+		debit, credit, strconv.FormatInt(line.Balance, 10),
+	})
+}
+
+func (writer *csvWriter) End(summary Summary) error {
+	err := writer.w.Write([]string{
+		"", "", "closing_balance", "", "", strconv.FormatInt(summary.TotalDebits, 10),
+		strconv.FormatInt(summary.TotalCredits, 10), strconv.FormatInt(summary.ClosingBalance, 10),
+	})
+	if err != nil {
+		return err
+	}
+	writer.w.Flush()
+	return writer.w.Error()
+}
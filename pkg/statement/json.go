@@ -0,0 +1,53 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// jsonWriter writes a single object: the header fields, the entries array
+// and the summary fields, the entries encoded one at a time.
+type jsonWriter struct {
+	w       io.Writer
+	entries int
+}
+
+func newJSONWriter(w io.Writer) *jsonWriter {
+	return &jsonWriter{w: w}
+}
+
+func (writer *jsonWriter) Begin(header Header) error {
+	b, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	// reopen the header object to add the entries to it
+	b = append(bytes.TrimSuffix(b, []byte("}")), `,"entries":[`...)
+	_, err = writer.w.Write(b)
+	return err
+}
+
+func (writer *jsonWriter) Line(line Line) error {
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if writer.entries > 0 {
+		b = append([]byte(","), b...)
+	}
+	writer.entries++
+	_, err = writer.w.Write(b)
+	return err
+}
+
+func (writer *jsonWriter) End(summary Summary) error {
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	// the summary fields close the object opened by Begin
+	b = append([]byte("],"), bytes.TrimPrefix(b, []byte("{"))...)
+	_, err = writer.w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,221 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 in points, the unit of PDF.
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 40
+	fontSize   = 9
+	lineHeight = 12
+)
+
+// The objects known before the first page. The page tree and the catalog
+// are written last, once every page is known.
+const (
+	catalogObject = 1
+	pagesObject   = 2
+	fontObject    = 3
+	boldObject    = 4
+	firstFree     = 5
+)
+
+const (
+	dateLayout = "2006-01-02"
+	rowLayout  = "%-10s %-12s %-24s %10s %14s %14s"
+)
+
+// pdfWriter writes a plain text PDF a page at a time, only the page being
+// filled is held in memory. Courier keeps the columns aligned without font
+// metrics.
+type pdfWriter struct {
+	w       *countingWriter
+	offsets map[int]int64
+	next    int
+	pages   []int
+	page    bytes.Buffer
+	y       int
+	header  Header
+}
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	return &pdfWriter{w: &countingWriter{w: w}, offsets: make(map[int]int64), next: firstFree}
+}
+
+func (writer *pdfWriter) Begin(header Header) error {
+	writer.header = header
+
+	// the binary comment tells transfer tools the file isn't text
+	fmt.Fprint(writer.w, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	writer.object(fontObject, []byte("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>"))
+	writer.object(boldObject, []byte("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>"))
+
+	writer.newPage()
+	writer.text(true, "Account statement")
+	writer.text(false, "")
+	writer.text(false, fmt.Sprintf("Account   %d (%s)", header.AccountID, header.Owner))
+	writer.text(false, fmt.Sprintf("Period    %s to %s", header.From.Format(dateLayout), header.To.Format(dateLayout)))
+	writer.text(false, fmt.Sprintf("Currency  %s", header.Currency))
+	writer.text(false, fmt.Sprintf("Generated %s", header.GeneratedAt.Format("2006-01-02 15:04 MST")))
+	writer.text(false, "")
+	writer.text(false, fmt.Sprintf("Opening balance %s %s", formatAmount(header.OpeningBalance), header.Currency))
+	writer.text(false, "")
+	writer.columns()
+	return writer.w.err
+}
+
+func (writer *pdfWriter) Line(line Line) error {
+	if writer.y < margin+lineHeight {
+		if err := writer.endPage(); err != nil {
+			return err
+		}
+		writer.newPage()
+		writer.columns()
+	}
+
+	var transferID string
+	if line.TransferID != nil {
+		transferID = fmt.Sprint(*line.TransferID)
+	}
+	writer.text(false, fmt.Sprintf(rowLayout, line.Date.Format(dateLayout), truncate(line.Type, 12),
+		truncate(line.Counterparty, 24), transferID, formatAmount(line.Amount), formatAmount(line.Balance)))
+	return writer.w.err
+}
+
+func (writer *pdfWriter) End(summary Summary) error {
+	// the summary isn't split across pages
+	if writer.y < margin+6*lineHeight {
+		if err := writer.endPage(); err != nil {
+			return err
+		}
+		writer.newPage()
+	}
+
+	currency := writer.header.Currency
+	writer.text(false, "")
+	writer.text(false, fmt.Sprintf("Entries         %d", summary.EntryCount))
+	writer.text(false, fmt.Sprintf("Total debits    %s %s", formatAmount(summary.TotalDebits), currency))
+	writer.text(false, fmt.Sprintf("Total credits   %s %s", formatAmount(summary.TotalCredits), currency))
+	writer.text(true, fmt.Sprintf("Closing balance %s %s", formatAmount(summary.ClosingBalance), currency))
+	if err := writer.endPage(); err != nil {
+		return err
+	}
+
+	kids := make([]string, len(writer.pages))
+	for i, page := range writer.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+	}
+	writer.object(pagesObject, []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>",
+		strings.Join(kids, " "), len(writer.pages))))
+	writer.object(catalogObject, []byte(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObject)))
+
+	xref := writer.w.n
+	fmt.Fprintf(writer.w, "xref\n0 %d\n0000000000 65535 f \n", writer.next)
+	for object := 1; object < writer.next; object++ {
+		fmt.Fprintf(writer.w, "%010d 00000 n \n", writer.offsets[object])
+	}
+	fmt.Fprintf(writer.w, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", writer.next, catalogObject, xref)
+	return writer.w.err
+}
+
+// columns writes the titles of the entry columns.
+func (writer *pdfWriter) columns() {
+	writer.text(true, fmt.Sprintf(rowLayout, "Date", "Type", "Counterparty", "Transfer", "Amount", "Balance"))
+}
+
+func (writer *pdfWriter) newPage() {
+	writer.page.Reset()
+	writer.y = pageHeight - margin
+}
+
+// text adds a line to the current page, below the previous one.
+func (writer *pdfWriter) text(bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	writer.y -= lineHeight
+	fmt.Fprintf(&writer.page, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, fontSize, margin, writer.y, escape(s))
+}
+
+// endPage writes the current page with its number at the bottom.
+func (writer *pdfWriter) endPage() error {
+	fmt.Fprintf(&writer.page, "BT /F1 %d Tf %d %d Td (Page %d) Tj ET\n", fontSize, pageWidth-margin-7*fontSize, margin/2,
+		len(writer.pages)+1)
+
+	content := writer.allocate()
+	stream := append([]byte(fmt.Sprintf("<< /Length %d >>\nstream\n", writer.page.Len())), writer.page.Bytes()...)
+	writer.object(content, append(stream, "\nendstream"...))
+
+	page := writer.allocate()
+	writer.object(page, []byte(fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> /Contents %d 0 R >>",
+		pagesObject, pageWidth, pageHeight, fontObject, boldObject, content)))
+	writer.pages = append(writer.pages, page)
+	return writer.w.err
+}
+
+func (writer *pdfWriter) allocate() int {
+	object := writer.next
+	writer.next++
+	return object
+}
+
+// object writes an indirect object, recording where it starts for the
+// cross-reference table.
+func (writer *pdfWriter) object(number int, body []byte) {
+	writer.offsets[number] = writer.w.n
+	fmt.Fprintf(writer.w, "%d 0 obj\n", number)
+	writer.w.Write(body)
+	fmt.Fprint(writer.w, "\nendobj\n")
+}
+
+// escape makes s a PDF string literal body. The standard fonts only cover
+// WinAnsi, anything outside printable ASCII becomes a question mark.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r > '~':
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "~"
+}
+
+// countingWriter tracks the offset of what is written, which the
+// cross-reference table needs, and keeps the first error so the writes can
+// go unchecked.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (writer *countingWriter) Write(p []byte) (int, error) {
+	if writer.err != nil {
+		return 0, writer.err
+	}
+	n, err := writer.w.Write(p)
+	writer.n += int64(n)
+	writer.err = err
+	return n, err
+}
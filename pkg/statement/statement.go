@@ -0,0 +1,96 @@
+// Package statement renders account statements. A statement is written as
+// its entries are read: the header first, then one line per entry, then the
+// summary, so a statement of any length takes the same memory.
+package statement
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Formats a statement can be rendered in.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatPDF  = "pdf"
+)
+
+type (
+	Header struct {
+		AccountID int64  `json:"account_id"`
+		Owner     string `json:"owner"`
+		Currency  string `json:"currency"`
+		// From and To bound the statement, To excluded.
+		From           time.Time `json:"from"`
+		To             time.Time `json:"to"`
+		OpeningBalance int64     `json:"opening_balance"`
+		GeneratedAt    time.Time `json:"generated_at"`
+	}
+
+	Line struct {
+		EntryID int64     `json:"entry_id"`
+		Date    time.Time `json:"date"`
+		Type    string    `json:"type"`
+		// Amount is negative for debits. Balance is the balance of the
+		// account once the entry is booked.
+		Amount                int64  `json:"amount"`
+		Balance               int64  `json:"balance"`
+		TransferID            *int64 `json:"transfer_id"`
+		CounterpartyAccountID *int64 `json:"counterparty_account_id"`
+		// Counterparty describes the other side of the entry for people.
+		Counterparty string `json:"counterparty"`
+	}
+
+	Summary struct {
+		ClosingBalance int64 `json:"closing_balance"`
+		// TotalDebits and TotalCredits are both positive.
+		TotalDebits  int64 `json:"total_debits"`
+		TotalCredits int64 `json:"total_credits"`
+		EntryCount   int   `json:"entry_count"`
+	}
+)
+
+// Writer renders a statement. Begin is called once, then Line for every
+// entry in order, then End once.
+type Writer interface {
+	Begin(header Header) error
+	Line(line Line) error
+	End(summary Summary) error
+}
+
+// NewWriter returns the writer rendering format to w.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatJSON:
+		return newJSONWriter(w), nil
+	case FormatPDF:
+		return newPDFWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unknown statement format %q", format)
+	}
+}
+
+// ContentType returns the media type of format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatPDF:
+		return "application/pdf"
+	default:
+		return "application/json; charset=utf-8"
+	}
+}
+
+// formatAmount writes an amount in minor units with its two decimals, the
+// way people read it.
+func formatAmount(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
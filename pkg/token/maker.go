@@ -0,0 +1,12 @@
+package token
+
+import "time"
+
+// Maker creates and verifies tokens.
+type Maker interface {
+	CreateToken(username string, purpose string, duration time.Duration) (string, *Payload, error)
+	// CreateScopedToken creates an OAuth access token on behalf of username
+	// for the client, limited to scopes.
+	CreateScopedToken(username string, clientID string, scopes []string, duration time.Duration) (string, *Payload, error)
+	VerifyToken(token string) (*Payload, error)
+}
@@ -0,0 +1,53 @@
+package token
+
+import (
+	"errors"
+	"time"
+
+	"simplebank/pkg/reqmeta"
+)
+
+var (
+	ErrInvalidToken = errors.New("token is invalid")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Purposes a token can be issued for. A token is only accepted where its
+// purpose is expected, so an MFA challenge can't be used as an access token.
+const (
+	PurposeAccess = "access"
+	PurposeMFA    = "mfa"
+	// PurposeOAuth tokens are issued to third-party clients and are limited
+	// to the scopes the user consented to.
+	PurposeOAuth = "oauth"
+)
+
+// Payload is the data carried by a token.
+type Payload struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Purpose   string    `json:"purpose"`
+	ClientID  string    `json:"client_id,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+func NewPayload(username string, purpose string, duration time.Duration) *Payload {
+	now := time.Now()
+	return &Payload{
+		ID:        reqmeta.NewID(),
+		Username:  username,
+		Purpose:   purpose,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(duration),
+	}
+}
+
+// Valid checks if the token payload has expired.
+func (payload *Payload) Valid() error {
+	if time.Now().After(payload.ExpiredAt) {
+		return ErrExpiredToken
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of the application, read from the environment.
+type Config struct {
+	ServerAddress       string
+	TracingExporter     string
+	RateLimitBackend    string
+	TokenSymmetricKey   string
+	AccessTokenDuration time.Duration
+	MFATokenDuration    time.Duration
+	TOTPEncryptionKey   string
+	// OAuthRefreshTokenDuration is how long third-party clients can keep
+	// refreshing their access without the user.
+	OAuthRefreshTokenDuration time.Duration
+	// TransferTOTPThreshold is the amount above which a transfer needs a
+	// fresh TOTP code, 0 disables the check.
+	TransferTOTPThreshold int64
+	// FXSpreadBps is the margin taken on transfers between currencies, in
+	// basis points of the converted amount.
+	FXSpreadBps int64
+	// FXQuoteDuration is how long a quoted rate can be used.
+	FXQuoteDuration time.Duration
+	// HoldDuration is how long an authorized hold reserves funds before it
+	// expires, HoldSweepInterval how often expired holds are released.
+	HoldDuration      time.Duration
+	HoldSweepInterval time.Duration
+	// ScheduledTransferInterval is how often due scheduled transfers are
+	// run. A failed occurrence is tried up to ScheduledTransferMaxAttempts
+	// times, ScheduledTransferRetryDelay times the failures apart.
+	ScheduledTransferInterval    time.Duration
+	ScheduledTransferMaxAttempts int32
+	ScheduledTransferRetryDelay  time.Duration
+	// TransferApprovalThreshold is the amount above which a transfer waits
+	// for a second person to approve it, 0 disables approvals. Requests not
+	// decided within TransferApprovalDuration expire.
+	TransferApprovalThreshold int64
+	TransferApprovalDuration  time.Duration
+	// BalanceSnapshotInterval is how often account balances are snapshot to
+	// speed up point-in-time balance queries.
+	BalanceSnapshotInterval time.Duration
+
+	// BaseURL is where users reach the application, used to build the
+	// links sent by email.
+	BaseURL string
+	// MailerBackend is one of smtp, file or memory.
+	MailerBackend                  string
+	MailFrom                       string
+	MailDir                        string
+	SMTPHost                       string
+	SMTPPort                       int
+	SMTPUsername                   string
+	SMTPPassword                   string
+	PasswordResetTokenDuration     time.Duration
+	EmailVerificationTokenDuration time.Duration
+
+	LoginMaxAttempts   int32
+	LoginAttemptWindow time.Duration
+	LoginLockout       time.Duration
+	LoginMaxLockout    time.Duration
+
+	// TrustedProxies are the addresses or networks of the proxies whose
+	// X-Forwarded-For header gives the client ip. None are trusted by
+	// default, the client ip is then the peer address.
+	TrustedProxies []string
+}
+
+// MinSymmetricKeySize is the shortest secret key accepted.
+const MinSymmetricKeySize = 32
+
+// LoadConfig reads the configuration from environment variables, falling
+// back to defaults suitable for local development. Secrets have no default,
+// Validate reports the ones missing.
+func LoadConfig() Config {
+	return Config{
+		ServerAddress:       getEnv("SERVER_ADDRESS", "0.0.0.0:8080"),
+		TracingExporter:     getEnv("TRACING_EXPORTER", "none"),
+		RateLimitBackend:    getEnv("RATE_LIMIT_BACKEND", "memory"),
+		TokenSymmetricKey:   getEnv("TOKEN_SYMMETRIC_KEY", ""),
+		AccessTokenDuration: getEnvDuration("ACCESS_TOKEN_DURATION", 15*time.Minute),
+		MFATokenDuration:    getEnvDuration("MFA_TOKEN_DURATION", 5*time.Minute),
+		TOTPEncryptionKey:   getEnv("TOTP_ENCRYPTION_KEY", ""),
+
+		OAuthRefreshTokenDuration: getEnvDuration("OAUTH_REFRESH_TOKEN_DURATION", 30*24*time.Hour),
+
+		TransferTOTPThreshold: getEnvInt64("TRANSFER_TOTP_THRESHOLD", 0),
+		FXSpreadBps:           getEnvInt64("FX_SPREAD_BPS", 50),
+		FXQuoteDuration:       getEnvDuration("FX_QUOTE_DURATION", 30*time.Second),
+		HoldDuration:          getEnvDuration("HOLD_DURATION", 7*24*time.Hour),
+		HoldSweepInterval:     getEnvDuration("HOLD_SWEEP_INTERVAL", time.Minute),
+
+		ScheduledTransferInterval:    getEnvDuration("SCHEDULED_TRANSFER_INTERVAL", time.Minute),
+		ScheduledTransferMaxAttempts: int32(getEnvInt64("SCHEDULED_TRANSFER_MAX_ATTEMPTS", 3)),
+		ScheduledTransferRetryDelay:  getEnvDuration("SCHEDULED_TRANSFER_RETRY_DELAY", time.Hour),
+
+		TransferApprovalThreshold: getEnvInt64("TRANSFER_APPROVAL_THRESHOLD", 0),
+		TransferApprovalDuration:  getEnvDuration("TRANSFER_APPROVAL_DURATION", 48*time.Hour),
+
+		BalanceSnapshotInterval: getEnvDuration("BALANCE_SNAPSHOT_INTERVAL", time.Hour),
+
+		BaseURL:                        getEnv("BASE_URL", "http://localhost:8080"),
+		MailerBackend:                  getEnv("MAILER_BACKEND", "file"),
+		MailFrom:                       getEnv("MAIL_FROM", "Simple Bank <no-reply@simplebank.local>"),
+		MailDir:                        getEnv("MAIL_DIR", "tmp/mail"),
+		SMTPHost:                       getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:                       int(getEnvInt64("SMTP_PORT", 587)),
+		SMTPUsername:                   getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:                   getEnv("SMTP_PASSWORD", ""),
+		PasswordResetTokenDuration:     getEnvDuration("PASSWORD_RESET_TOKEN_DURATION", time.Hour),
+		EmailVerificationTokenDuration: getEnvDuration("EMAIL_VERIFICATION_TOKEN_DURATION", 24*time.Hour),
+
+		LoginMaxAttempts:   int32(getEnvInt64("LOGIN_MAX_ATTEMPTS", 5)),
+		LoginAttemptWindow: getEnvDuration("LOGIN_ATTEMPT_WINDOW", 15*time.Minute),
+		LoginLockout:       getEnvDuration("LOGIN_LOCKOUT", 5*time.Minute),
+		LoginMaxLockout:    getEnvDuration("LOGIN_MAX_LOCKOUT", 24*time.Hour),
+
+		TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+	}
+}
+
+// Validate checks the configuration can be used to start the application.
+func (config Config) Validate() error {
+	if len(config.TokenSymmetricKey) < MinSymmetricKeySize {
+		return fmt.Errorf("TOKEN_SYMMETRIC_KEY must be set to at least %d characters", MinSymmetricKeySize)
+	}
+	if len(config.TOTPEncryptionKey) < MinSymmetricKeySize {
+		return fmt.Errorf("TOTP_ENCRYPTION_KEY must be set to at least %d characters", MinSymmetricKeySize)
+	}
+	return nil
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// getEnvList reads a comma separated list, empty when the variable isn't set.
+func getEnvList(key string) []string {
+	var list []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+func getEnvInt64(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(getEnv(key, ""), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
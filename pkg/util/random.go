@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"math/rand"
 	"strings"
 	"time"
@@ -46,3 +47,8 @@ func RandomCurrency() string {
 	l := len(code)
 	return code[rand.Intn(l)]
 }
+
+// Generate a random email
+func RandomEmail() string {
+	return fmt.Sprintf("%s@email.com", RandomString(6))
+}